@@ -46,7 +46,7 @@ func main() {
 	wg := sync.WaitGroup{}
 
 	// Initialize prc
-	prc := processor.NewProcessor(rabbitMQPublisher, rabbitMQConsumer, zLogger, cfg.FareRules, cfg.TimeBoundaries)
+	prc := processor.NewProcessor(rabbitMQPublisher, rabbitMQConsumer, zLogger, cfg.FareRules, cfg.TimeBoundaries, cfg.Validation, cfg.Reassembly)
 	go prc.ProcessDeliveries()
 	wg.Add(1)
 
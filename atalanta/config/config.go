@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/spf13/viper"
 	"log"
+	"time"
 )
 
 // RabbitMQConfig holds RabbitMQ connection details
@@ -30,6 +31,19 @@ type FareRulesConfig struct {
 	MovingNightFarePerKm float64 `mapstructure:"moving_night_fare_per_km" json:"moving_night_fare_per_km"`
 }
 
+// ValidationConfig holds the rules the segments are checked against besides the speed limit of FareRulesConfig,
+// a zero value disables its rule. MaxHopDistance is in km. segments breaking a rule are not billed
+type ValidationConfig struct {
+	MaxTimeGap     time.Duration `mapstructure:"max_time_gap" json:"max_time_gap"`
+	MaxHopDistance float64       `mapstructure:"max_hop_distance" json:"max_hop_distance"`
+}
+
+// ReassemblyConfig holds how long the parts of a delivery split by Hermes are waited for, 5 minutes by default.
+// a delivery still missing parts after the timeout is dropped
+type ReassemblyConfig struct {
+	Timeout time.Duration `mapstructure:"timeout" json:"timeout"`
+}
+
 // TimeBoundariesConfig holds time boundaries rules
 type TimeBoundariesConfig struct {
 	DayStartHour int `mapstructure:"day_start_hour" json:"day_start_hour"`
@@ -42,6 +56,8 @@ type Config struct {
 	Service        ServiceConfig        `mapstructure:"service" json:"service"`
 	FareRules      FareRulesConfig      `mapstructure:"fare_rules" json:"fare_rules"`
 	TimeBoundaries TimeBoundariesConfig `mapstructure:"time_boundaries" json:"time_boundaries"`
+	Validation     ValidationConfig     `mapstructure:"validation" json:"validation"`
+	Reassembly     ReassemblyConfig     `mapstructure:"reassembly" json:"reassembly"`
 }
 
 // LoadConfig initializes Viper and loads the configuration from the YAML file
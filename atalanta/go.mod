@@ -15,7 +15,7 @@ require (
 )
 
 require (
-	github.com/aref81/snappbox_fare_estimator v0.0.0-20240926212217-4931ec870fc2 // indirect
+	github.com/aref81/snappbox_fare_estimator/shared/distance v0.0.0 // indirect
 	github.com/davecgh/go-spew v1.1.2-0.20180830191138-d8f796af33cc // indirect
 	github.com/fsnotify/fsnotify v1.7.0 // indirect
 	github.com/hashicorp/hcl v1.0.0 // indirect
@@ -37,3 +37,7 @@ require (
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/aref81/snappbox_fare_estimator/shared/models => ../shared/models
+
+replace github.com/aref81/snappbox_fare_estimator/shared/distance => ../shared/distance
@@ -152,6 +152,53 @@ func TestCalculateFare_MinimumFare(t *testing.T) {
 	assert.Equal(t, fareRules.MinFare, fare, "The fare should be set to the minimum fare")
 }
 
+func TestCalculateFare_StopDetection(t *testing.T) {
+	fareRules := config.FareRulesConfig{
+		FlagAmount:           5.0,
+		MovingDayFarePerKm:   10.0,
+		MovingNightFarePerKm: 15.0,
+		IdleFarePerHour:      2.0,
+		MinFare:              0,
+	}
+	timeBoundaries := config.TimeBoundariesConfig{
+		DayStartHour: 6,
+		DayEndHour:   20,
+	}
+
+	calculator := &fareCalculator{
+		fareConfig:     fareRules,
+		timeBoundaries: timeBoundaries,
+	}
+
+	// the status set by the stop detection of Hermes takes precedence over the speed of the segments:
+	// - First segment: GPS jitter at a stop, faster than the idle speed
+	// - Second segment: crawling in traffic, slower than the idle speed
+	start := time.Date(2023, 9, 30, 10, 0, 0, 0, time.UTC).Unix() // 10:00 AM (daytime)
+	delivery := &models.Delivery{
+		ID: 1,
+		Segments: []models.DeliverySegment{
+			{
+				StartTime:   start,
+				ElapsedTime: 0.5,
+				Distance:    6.0,
+				Speed:       12.0,
+				Status:      models.StatusIdle,
+			},
+			{
+				StartTime:   start + 1800,
+				ElapsedTime: 0.5,
+				Distance:    4.0,
+				Speed:       8.0,
+				Status:      models.StatusMoving,
+			},
+		},
+	}
+
+	fare := calculator.calculateFare(delivery)
+	expectedFare := fareRules.FlagAmount + (0.5 * fareRules.IdleFarePerHour) + (4.0 * fareRules.MovingDayFarePerKm)
+	assert.Equal(t, expectedFare, fare, "The segments should be billed by their status")
+}
+
 func TestCalculateFare_ConsecutiveSegments_DayAndNight(t *testing.T) {
 	fareRules := config.FareRulesConfig{
 		FlagAmount:           5.0,
@@ -9,6 +9,8 @@ import (
 	"github.com/aref81/snappbox_fare_estimator/shared/models"
 	"github.com/streadway/amqp"
 	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,6 +18,11 @@ type Processor struct {
 	publisher      broker.Publisher
 	consumer       broker.Consumer[amqp.Delivery]
 	fareCalculator *fareCalculator
+	policy         *models.ValidationPolicy
+	reassembler    *reassembler
+	incomplete     int64
+	inFlight       sync.WaitGroup
+	fares          atomic.Int64
 	log            *zap.Logger
 }
 
@@ -23,7 +30,9 @@ func NewProcessor(publisher broker.Publisher,
 	consumer broker.Consumer[amqp.Delivery],
 	log *zap.Logger,
 	fareRules config.FareRulesConfig,
-	timeBoundaries config.TimeBoundariesConfig) *Processor {
+	timeBoundaries config.TimeBoundariesConfig,
+	validation config.ValidationConfig,
+	reassembly config.ReassemblyConfig) *Processor {
 	return &Processor{
 		publisher: publisher,
 		consumer:  consumer,
@@ -31,11 +40,18 @@ func NewProcessor(publisher broker.Publisher,
 			fareConfig:     fareRules,
 			timeBoundaries: timeBoundaries,
 		},
-		log: log,
+		policy: models.NewValidationPolicy(models.ValidationRules{
+			MaxSpeed:       fareRules.MaxSpeed,
+			MaxTimeGap:     validation.MaxTimeGap,
+			MaxHopDistance: validation.MaxHopDistance,
+		}),
+		reassembler: newReassembler(reassembly.Timeout),
+		log:         log,
 	}
 }
 
 // ProcessDeliveries consume the deliveries coming from rabbitMQ and process the DeliveryFare for it
+// the parts of split deliveries are reassembled first, deliveries missing parts after the timeout are dropped
 func (p *Processor) ProcessDeliveries() {
 	msgs, err := p.consumer.Consume(context.Background())
 	if err != nil {
@@ -44,32 +60,77 @@ func (p *Processor) ProcessDeliveries() {
 
 	startTime := time.Now()
 	i := 0
+	ticker := time.NewTicker(p.reassembler.timeout / 2)
+	defer ticker.Stop()
 
-	for msg := range msgs {
-		var delivery models.Delivery
-		if err := json.Unmarshal(msg.Body, &delivery); err != nil {
+	for {
+		var msg amqp.Delivery
+		var ok bool
+		select {
+		case msg, ok = <-msgs:
+			if !ok {
+				return
+			}
+		case now := <-ticker.C:
+			p.dropIncomplete(p.reassembler.expire(now))
+			continue
+		}
+
+		if completion, ok := models.ParseJobCompletion(msg.Body); ok {
+			// the parts of a job are all sent before its completion
+			p.dropIncomplete(p.reassembler.drain())
+			p.forwardJobCompletion(completion)
+			continue
+		}
+
+		delivery := &models.Delivery{}
+		if err := json.Unmarshal(msg.Body, delivery); err != nil {
 			p.log.Warn("Failed to unmarshal processor", zap.Error(err))
 			continue
 		}
+		if delivery.IsPart() {
+			delivery, err = p.reassembler.add(delivery)
+			if err != nil {
+				p.log.Warn("Failed to reassemble delivery", zap.Error(err))
+				continue
+			}
+			if delivery == nil {
+				// waiting for the other parts
+				continue
+			}
+		}
 
+		p.inFlight.Add(1)
 		go func(delivery *models.Delivery) {
+			defer p.inFlight.Done()
 			err := p.processDeliveryFare(delivery)
 			if err != nil {
 				p.log.Warn("Failed to process Delivery Fare", zap.Error(err))
 			}
-		}(&delivery)
+		}(delivery)
 
 		if i%1000 == 0 {
 			p.log.Info("Processed",
 				zap.Int("total processed deliveries", i),
+				zap.Any("violations", p.policy.Violations()),
+				zap.Int64("incomplete deliveries", p.incomplete),
 				zap.String("Duration", fmt.Sprintf("%s", time.Now().Sub(startTime))))
 		}
 		i++
 	}
 }
 
+// dropIncomplete reports the deliveries dropped by the reassembler, no fare is calculated for them
+func (p *Processor) dropIncomplete(errs []error) {
+	for _, err := range errs {
+		p.incomplete++
+		p.log.Error("Delivery dropped before all of its parts were received", zap.Error(err))
+	}
+}
+
 // processDeliveryFare generate the DeliverFare for a single Delivery and push it to the rabbitMQ
 func (p *Processor) processDeliveryFare(delivery *models.Delivery) error {
+	p.validateSegments(delivery)
 	totalFare := p.fareCalculator.calculateFare(delivery)
 
 	fare := models.DeliveryFare{
@@ -88,7 +149,43 @@ func (p *Processor) processDeliveryFare(delivery *models.Delivery) error {
 		p.log.Error("Failed to publish fare", zap.Error(err))
 		return err
 	}
+	p.fares.Add(1)
 
 	//p.log.Info("Fare calculated and sent", zap.Int("delivery_id", delivery.ID), zap.Float64("total_fare", totalFare))
 	return nil
 }
+
+// forwardJobCompletion forwards the completion of a job to Hephaestus, once the fares of all the deliveries received before it are published
+func (p *Processor) forwardJobCompletion(completion *models.JobCompletion) {
+	p.inFlight.Wait()
+	completion.Fares = p.fares.Swap(0)
+
+	completionBytes, err := json.Marshal(completion)
+	if err != nil {
+		p.log.Error("Failed to serialize job completion", zap.String("job_id", completion.JobID), zap.Error(err))
+		return
+	}
+	if err := p.publisher.PublishMessage(context.Background(), completionBytes); err != nil {
+		p.log.Error("Failed to forward job completion", zap.String("job_id", completion.JobID), zap.Error(err))
+		return
+	}
+
+	p.log.Info("Job completion forwarded",
+		zap.String("job_id", completion.JobID),
+		zap.Int64("deliveries", completion.Deliveries),
+		zap.Int64("fares", completion.Fares))
+}
+
+// validateSegments removes the segments breaking a rule of the validation policy, so they are not billed
+func (p *Processor) validateSegments(delivery *models.Delivery) {
+	valid := delivery.Segments[:0]
+	for _, segment := range delivery.Segments {
+		if err := p.policy.ValidateSegment(segment); err != nil {
+			p.policy.Record(err)
+			p.log.Warn("Invalid segment", zap.Int("delivery_id", delivery.ID), zap.Error(err))
+			continue
+		}
+		valid = append(valid, segment)
+	}
+	delivery.Segments = valid
+}
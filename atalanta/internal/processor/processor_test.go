@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aref81/snappbox_fare_estimator/atalanta/config"
+	"github.com/aref81/snappbox_fare_estimator/shared/broker/rabbitMQ/mock"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestValidateSegments(t *testing.T) {
+	processor := NewProcessor(nil, nil, zap.NewNop(),
+		config.FareRulesConfig{MaxSpeed: 80},
+		config.TimeBoundariesConfig{},
+		config.ValidationConfig{MaxTimeGap: 30 * time.Minute, MaxHopDistance: 5},
+		config.ReassemblyConfig{})
+
+	delivery := &models.Delivery{
+		ID: 1,
+		Segments: []models.DeliverySegment{
+			{ElapsedTime: 0.1, Distance: 3.0, Speed: 30.0},
+			{ElapsedTime: 0.05, Distance: 4.5, Speed: 90.0}, // faster than the max speed of the fare rules
+			{ElapsedTime: 1.0, Distance: 4.0, Speed: 4.0},   // longer than the max time gap
+			{ElapsedTime: 0.1, Distance: 6.0, Speed: 60.0},  // longer than the max hop distance
+		},
+	}
+	processor.validateSegments(delivery)
+
+	assert.Equal(t, []models.DeliverySegment{{ElapsedTime: 0.1, Distance: 3.0, Speed: 30.0}}, delivery.Segments)
+	assert.Equal(t, map[string]int64{
+		models.RuleMaxSpeed:       1,
+		models.RuleMaxTimeGap:     1,
+		models.RuleMaxHopDistance: 1,
+		models.RuleServiceArea:    0,
+		models.RuleMaxAccuracy:    0,
+	}, processor.policy.Violations())
+}
+
+func TestProcessDeliveries_ForwardsJobCompletion(t *testing.T) {
+	broker := mock.NewMockRabbitMQ()
+	broker.DeclareQueue("deliveries", 10)
+	broker.DeclareQueue("fares", 10)
+	deliveries := mock.NewMockRabbitMQPublisher(broker, "deliveries")
+
+	processor := NewProcessor(mock.NewMockRabbitMQPublisher(broker, "fares"), mock.NewMockRabbitMQConsumer(broker, "deliveries"), zap.NewNop(),
+		config.FareRulesConfig{FlagAmount: 1.3},
+		config.TimeBoundariesConfig{},
+		config.ValidationConfig{},
+		config.ReassemblyConfig{})
+
+	for id := 1; id <= 3; id++ {
+		body, err := json.Marshal(models.NewDelivery(id))
+		assert.NoError(t, err)
+		assert.NoError(t, deliveries.PublishMessage(context.Background(), body))
+	}
+	body, err := json.Marshal(models.NewJobCompletion("job-1", 3, 1723697700))
+	assert.NoError(t, err)
+	assert.NoError(t, deliveries.PublishMessage(context.Background(), body))
+	// closing the queue ends ProcessDeliveries, CloseQueue would also remove it from the broker
+	queue, err := broker.GetQueue("deliveries")
+	assert.NoError(t, err)
+	close(queue)
+
+	processor.ProcessDeliveries()
+
+	fares, err := broker.GetQueue("fares")
+	assert.NoError(t, err)
+	assert.Len(t, fares, 4)
+	for i := 0; i < 3; i++ {
+		_, ok := models.ParseJobCompletion((<-fares).Body)
+		assert.False(t, ok, "the fares should be published before the completion")
+	}
+	completion, ok := models.ParseJobCompletion((<-fares).Body)
+	assert.True(t, ok)
+	assert.Equal(t, "job-1", completion.JobID)
+	assert.Equal(t, int64(3), completion.Deliveries)
+	assert.Equal(t, int64(3), completion.Fares)
+}
+
+func TestProcessDeliveries_ReassemblesParts(t *testing.T) {
+	broker := mock.NewMockRabbitMQ()
+	broker.DeclareQueue("deliveries", 10)
+	broker.DeclareQueue("fares", 10)
+	deliveries := mock.NewMockRabbitMQPublisher(broker, "deliveries")
+
+	fareRules := config.FareRulesConfig{FlagAmount: 1.3, MovingDayFarePerKm: 1.3, MovingNightFarePerKm: 0.9, IdleFarePerHour: 11.9}
+	timeBoundaries := config.TimeBoundariesConfig{DayStartHour: 5, DayEndHour: 24}
+	processor := NewProcessor(mock.NewMockRabbitMQPublisher(broker, "fares"), mock.NewMockRabbitMQConsumer(broker, "deliveries"), zap.NewNop(),
+		fareRules, timeBoundaries, config.ValidationConfig{}, config.ReassemblyConfig{})
+
+	delivery, parts := splitDelivery(1, 10, 4)
+	_, incomplete := splitDelivery(2, 10, 4)
+	for _, part := range []*models.Delivery{parts[2], incomplete[0], parts[0], parts[1]} {
+		body, err := json.Marshal(part)
+		assert.NoError(t, err)
+		assert.NoError(t, deliveries.PublishMessage(context.Background(), body))
+	}
+	body, err := json.Marshal(models.NewJobCompletion("job-1", 2, 1723697700))
+	assert.NoError(t, err)
+	assert.NoError(t, deliveries.PublishMessage(context.Background(), body))
+	queue, err := broker.GetQueue("deliveries")
+	assert.NoError(t, err)
+	close(queue)
+
+	processor.ProcessDeliveries()
+
+	fares, err := broker.GetQueue("fares")
+	assert.NoError(t, err)
+	assert.Len(t, fares, 2, "the delivery missing parts should not get a fare")
+	var fare models.DeliveryFare
+	assert.NoError(t, json.Unmarshal((<-fares).Body, &fare))
+	assert.Equal(t, 1, fare.ID)
+	assert.InDelta(t, processor.fareCalculator.calculateFare(delivery), fare.Fare, 1e-9, "the parts should be billed as the whole delivery")
+
+	completion, ok := models.ParseJobCompletion((<-fares).Body)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), completion.Fares)
+	assert.Equal(t, int64(1), processor.incomplete)
+}
@@ -0,0 +1,94 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"sort"
+	"time"
+)
+
+// DefaultReassemblyTimeout is how long the parts of a delivery are waited for, when no timeout is configured
+const DefaultReassemblyTimeout = 5 * time.Minute
+
+// ErrMissingParts is returned for deliveries dropped before all of their parts were received
+var ErrMissingParts = errors.New("delivery parts missing")
+
+// pendingDelivery is a delivery waiting for some of its parts
+type pendingDelivery struct {
+	partial   *models.PartialDelivery
+	firstSeen time.Time
+}
+
+// reassembler joins the parts of the deliveries Hermes split, it is only used by the goroutine consuming the deliveries
+type reassembler struct {
+	timeout time.Duration
+	pending map[int]*pendingDelivery
+	now     func() time.Time
+}
+
+// newReassembler creates a reassembler waiting timeout for the parts of a delivery
+func newReassembler(timeout time.Duration) *reassembler {
+	if timeout <= 0 {
+		timeout = DefaultReassemblyTimeout
+	}
+	return &reassembler{
+		timeout: timeout,
+		pending: make(map[int]*pendingDelivery),
+		now:     time.Now,
+	}
+}
+
+// add adds a part of a delivery, and returns the delivery once all of its parts are received
+func (r *reassembler) add(part *models.Delivery) (*models.Delivery, error) {
+	pending, ok := r.pending[part.ID]
+	if !ok {
+		partial, err := models.NewPartialDelivery(part)
+		if err != nil {
+			return nil, err
+		}
+		pending = &pendingDelivery{partial: partial, firstSeen: r.now()}
+		r.pending[part.ID] = pending
+	} else if err := pending.partial.Add(part); err != nil {
+		return nil, err
+	}
+
+	if !pending.partial.Complete() {
+		return nil, nil
+	}
+	delete(r.pending, part.ID)
+	return pending.partial.Delivery(), nil
+}
+
+// expire drops the deliveries which have waited for their parts for longer than the timeout, with an error for each
+func (r *reassembler) expire(now time.Time) []error {
+	return r.drop(func(pending *pendingDelivery) bool {
+		return now.Sub(pending.firstSeen) > r.timeout
+	})
+}
+
+// drain drops all the deliveries waiting for parts, with an error for each
+func (r *reassembler) drain() []error {
+	return r.drop(func(*pendingDelivery) bool {
+		return true
+	})
+}
+
+// drop drops the deliveries matching the condition, in order of their ID
+func (r *reassembler) drop(condition func(*pendingDelivery) bool) []error {
+	var ids []int
+	for id, pending := range r.pending {
+		if condition(pending) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	errs := make([]error, 0, len(ids))
+	for _, id := range ids {
+		partial := r.pending[id].partial
+		errs = append(errs, fmt.Errorf("%w, delivery %d, missing parts %v", ErrMissingParts, id, partial.Missing()))
+		delete(r.pending, id)
+	}
+	return errs
+}
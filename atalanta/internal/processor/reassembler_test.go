@@ -0,0 +1,61 @@
+package processor
+
+import (
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// splitDelivery returns a delivery of segments segments and its parts of at most maxSegments segments
+func splitDelivery(id int, segments int, maxSegments int) (*models.Delivery, []*models.Delivery) {
+	delivery := models.NewDelivery(id)
+	for i := 0; i < segments; i++ {
+		delivery.Segments = append(delivery.Segments, models.DeliverySegment{
+			StartTime: int64(1723697700 + i*60), ElapsedTime: 60.0 / 3600, Speed: 30, Distance: 0.5,
+		})
+	}
+	return delivery, delivery.Split(maxSegments)
+}
+
+func TestReassembler(t *testing.T) {
+	reassembler := newReassembler(time.Minute)
+	delivery, parts := splitDelivery(1, 10, 4)
+
+	for _, i := range []int{1, 2} {
+		joined, err := reassembler.add(parts[i])
+		assert.NoError(t, err)
+		assert.Nil(t, joined, "the delivery should wait for all of its parts")
+	}
+	_, err := reassembler.add(parts[1])
+	assert.ErrorIs(t, err, models.ErrDuplicatePart)
+
+	joined, err := reassembler.add(parts[0])
+	assert.NoError(t, err)
+	assert.Equal(t, delivery, joined)
+	assert.Empty(t, reassembler.pending)
+}
+
+func TestReassembler_MissingParts(t *testing.T) {
+	now := time.Unix(1723697700, 0)
+	reassembler := newReassembler(time.Minute)
+	reassembler.now = func() time.Time { return now }
+
+	_, first := splitDelivery(1, 10, 4)
+	_, second := splitDelivery(2, 10, 4)
+	reassembler.add(first[0])
+	now = now.Add(30 * time.Second)
+	reassembler.add(second[0])
+	reassembler.add(second[2])
+
+	assert.Empty(t, reassembler.expire(now.Add(20*time.Second)))
+	errs := reassembler.expire(now.Add(40 * time.Second))
+	assert.Len(t, errs, 1, "only the first delivery should time out")
+	assert.ErrorIs(t, errs[0], ErrMissingParts)
+	assert.Contains(t, errs[0].Error(), "delivery 1, missing parts [1 2]")
+
+	errs = reassembler.drain()
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "delivery 2, missing parts [1]")
+	assert.Empty(t, reassembler.pending)
+}
@@ -11,7 +11,6 @@ import (
 	"go.uber.org/zap"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 	"time"
 )
@@ -49,13 +48,18 @@ func main() {
 	// Graceful shutdown handling
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	wg := sync.WaitGroup{}
+
+	completionFile := cfg.CSV.CompletionFile
+	if completionFile == "" {
+		completionFile = cfg.CSV.FilePath + ".done"
+	}
 
 	consumer, err := processor.NewConsumer(
 		rabbitMQConsumer,
 		csvWriter,
 		cfg.CSV.BatchSize,
 		time.Duration(cfg.CSV.FlushInterval)*time.Second,
+		completionFile,
 		zLogger,
 	)
 
@@ -63,18 +67,23 @@ func main() {
 		zLogger.Fatal("Failed to Consumer Processor", zap.Error(err))
 	}
 
+	// the consumer finishes once the job is completed, or once it is stopped by a signal
+	finished := make(chan struct{})
 	go func() {
+		defer close(finished)
 		if err := consumer.Consume(ctx); err != nil {
 			zLogger.Fatal("Error while consuming messages", zap.Error(err))
 		}
 	}()
-	wg.Add(1)
 
-	wg.Wait()
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	zLogger.Info("Shutting down gracefully")
-	cancel()
+	select {
+	case <-quit:
+		zLogger.Info("Shutting down gracefully")
+		cancel()
+		<-finished
+	case <-finished:
+		zLogger.Info("Hephaestus finished the job, shutting down")
+	}
 }
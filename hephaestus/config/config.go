@@ -14,10 +14,12 @@ type RabbitMQConfig struct {
 }
 
 // CSVConfig holds CSV file config
+// CompletionFile is where the completion record of a job is written, FilePath with a .done suffix by default
 type CSVConfig struct {
-	FilePath      string `mapstructure:"file_path" json:"file_path"`
-	BatchSize     int    `mapstructure:"batch_size" json:"batch_size"`
-	FlushInterval int    `mapstructure:"flush_interval" json:"flush_interval"`
+	FilePath       string `mapstructure:"file_path" json:"file_path"`
+	BatchSize      int    `mapstructure:"batch_size" json:"batch_size"`
+	FlushInterval  int    `mapstructure:"flush_interval" json:"flush_interval"`
+	CompletionFile string `mapstructure:"completion_file" json:"completion_file"`
 }
 
 // Config is the config structure of the Hephaestus service
@@ -10,16 +10,19 @@ require (
 	github.com/aref81/snappbox_fare_estimator/shared/models v0.0.0-20240928073531-9280fc692104
 	github.com/spf13/viper v1.19.0
 	github.com/streadway/amqp v1.1.0
+	github.com/stretchr/testify v1.9.0
 	go.uber.org/zap v1.27.0
 )
 
 require (
-	github.com/aref81/snappbox_fare_estimator v0.0.0-20240926212217-4931ec870fc2 // indirect
+	github.com/aref81/snappbox_fare_estimator/shared/distance v0.0.0 // indirect
+	github.com/davecgh/go-spew v1.1.2-0.20180830191138-d8f796af33cc // indirect
 	github.com/fsnotify/fsnotify v1.7.0 // indirect
 	github.com/hashicorp/hcl v1.0.0 // indirect
 	github.com/magiconair/properties v1.8.7 // indirect
 	github.com/mitchellh/mapstructure v1.5.0 // indirect
 	github.com/pelletier/go-toml/v2 v2.2.2 // indirect
+	github.com/pmezard/go-difflib v1.0.1-0.20181226105442-5d4384ee4fb2 // indirect
 	github.com/sagikazarmark/locafero v0.4.0 // indirect
 	github.com/sagikazarmark/slog-shim v0.1.0 // indirect
 	github.com/sourcegraph/conc v0.3.0 // indirect
@@ -34,3 +37,7 @@ require (
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/aref81/snappbox_fare_estimator/shared/models => ../shared/models
+
+replace github.com/aref81/snappbox_fare_estimator/shared/distance => ../shared/distance
@@ -0,0 +1,32 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// completionRecord is written once a job is completed, so scripts running a batch know all of its fares are on disk
+type completionRecord struct {
+	JobID       string `json:"job_id"`
+	Deliveries  int64  `json:"deliveries"`
+	Fares       int64  `json:"fares"`
+	Written     int64  `json:"written"`
+	CompletedAt int64  `json:"completed_at"`
+}
+
+// writeCompletionRecord writes the record as JSON, replacing the record of a previous job
+func writeCompletionRecord(path string, record completionRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create completion directory: %v", err)
+	}
+	content, err := json.MarshalIndent(record, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode completion record: %v", err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("failed to write completion record: %v", err)
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/streadway/amqp"
 	"go.uber.org/zap"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,12 +22,16 @@ type Processor struct {
 	mutex              sync.Mutex
 	batchSize          int
 	flushInterval      time.Duration
+	completionFile     string
+	inFlight           sync.WaitGroup
+	written            atomic.Int64
 }
 
 func NewConsumer(
 	consumer broker.Consumer[amqp.Delivery],
 	deliveryFareWriter output.DeliveryFareWriter,
 	batchSize int, flushInterval time.Duration,
+	completionFile string,
 	logger *zap.Logger,
 ) (*Processor, error) {
 	return &Processor{
@@ -36,10 +41,12 @@ func NewConsumer(
 		fareBuffer:         []*models.DeliveryFare{},
 		batchSize:          batchSize,
 		flushInterval:      flushInterval,
+		completionFile:     completionFile,
 	}, nil
 }
 
 // Consume receives the DeliveryFare data from RabbitMQ and writes them into a csv file in efficient way
+// it returns once the context is canceled, or once a job completion is received and its completion record is written
 func (p *Processor) Consume(ctx context.Context) error {
 	msgs, err := p.consumer.Consume(context.Background())
 	if err != nil {
@@ -49,14 +56,28 @@ func (p *Processor) Consume(ctx context.Context) error {
 	ticker := time.NewTicker(p.flushInterval)
 	defer ticker.Stop()
 
+	finished := make(chan struct{})
 	go func() {
+		defer close(finished)
 		startTime := time.Now()
 		i := 0
 
 		for {
 			select {
-			case msg := <-msgs:
+			case msg, ok := <-msgs:
+				if !ok {
+					p.inFlight.Wait()
+					p.flush()
+					return
+				}
+				if completion, ok := models.ParseJobCompletion(msg.Body); ok {
+					p.completeJob(completion)
+					return
+				}
+
+				p.inFlight.Add(1)
 				go func(delivery amqp.Delivery) {
+					defer p.inFlight.Done()
 					var fare models.DeliveryFare
 					if err := json.Unmarshal(delivery.Body, &fare); err != nil {
 						p.log.Error("Failed to unmarshal delivery fare", zap.Error(err))
@@ -69,19 +90,51 @@ func (p *Processor) Consume(ctx context.Context) error {
 				p.log.Info("Flushing buffer due to timeout",
 					zap.Int("total processed deliveries", i),
 					zap.String("Duration", fmt.Sprintf("%s", time.Now().Sub(startTime))))
-				p.flushBuffer()
+				p.flush()
 
 			case <-ctx.Done():
-				p.flushBuffer()
+				p.inFlight.Wait()
+				p.flush()
 				return
 			}
 		}
 	}()
 
-	<-ctx.Done()
+	<-finished
 	return nil
 }
 
+// completeJob flushes the fares received before the completion of the job, and writes its completion record
+func (p *Processor) completeJob(completion *models.JobCompletion) {
+	p.inFlight.Wait()
+	p.flush()
+
+	record := completionRecord{
+		JobID:       completion.JobID,
+		Deliveries:  completion.Deliveries,
+		Fares:       completion.Fares,
+		Written:     p.written.Load(),
+		CompletedAt: time.Now().Unix(),
+	}
+	if record.Written != record.Fares {
+		p.log.Warn("Number of fares written differs from the fares sent",
+			zap.String("job_id", record.JobID),
+			zap.Int64("fares", record.Fares),
+			zap.Int64("written", record.Written))
+	}
+
+	if err := writeCompletionRecord(p.completionFile, record); err != nil {
+		p.log.Error("Failed to write completion record", zap.String("file", p.completionFile), zap.Error(err))
+		return
+	}
+	p.log.Info("Job completed",
+		zap.String("job_id", record.JobID),
+		zap.Int64("deliveries", record.Deliveries),
+		zap.Int64("fares", record.Fares),
+		zap.Int64("written", record.Written),
+		zap.String("completion_file", p.completionFile))
+}
+
 // addToBuffer temporarily stores the received Deliveries in memory to later flush them into disk
 // flushing is done when batch size exceeds or timeout is reached
 func (p *Processor) addToBuffer(fare *models.DeliveryFare) {
@@ -94,6 +147,13 @@ func (p *Processor) addToBuffer(fare *models.DeliveryFare) {
 	}
 }
 
+// flush writes the data in the buffer into a csv file on disk, for flushes outside of addToBuffer
+func (p *Processor) flush() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.flushBuffer()
+}
+
 // flushBuffer writes the data in the buffer into a csv file on disk
 func (p *Processor) flushBuffer() {
 	if len(p.fareBuffer) == 0 {
@@ -105,6 +165,8 @@ func (p *Processor) flushBuffer() {
 	err := p.deliveryFareWriter.WriteBatch(p.fareBuffer, p.log)
 	if err != nil {
 		p.log.Error("Failed to write batch", zap.Error(err))
+	} else {
+		p.written.Add(int64(len(p.fareBuffer)))
 	}
 
 	p.fareBuffer = []*models.DeliveryFare{}
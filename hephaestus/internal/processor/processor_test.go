@@ -0,0 +1,108 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aref81/snappbox_fare_estimator/shared/broker/rabbitMQ/mock"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingWriter keeps the fares written, instead of writing them to a file
+type recordingWriter struct {
+	mutex sync.Mutex
+	fares []*models.DeliveryFare
+}
+
+func (w *recordingWriter) WriteBatch(fares []*models.DeliveryFare, log *zap.Logger) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.fares = append(w.fares, fares...)
+	return nil
+}
+
+func (w *recordingWriter) Close() {}
+
+// publishFares publishes a fare for each of the delivery IDs to the queue
+func publishFares(t *testing.T, publisher *mock.MockRabbitMQPublisher, ids ...int) {
+	for _, id := range ids {
+		body, err := json.Marshal(models.NewDeliveryFare(id, float64(id)))
+		assert.NoError(t, err)
+		assert.NoError(t, publisher.PublishMessage(context.Background(), body))
+	}
+}
+
+// consume runs Consume until it returns, and fails the test if it does not return in time
+func consume(t *testing.T, processor *Processor) {
+	done := make(chan error, 1)
+	go func() {
+		done <- processor.Consume(context.Background())
+	}()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Consume did not return")
+	}
+}
+
+func TestConsume_JobCompletion(t *testing.T) {
+	broker := mock.NewMockRabbitMQ()
+	broker.DeclareQueue("fares", 10)
+	publisher := mock.NewMockRabbitMQPublisher(broker, "fares")
+	writer := &recordingWriter{}
+	completionFile := filepath.Join(t.TempDir(), "fares.csv.done")
+
+	// a batch larger than the fares, so they are only written by the flush of the completion
+	processor, err := NewConsumer(mock.NewMockRabbitMQConsumer(broker, "fares"), writer, 100, time.Minute, completionFile, zap.NewNop())
+	assert.NoError(t, err)
+
+	publishFares(t, publisher, 1, 2, 3)
+	completion := models.NewJobCompletion("job-1", 3, time.Now().Unix())
+	completion.Fares = 3
+	body, err := json.Marshal(completion)
+	assert.NoError(t, err)
+	assert.NoError(t, publisher.PublishMessage(context.Background(), body))
+
+	consume(t, processor)
+
+	assert.Len(t, writer.fares, 3, "the fares received before the completion should be written")
+	assert.Equal(t, int64(3), processor.written.Load())
+
+	content, err := os.ReadFile(completionFile)
+	assert.NoError(t, err)
+	var record completionRecord
+	assert.NoError(t, json.Unmarshal(content, &record))
+	assert.Equal(t, "job-1", record.JobID)
+	assert.Equal(t, int64(3), record.Deliveries)
+	assert.Equal(t, int64(3), record.Fares)
+	assert.Equal(t, record.Fares, record.Written)
+}
+
+func TestConsume_ClosedQueue(t *testing.T) {
+	broker := mock.NewMockRabbitMQ()
+	broker.DeclareQueue("fares", 10)
+	writer := &recordingWriter{}
+	completionFile := filepath.Join(t.TempDir(), "fares.csv.done")
+
+	processor, err := NewConsumer(mock.NewMockRabbitMQConsumer(broker, "fares"), writer, 100, time.Minute, completionFile, zap.NewNop())
+	assert.NoError(t, err)
+
+	publishFares(t, mock.NewMockRabbitMQPublisher(broker, "fares"), 1, 2)
+	queue, err := broker.GetQueue("fares")
+	assert.NoError(t, err)
+	close(queue)
+
+	consume(t, processor)
+
+	assert.Len(t, writer.fares, 2, "the fares buffered should be written once the queue is closed")
+	_, err = os.Stat(completionFile)
+	assert.True(t, os.IsNotExist(err), "no completion record should be written without a job completion")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"github.com/aref81/snappbox_fare_estimator/hermes/config"
+	"github.com/aref81/snappbox_fare_estimator/hermes/internal/checkpoint"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// resumeFromCheckpoint loads the checkpoint of the previous run and resumes the reader from it, unless fresh is set.
+// it returns a nil reader along with the tracker of the previous run if it was completed, and a nil tracker if
+// checkpoints are disabled
+func resumeFromCheckpoint(cfg *config.Config, reader input.DeliveryReader, fresh bool, log *zap.Logger) (input.DeliveryReader, *checkpoint.Tracker, error) {
+	if !cfg.Checkpoint.Enabled || reader == nil {
+		return reader, nil, nil
+	}
+	// the position of a checkpoint is only meaningful when deliveries are read in the order of the files
+	if cfg.Grouping.Enabled {
+		return nil, nil, errors.New("checkpoints are not supported with the grouping stage")
+	}
+	if parallelFiles(cfg) > 1 {
+		return nil, nil, errors.New("checkpoints are not supported with parallel_files more than 1")
+	}
+	resumable, ok := reader.(input.Resumable)
+	if !ok {
+		return nil, nil, errors.New("the input reader does not support checkpoints")
+	}
+
+	stateFile := cfg.Checkpoint.StateFile
+	if stateFile == "" {
+		stateFile = checkpoint.DefaultStateFile
+	}
+	if fresh {
+		log.Info("Starting a fresh run, the previous checkpoint is removed", zap.String("state_file", stateFile))
+		if err := checkpoint.Remove(stateFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	state, err := checkpoint.Load(stateFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case state == nil:
+		log.Info("No checkpoint found, starting from the beginning", zap.String("state_file", stateFile))
+	case state.Completed:
+		log.Info("The previous run was completed, nothing to resume. use -fresh to run again",
+			zap.String("state_file", stateFile),
+			zap.Int64("deliveries", state.Deliveries))
+		return nil, checkpoint.NewTracker(stateFile, cfg.Checkpoint.SaveInterval, state, log), nil
+	case state.File != "":
+		log.Info("Resuming from checkpoint",
+			zap.String("file", state.File),
+			zap.Int64("offset", state.Offset),
+			zap.Int64("line", state.Line),
+			zap.Int("last_delivery_id", state.LastDeliveryID),
+			zap.Int64("deliveries", state.Deliveries))
+		resumable.ResumeAt(state.Origin())
+	}
+
+	return resumable, checkpoint.NewTracker(stateFile, cfg.Checkpoint.SaveInterval, state, log), nil
+}
+
+// parallelFiles returns the number of files read concurrently in the configured input format
+func parallelFiles(cfg *config.Config) int {
+	switch strings.ToLower(cfg.Input.Format) {
+	case "ndjson", "jsonl":
+		return cfg.NDJSON.ParallelFiles
+	case "parquet":
+		return cfg.Parquet.ParallelFiles
+	default:
+		return cfg.CSV.ParallelFiles
+	}
+}
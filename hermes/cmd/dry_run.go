@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"github.com/aref81/snappbox_fare_estimator/hermes/config"
+	"github.com/aref81/snappbox_fare_estimator/hermes/internal/processor"
+	"github.com/aref81/snappbox_fare_estimator/hermes/internal/report"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"go.uber.org/zap"
+	"os"
+	"slices"
+)
+
+// dryRun reads the input and builds the deliveries like a normal run, but prints a report instead of publishing them.
+// it needs no broker, and leaves the checkpoint and the quarantine file untouched
+func dryRun(cfg *config.Config, pointFilter models.PointFilter, validationPolicy *models.ValidationPolicy, stopDetector *models.StopDetector, log *zap.Logger) error {
+	reader, err := newDeliveryReader(cfg, log)
+	if err != nil {
+		return err
+	}
+	if reader == nil {
+		return errors.New("the input format is none, there is nothing to read")
+	}
+
+	// rejections are only counted
+	quarantine, err := input.NewQuarantine("", false)
+	if err != nil {
+		return err
+	}
+	if quarantinable, ok := reader.(input.Quarantinable); ok {
+		quarantinable.SetRejectionSink(quarantine)
+	}
+
+	deliveryReport := report.NewReport()
+	deliveryProcessor := processor.NewDeliveryProcessor(deliveryReport, log)
+	deliveryProcessor.SetMaxSegments(cfg.Split.MaxSegments)
+	deliveryProcessor.SetPointFilter(pointFilter)
+	deliveryProcessor.SetValidationPolicy(validationPolicy)
+	deliveryProcessor.SetStopDetector(stopDetector)
+	deliveryProcessor.SetRejectionSink(quarantine)
+
+	// the deliveries are also built at each tolerance of the simplification, from the points of the reader
+	comparison, err := newSimplificationComparison(cfg.Simplification, cfg.FareRules, pointFilter, validationPolicy, stopDetector)
+	if err != nil {
+		return err
+	}
+	readPointChan := make(chan *models.DeliveryPoint, 100)
+	deliveryPointChan := make(chan *models.DeliveryPoint, 100)
+	readErrChan := make(chan error, 1)
+	go func() {
+		readErrChan <- reader.StreamDeliveryPoints(readPointChan, log)
+	}()
+	go func() {
+		defer close(deliveryPointChan)
+		for point := range readPointChan {
+			comparison.AddPoint(point)
+			deliveryPointChan <- point
+		}
+		comparison.Flush()
+	}()
+	stats, _ := deliveryProcessor.ProcessDeliveries(deliveryPointChan)
+	logMapMatching(validationPolicy.Rules.DistanceModel, log)
+	readErr := <-readErrChan
+	if err := quarantine.Close(log); err != nil {
+		return err
+	}
+
+	if err := deliveryReport.Write(os.Stdout, report.Summary{
+		Points:          stats.Points,
+		DuplicatePoints: stats.DuplicatePoints,
+		Deliveries:      stats.Deliveries,
+		Rejections:      quarantine.Counts(),
+	}); err != nil {
+		return err
+	}
+	if err := comparison.Write(os.Stdout); err != nil {
+		return err
+	}
+	return readErr
+}
+
+// newSimplificationComparison creates the comparison of the simplification at the tolerances of the report and
+// the configured one, on top of the point filter without simplification
+func newSimplificationComparison(cfg config.SimplificationConfig, fareRules config.FareRulesConfig, pointFilter models.PointFilter, validationPolicy *models.ValidationPolicy, stopDetector *models.StopDetector) (*report.SimplificationComparison, error) {
+	if simplified, ok := pointFilter.(models.SimplifiedFilter); ok {
+		pointFilter = simplified.PointFilter
+	}
+	tolerances := cfg.ReportTolerances
+	if len(tolerances) == 0 {
+		tolerances = report.DefaultTolerances
+	}
+	if cfg.Tolerance > 0 && !slices.Contains(tolerances, cfg.Tolerance) {
+		tolerances = append(slices.Clone(tolerances), cfg.Tolerance)
+	}
+	// the fares are estimated at the rates Atalanta bills them at, read from its own config
+	atalantaConfig, err := config.LoadAtalantaConfig(fareRules.AtalantaConfig)
+	if err != nil {
+		return nil, err
+	}
+	comparison, err := report.NewSimplificationComparison(cfg.Algorithm, tolerances, pointFilter, validationPolicy.Rules, models.FareRules{
+		FlagAmount:           atalantaConfig.FareRules.FlagAmount,
+		MinFare:              atalantaConfig.FareRules.MinFare,
+		IdleFarePerHour:      atalantaConfig.FareRules.IdleFarePerHour,
+		MovingDayFarePerKm:   atalantaConfig.FareRules.MovingDayFarePerKm,
+		MovingNightFarePerKm: atalantaConfig.FareRules.MovingNightFarePerKm,
+		DayStartHour:         atalantaConfig.TimeBoundaries.DayStartHour,
+		DayEndHour:           atalantaConfig.TimeBoundaries.DayEndHour,
+	})
+	if err != nil {
+		return nil, err
+	}
+	comparison.SetStopDetector(stopDetector)
+	return comparison, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/generator"
+	"github.com/aref81/snappbox_fare_estimator/shared/logger"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"go.uber.org/zap"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the generator writes synthetic delivery traces as CSV in the Hermes input format, for load tests and demos
+func main() {
+	output := flag.String("output", "synthetic_delivery_data.csv", "file the CSV is written to")
+	deliveries := flag.Int("deliveries", generator.DefaultDeliveries, "number of deliveries")
+	points := flag.Int("points", generator.DefaultPoints, "number of points of each delivery")
+	interval := flag.Duration("interval", generator.DefaultInterval, "time between two points of a delivery")
+	area := flag.String("area", formatArea(generator.DefaultArea), "bounding box of the points, as min_lat,min_lng,max_lat,max_lng")
+	stopRate := flag.Float64("stop-rate", 0.02, "probability of an idle stop starting at each point")
+	stopDuration := flag.Duration("stop-duration", generator.DefaultStopDuration, "duration of an idle stop")
+	nightShare := flag.Float64("night-share", 0.2, "share of the deliveries starting at night (00:00 - 05:00 UTC)")
+	spikeRate := flag.Float64("spike-rate", 0.01, "probability of each point being a GPS spike")
+	start := flag.String("start", "2024-08-12", "first day of the deliveries, which are spread over the week from it")
+	seed := flag.Int64("seed", 1, "seed of the random traces, runs with the same seed and options write the same file")
+	flag.Parse()
+
+	err := logger.InitLogger(zap.InfoLevel)
+	if err != nil {
+		fmt.Printf("Failed to initialize logger: %v\n", err)
+		os.Exit(1)
+	}
+	zLogger := logger.Logger
+
+	bounds, err := parseArea(*area)
+	if err != nil {
+		zLogger.Fatal("Invalid area", zap.Error(err))
+	}
+	startDay, err := time.Parse(time.DateOnly, *start)
+	if err != nil {
+		zLogger.Fatal("Invalid start day", zap.Error(err))
+	}
+
+	traceGenerator, err := generator.NewGenerator(generator.Options{
+		Deliveries:   *deliveries,
+		Points:       *points,
+		Interval:     *interval,
+		Area:         bounds,
+		StopRate:     *stopRate,
+		StopDuration: *stopDuration,
+		NightShare:   *nightShare,
+		SpikeRate:    *spikeRate,
+		Start:        startDay,
+		Seed:         *seed,
+	})
+	if err != nil {
+		zLogger.Fatal("Invalid generator options", zap.Error(err))
+	}
+
+	// the logs are written to stdout, so the traces always go to a file
+	file, err := os.Create(*output)
+	if err != nil {
+		zLogger.Fatal("Failed to create output file", zap.Error(err))
+	}
+
+	startTime := time.Now()
+	stats, err := traceGenerator.Write(file)
+	if err != nil {
+		file.Close()
+		zLogger.Fatal("Failed to generate traces", zap.Error(err))
+	}
+	if err := file.Close(); err != nil {
+		zLogger.Fatal("Failed to close output file", zap.Error(err))
+	}
+	zLogger.Info("Synthetic traces generated",
+		zap.String("output", *output),
+		zap.Int64("seed", *seed),
+		zap.Int64("deliveries", stats.Deliveries),
+		zap.Int64("points", stats.Points),
+		zap.Int64("stop_points", stats.StopPoints),
+		zap.Int64("spikes", stats.Spikes),
+		zap.Int64("night_deliveries", stats.NightDeliveries),
+		zap.String("Duration", fmt.Sprintf("%s", time.Now().Sub(startTime))))
+}
+
+// parseArea parses a bounding box written as min_lat,min_lng,max_lat,max_lng
+func parseArea(area string) (models.BoundingBox, error) {
+	parts := strings.Split(area, ",")
+	if len(parts) != 4 {
+		return models.BoundingBox{}, fmt.Errorf("expected min_lat,min_lng,max_lat,max_lng, got %q", area)
+	}
+	values := make([]float64, len(parts))
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return models.BoundingBox{}, fmt.Errorf("invalid bound %q: %v", part, err)
+		}
+		values[i] = value
+	}
+	return models.BoundingBox{MinLatitude: values[0], MinLongitude: values[1], MaxLatitude: values[2], MaxLongitude: values[3]}, nil
+}
+
+// formatArea writes a bounding box as min_lat,min_lng,max_lat,max_lng
+func formatArea(area models.BoundingBox) string {
+	return fmt.Sprintf("%g,%g,%g,%g", area.MinLatitude, area.MinLongitude, area.MaxLatitude, area.MaxLongitude)
+}
@@ -1,20 +1,33 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"github.com/aref81/snappbox_fare_estimator/hermes/config"
+	"github.com/aref81/snappbox_fare_estimator/hermes/internal/dedup"
 	"github.com/aref81/snappbox_fare_estimator/hermes/internal/processor"
-	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input/csv"
+	"github.com/aref81/snappbox_fare_estimator/hermes/internal/server"
+	"github.com/aref81/snappbox_fare_estimator/hermes/internal/throttle"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/mapmatch"
+	"github.com/aref81/snappbox_fare_estimator/shared/broker"
 	"github.com/aref81/snappbox_fare_estimator/shared/broker/rabbitMQ"
+	"github.com/aref81/snappbox_fare_estimator/shared/distance"
 	"github.com/aref81/snappbox_fare_estimator/shared/logger"
 	"github.com/aref81/snappbox_fare_estimator/shared/models"
 	"go.uber.org/zap"
 	"log"
 	"os"
 	"sync"
+	"time"
 )
 
 func main() {
+	fresh := flag.Bool("fresh", false, "ignore the checkpoint of the previous run and read the input from the beginning")
+	dryRunMode := flag.Bool("dry-run", false, "read the input and print a report of the deliveries instead of publishing them")
+	flag.Parse()
+
 	// Load configuration
 	cfg, err := config.LoadConfig()
 	if err != nil {
@@ -29,6 +42,69 @@ func main() {
 	}
 	zLogger := logger.Logger
 
+	pointFilter, err := models.NewPointFilter(cfg.Filter.Strategy, models.FilterOptions{
+		Window:           cfg.Filter.Window,
+		ProcessNoise:     cfg.Filter.ProcessNoise,
+		MeasurementNoise: cfg.Filter.MeasurementNoise,
+	})
+	if err != nil {
+		zLogger.Fatal("Failed to initialize point filter", zap.Error(err))
+		return
+	}
+	if cfg.Simplification.Tolerance > 0 {
+		simplifier, err := models.NewSimplifier(cfg.Simplification.Algorithm, cfg.Simplification.Tolerance)
+		if err != nil {
+			zLogger.Fatal("Failed to initialize trajectory simplification", zap.Error(err))
+			return
+		}
+		// the traces are simplified once cleaned of their noise
+		pointFilter = models.SimplifiedFilter{PointFilter: pointFilter, Simplifier: simplifier}
+	}
+	zLogger.Info("Point filter selected", zap.String("filter", pointFilter.Name()))
+	distanceModel, err := distance.NewModel(cfg.Distance.Model)
+	if err != nil {
+		zLogger.Fatal("Failed to initialize distance model", zap.Error(err))
+		return
+	}
+	if cfg.MapMatching.RoadNetwork != "" {
+		distanceModel, err = newMapMatcher(cfg.MapMatching, distanceModel, zLogger)
+		if err != nil {
+			zLogger.Fatal("Failed to load road network", zap.Error(err))
+			return
+		}
+	}
+	zLogger.Info("Distance model selected", zap.String("model", distanceModel.Name()))
+	validationPolicy := models.NewValidationPolicy(models.ValidationRules{
+		DistanceModel:  distanceModel,
+		MaxSpeed:       cfg.Validation.MaxSpeed,
+		MaxTimeGap:     cfg.Validation.MaxTimeGap,
+		MaxHopDistance: cfg.Validation.MaxHopDistance,
+		ServiceArea: models.BoundingBox{
+			MinLatitude:  cfg.Validation.ServiceArea.MinLatitude,
+			MaxLatitude:  cfg.Validation.ServiceArea.MaxLatitude,
+			MinLongitude: cfg.Validation.ServiceArea.MinLongitude,
+			MaxLongitude: cfg.Validation.ServiceArea.MaxLongitude,
+		},
+		MaxAccuracy:       cfg.Validation.MaxAccuracy,
+		PreferDeviceSpeed: cfg.Validation.PreferDeviceSpeed,
+	})
+
+	var stopDetector *models.StopDetector
+	if cfg.StopDetection.Enabled {
+		detector := models.NewStopDetector(cfg.StopDetection.Radius, cfg.StopDetection.MinDwell, distanceModel)
+		stopDetector = &detector
+		zLogger.Info("Stop detection enabled",
+			zap.Float64("radius", detector.Radius),
+			zap.String("min_dwell", fmt.Sprintf("%s", detector.MinDwell)))
+	}
+
+	if *dryRunMode {
+		if err := dryRun(cfg, pointFilter, validationPolicy, stopDetector, zLogger); err != nil {
+			zLogger.Fatal("Dry run failed", zap.Error(err))
+		}
+		return
+	}
+
 	// Initialize RabbitMQ connection
 	rabbitMQPublisher, err := rabbitMQ.NewRabbitMQPublisher(cfg.RabbitMQ.URL, cfg.RabbitMQ.Queue, zLogger)
 	if err != nil {
@@ -36,20 +112,232 @@ func main() {
 		return
 	}
 	defer rabbitMQPublisher.Close()
+	publishPool, err := newPublishPool(cfg.Publish, cfg.RateLimit, rabbitMQPublisher, zLogger)
+	if err != nil {
+		zLogger.Fatal("Failed to initialize publish pool", zap.Error(err))
+		return
+	}
+	// the pool publishes the deliveries still queued and closes the channels of its workers before the main publisher
+	// closes the connection, as the deferred calls run in reverse order
+	defer publishPool.Close()
 
-	deliveryPointChan := make(chan *models.DeliveryPoint, 100)
 	wg := sync.WaitGroup{}
+	deliveryProcessor := processor.NewDeliveryProcessor(rabbitMQPublisher, zLogger)
+	deliveryProcessor.SetPublishPool(publishPool)
+	deliveryProcessor.SetMaxSegments(cfg.Split.MaxSegments)
+	deliveryProcessor.SetPointFilter(pointFilter)
+	deliveryProcessor.SetValidationPolicy(validationPolicy)
+	deliveryProcessor.SetStopDetector(stopDetector)
 
 	// Initialize reader stream
-	reader := csv.NewDeliveryReader(cfg.CSV.FilePath)
-	go reader.StreamDeliveryPoints(deliveryPointChan, zLogger)
-	wg.Add(1)
+	reader, err := newDeliveryReader(cfg, zLogger)
+	if err != nil {
+		zLogger.Fatal("Failed to initialize input reader", zap.Error(err))
+		return
+	}
+	reader, tracker, err := resumeFromCheckpoint(cfg, reader, *fresh, zLogger)
+	if err != nil {
+		zLogger.Fatal("Failed to load checkpoint", zap.Error(err))
+		return
+	}
+	if reader == nil && tracker != nil {
+		// the previous run completed the job, which is completed again so Hephaestus does not wait for it
+		if err := deliveryProcessor.PublishJobCompletion(jobID(cfg.Job), tracker.State().Deliveries); err != nil {
+			zLogger.Fatal("Failed to publish job completion", zap.Error(err))
+			return
+		}
+	}
+	if reader != nil {
+		// rejected rows are appended to the quarantine file of the run being resumed
+		quarantine, err := input.NewQuarantine(cfg.Quarantine.FilePath, tracker != nil && tracker.State().File != "")
+		if err != nil {
+			zLogger.Fatal("Failed to initialize quarantine", zap.Error(err))
+			return
+		}
+		if quarantinable, ok := reader.(input.Quarantinable); ok {
+			quarantinable.SetRejectionSink(quarantine)
+		}
 
-	// Initialize publisher stream
-	processor := processor.NewDeliveryProcessor(rabbitMQPublisher, zLogger)
-	go processor.ProcessDeliveries(deliveryPointChan)
-	wg.Add(1)
+		deliveryPointChan := make(chan *models.DeliveryPoint, 100)
+		readErrChan := make(chan error, 1)
+		go func() {
+			readErrChan <- reader.StreamDeliveryPoints(deliveryPointChan, zLogger)
+		}()
+
+		// Initialize publisher stream, the input files have their own processor which is checkpointed and quarantined
+		fileProcessor := processor.NewDeliveryProcessor(rabbitMQPublisher, zLogger)
+		fileProcessor.SetPublishPool(publishPool)
+		fileProcessor.SetMaxSegments(cfg.Split.MaxSegments)
+		fileProcessor.SetPointFilter(pointFilter)
+		fileProcessor.SetValidationPolicy(validationPolicy)
+		fileProcessor.SetStopDetector(stopDetector)
+		if tracker != nil {
+			fileProcessor.SetTracker(tracker)
+		}
+		fileProcessor.SetRejectionSink(quarantine)
+		if cfg.Dedup.SkipPublished {
+			publishedSet, err := openPublishedSet(cfg.Dedup, zLogger)
+			if err != nil {
+				zLogger.Fatal("Failed to load published delivery IDs", zap.Error(err))
+				return
+			}
+			defer publishedSet.Close()
+			fileProcessor.SetPublishedSet(publishedSet)
+		}
+		// Hermes exits once the job of the input files is completed, unless it also serves the ingestion endpoints
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stats, _ := fileProcessor.ProcessDeliveries(deliveryPointChan)
+			logMapMatching(distanceModel, zLogger)
+			// a run is only completed, so it is not resumed, if all of its input was read. the job is completed
+			// either way, so Hephaestus does not wait for the deliveries which were not read
+			readErr := <-readErrChan
+			if readErr != nil {
+				zLogger.Error("Failed to read the whole input, the job is completed with the deliveries published", zap.Error(readErr))
+			}
+			deliveries := stats.Published
+			if tracker != nil {
+				if readErr == nil {
+					tracker.Finish()
+				}
+				// the deliveries published by the runs this one resumed are part of the job
+				deliveries = tracker.State().Deliveries
+			}
+			if err := quarantine.Close(zLogger); err != nil {
+				zLogger.Error("Failed to close quarantine file", zap.Error(err))
+			}
+			// the deliveries are confirmed by RabbitMQ once published by the pool, so the completion is queued after them
+			if err := fileProcessor.PublishJobCompletion(jobID(cfg.Job), deliveries); err != nil {
+				zLogger.Fatal("Failed to publish job completion", zap.Error(err))
+				return
+			}
+		}()
+	}
+
+	// Initialize HTTP ingestion endpoint
+	if cfg.HTTP.Enabled {
+		csvSchema, err := newCSVSchema(cfg.CSV)
+		if err != nil {
+			zLogger.Fatal("Failed to initialize HTTP server", zap.Error(err))
+			return
+		}
+		httpServer := server.NewHTTPServer(cfg.HTTP.Address, deliveryProcessor, csvSchema, zLogger)
+		httpServer.SetMaxBodySize(cfg.HTTP.MaxBodySize)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := httpServer.ListenAndServe(); err != nil {
+				zLogger.Fatal("HTTP server failed", zap.Error(err))
+			}
+		}()
+	}
+
+	// Initialize gRPC ingestion service
+	if cfg.GRPC.Enabled {
+		grpcServer := server.NewGRPCServer(cfg.GRPC.Address, deliveryProcessor, zLogger)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := grpcServer.ListenAndServe(); err != nil {
+				zLogger.Fatal("gRPC server failed", zap.Error(err))
+			}
+		}()
+	}
 
 	zLogger.Info("Hermes microservice started successfully")
 	wg.Wait()
+	zLogger.Info("Hermes microservice stopped")
+}
+
+// newPublishPool creates the pool publishing the deliveries, each of its workers publishes over its own channel
+// of the RabbitMQ connection, as a channel must not be used concurrently, which is closed with the pool.
+// the workers share the rate limit, if any
+func newPublishPool(cfg config.PublishConfig, rateLimit config.RateLimitConfig, rabbitMQPublisher *rabbitMQ.RabbitMQPublisher, log *zap.Logger) (*processor.PublishPool, error) {
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = processor.DefaultPublishWorkers
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = processor.DefaultPublishQueueSize
+	}
+
+	var limiter *throttle.Limiter
+	if rateLimit.MessagesPerSecond > 0 || rateLimit.BytesPerSecond > 0 {
+		limiter = throttle.NewLimiter(rateLimit.MessagesPerSecond, rateLimit.BytesPerSecond)
+		log.Info("Publish rate limited",
+			zap.Float64("messages_per_second", rateLimit.MessagesPerSecond),
+			zap.Float64("bytes_per_second", rateLimit.BytesPerSecond))
+		go limiter.Report(context.Background(), rateLimit.ReportInterval, log)
+	}
+
+	publishers := make([]broker.Publisher, 0, workers)
+	for i := 0; i < workers; i++ {
+		publisher, err := rabbitMQPublisher.NewChannelPublisher()
+		if err != nil {
+			for _, opened := range publishers {
+				opened.(interface{ Close() }).Close()
+			}
+			return nil, fmt.Errorf("failed to open channel of worker %d: %v", i, err)
+		}
+		if limiter != nil {
+			publishers = append(publishers, throttle.NewPublisher(publisher, limiter))
+			continue
+		}
+		publishers = append(publishers, publisher)
+	}
+	return processor.NewPublishPool(publishers, queueSize, log), nil
+}
+
+// openPublishedSet loads the IDs of the deliveries already published, which are skipped when read again
+func openPublishedSet(cfg config.DedupConfig, log *zap.Logger) (*dedup.PublishedSet, error) {
+	filePath := cfg.PublishedFile
+	if filePath == "" {
+		filePath = dedup.DefaultPublishedFile
+	}
+	publishedSet, err := dedup.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Skipping the deliveries already published", zap.String("published_file", filePath), zap.Int("published", publishedSet.Len()))
+	return publishedSet, nil
+}
+
+// newMapMatcher loads the road network the distances are measured on, the straight-line distances of the model are
+// used for the segments which cannot be matched to the roads
+func newMapMatcher(cfg config.MapMatchingConfig, model distance.Model, log *zap.Logger) (*mapmatch.Matcher, error) {
+	start := time.Now()
+	graph, err := mapmatch.LoadGraph(cfg.RoadNetwork)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Road network loaded",
+		zap.String("road_network", cfg.RoadNetwork),
+		zap.Int("nodes", graph.Nodes()),
+		zap.Int("edges", graph.Edges()),
+		zap.String("Duration", fmt.Sprintf("%s", time.Since(start))))
+	return mapmatch.NewMatcher(graph, mapmatch.Options{
+		SnapRadius: cfg.SnapRadius,
+		MaxDetour:  cfg.MaxDetour,
+		Fallback:   model,
+	}), nil
+}
+
+// logMapMatching logs how many segments were measured on the roads so far, if the distances are map matched
+func logMapMatching(model distance.Model, log *zap.Logger) {
+	matcher, ok := model.(*mapmatch.Matcher)
+	if !ok {
+		return
+	}
+	matched, fallbacks := matcher.Stats()
+	log.Info("Map matching", zap.Int64("matched_segments", matched), zap.Int64("fallback_segments", fallbacks))
+}
+
+// jobID returns the configured ID of the job, or a new one for this run
+func jobID(cfg config.JobConfig) string {
+	if cfg.ID != "" {
+		return cfg.ID
+	}
+	return fmt.Sprintf("hermes-%d", time.Now().Unix())
 }
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/hermes/config"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input/csv"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input/ndjson"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input/parquet"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// newDeliveryReader creates the reader of the input files, based on the configured input format
+// it returns nil if reading files is disabled
+func newDeliveryReader(cfg *config.Config, log *zap.Logger) (input.DeliveryReader, error) {
+	reader, err := newFormatReader(cfg, log)
+	if err != nil || reader == nil {
+		return reader, err
+	}
+
+	if cfg.Grouping.Enabled {
+		log.Info("Grouping interleaved delivery points",
+			zap.Int("max_buffered_points", cfg.Grouping.MaxBufferedPoints),
+			zap.String("spill_dir", cfg.Grouping.SpillDir))
+		reader = input.NewGroupingReader(reader, cfg.Grouping.MaxBufferedPoints, cfg.Grouping.SpillDir)
+	}
+	return reader, nil
+}
+
+// newFormatReader creates the reader matching the configured input format
+func newFormatReader(cfg *config.Config, log *zap.Logger) (input.DeliveryReader, error) {
+	switch format := strings.ToLower(cfg.Input.Format); format {
+	case "none":
+		return nil, nil
+	case "", "csv":
+		return newCSVReader(cfg.CSV, log)
+	case "ndjson", "jsonl":
+		return newNDJSONReader(cfg.NDJSON, log)
+	case "parquet":
+		return newParquetReader(cfg.Parquet, log)
+	default:
+		return nil, fmt.Errorf("unsupported input format %q", cfg.Input.Format)
+	}
+}
+
+// newCSVReader creates a reader over all the CSV files, after checking their headers
+func newCSVReader(cfg config.CSVConfig, log *zap.Logger) (input.DeliveryReader, error) {
+	paths, err := input.ResolvePaths(cfg.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Input files resolved", zap.String("format", "csv"), zap.Strings("files", paths))
+
+	schema, err := newCSVSchema(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		if err := csv.CheckHeader(path, schema); err != nil {
+			return nil, err
+		}
+	}
+
+	return input.NewMultiReader(paths, cfg.ParallelFiles, func(path string) input.DeliveryReader {
+		if cfg.ParallelRanges > 1 {
+			return csv.NewParallelReader(path, schema, cfg.ParallelRanges, cfg.RangeSize, cfg.ProgressInterval)
+		}
+		return csv.NewDeliveryReader(path, schema, cfg.ProgressInterval)
+	}), nil
+}
+
+// newCSVSchema creates the schema of the CSV inputs from its config
+func newCSVSchema(cfg config.CSVConfig) (csv.Schema, error) {
+	schema, err := csv.NewSchema(cfg.Delimiter, cfg.Header, inputColumns(cfg.Columns))
+	if err != nil {
+		return schema, fmt.Errorf("invalid CSV schema config: %v", err)
+	}
+	return schema, nil
+}
+
+// newNDJSONReader creates a reader over all the JSON Lines files
+func newNDJSONReader(cfg config.NDJSONConfig, log *zap.Logger) (input.DeliveryReader, error) {
+	paths, err := input.ResolvePaths(cfg.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Input files resolved", zap.String("format", "ndjson"), zap.Strings("files", paths))
+
+	return input.NewMultiReader(paths, cfg.ParallelFiles, func(path string) input.DeliveryReader {
+		return ndjson.NewDeliveryReader(path, cfg.ProgressInterval)
+	}), nil
+}
+
+// newParquetReader creates a reader over all the Parquet files
+func newParquetReader(cfg config.ParquetConfig, log *zap.Logger) (input.DeliveryReader, error) {
+	paths, err := input.ResolvePaths(cfg.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Input files resolved", zap.String("format", "parquet"), zap.Strings("files", paths))
+
+	columns := inputColumns(cfg.Columns)
+	return input.NewMultiReader(paths, cfg.ParallelFiles, func(path string) input.DeliveryReader {
+		return parquet.NewDeliveryReader(path, columns, cfg.BatchSize)
+	}), nil
+}
+
+// inputColumns converts the configured column names to input.Columns
+func inputColumns(cfg config.ColumnsConfig) input.Columns {
+	return input.Columns{
+		DeliveryID: cfg.DeliveryID,
+		Latitude:   cfg.Latitude,
+		Longitude:  cfg.Longitude,
+		Timestamp:  cfg.Timestamp,
+		Accuracy:   cfg.Accuracy,
+		Speed:      cfg.Speed,
+		Bearing:    cfg.Bearing,
+		Provider:   cfg.Provider,
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/spf13/viper"
 	"log"
+	"time"
 )
 
 // RabbitMQConfig holds RabbitMQ connection details
@@ -13,15 +14,236 @@ type RabbitMQConfig struct {
 	Queue string `mapstructure:"queue" json:"queue"`
 }
 
-// CSVConfig holds CSV file config
+// ColumnsConfig holds the names of the columns read from the input files, the columns of the quality
+// of the fix (accuracy, speed, bearing and provider) are optional
+type ColumnsConfig struct {
+	DeliveryID string `mapstructure:"delivery_id" json:"delivery_id"`
+	Latitude   string `mapstructure:"latitude" json:"latitude"`
+	Longitude  string `mapstructure:"longitude" json:"longitude"`
+	Timestamp  string `mapstructure:"timestamp" json:"timestamp"`
+	Accuracy   string `mapstructure:"accuracy" json:"accuracy"`
+	Speed      string `mapstructure:"speed" json:"speed"`
+	Bearing    string `mapstructure:"bearing" json:"bearing"`
+	Provider   string `mapstructure:"provider" json:"provider"`
+}
+
+// CSVConfig holds CSV file config, the file may be compressed with gzip or bzip2
+// FilePath may also be a directory or a glob pattern to read several chunks in one run
+// a plain file is parsed by ParallelRanges goroutines when it is more than 1, each reading ranges of about RangeSize bytes
 type CSVConfig struct {
+	FilePath         string        `mapstructure:"file_path" json:"file_path"`
+	ProgressInterval int           `mapstructure:"progress_interval" json:"progress_interval"`
+	ParallelFiles    int           `mapstructure:"parallel_files" json:"parallel_files"`
+	ParallelRanges   int           `mapstructure:"parallel_ranges" json:"parallel_ranges"`
+	RangeSize        int64         `mapstructure:"range_size" json:"range_size"`
+	Delimiter        string        `mapstructure:"delimiter" json:"delimiter"`
+	Header           string        `mapstructure:"header" json:"header"`
+	Columns          ColumnsConfig `mapstructure:"columns" json:"columns"`
+}
+
+// NDJSONConfig holds JSON Lines file config, with the same file options as CSVConfig
+type NDJSONConfig struct {
+	FilePath         string `mapstructure:"file_path" json:"file_path"`
+	ProgressInterval int    `mapstructure:"progress_interval" json:"progress_interval"`
+	ParallelFiles    int    `mapstructure:"parallel_files" json:"parallel_files"`
+}
+
+// ParquetConfig holds Apache Parquet file config, files are read in batches of BatchSize rows
+type ParquetConfig struct {
+	FilePath      string        `mapstructure:"file_path" json:"file_path"`
+	ParallelFiles int           `mapstructure:"parallel_files" json:"parallel_files"`
+	BatchSize     int           `mapstructure:"batch_size" json:"batch_size"`
+	Columns       ColumnsConfig `mapstructure:"columns" json:"columns"`
+}
+
+// InputConfig selects the format of the input files, which is configured in its own section
+// the format "none" disables reading files, e.g. when Hermes only serves the HTTP endpoint
+type InputConfig struct {
+	Format string `mapstructure:"format" json:"format"`
+}
+
+// GroupingConfig holds the config of the grouping stage, for inputs where the points of deliveries are interleaved
+// at most MaxBufferedPoints points are kept in memory, the rest are spilled to files in SpillDir
+type GroupingConfig struct {
+	Enabled           bool   `mapstructure:"enabled" json:"enabled"`
+	MaxBufferedPoints int    `mapstructure:"max_buffered_points" json:"max_buffered_points"`
+	SpillDir          string `mapstructure:"spill_dir" json:"spill_dir"`
+}
+
+// CheckpointConfig holds the config of checkpointing the progress of a run to StateFile, so a restarted run resumes where it stopped
+type CheckpointConfig struct {
+	Enabled      bool          `mapstructure:"enabled" json:"enabled"`
+	StateFile    string        `mapstructure:"state_file" json:"state_file"`
+	SaveInterval time.Duration `mapstructure:"save_interval" json:"save_interval"`
+}
+
+// QuarantineConfig holds the path of the CSV file the rejected rows are written to, rows are only counted if it is empty
+type QuarantineConfig struct {
 	FilePath string `mapstructure:"file_path" json:"file_path"`
 }
 
+// FilterConfig selects the strategy cleaning the GPS noise of the deliveries (drop_current by default,
+// drop_previous_on_spike, rolling_median or kalman) and holds its parameters
+type FilterConfig struct {
+	Strategy         string  `mapstructure:"strategy" json:"strategy"`
+	Window           int     `mapstructure:"window" json:"window"`
+	ProcessNoise     float64 `mapstructure:"process_noise" json:"process_noise"`
+	MeasurementNoise float64 `mapstructure:"measurement_noise" json:"measurement_noise"`
+}
+
+// DistanceConfig selects the model measuring the distances of the segments: haversine (by default), vincenty or equirectangular
+type DistanceConfig struct {
+	Model string `mapstructure:"model" json:"model"`
+}
+
+// StopDetectionConfig enables classifying the segments as idle or moving by the stops of the couriers, instead of the
+// 10 km/h speed cut of Atalanta. a stop is at least MinDwell (1 minute by default) of consecutive points within Radius m
+// (30 by default) of the first of them
+type StopDetectionConfig struct {
+	Enabled  bool          `mapstructure:"enabled" json:"enabled"`
+	Radius   float64       `mapstructure:"radius" json:"radius"`
+	MinDwell time.Duration `mapstructure:"min_dwell" json:"min_dwell"`
+}
+
+// MapMatchingConfig holds the OSM extract (a .pbf or an .osm file) the segments are measured on: their points are
+// snapped to the roads, and their distance is the road distance between them. an empty RoadNetwork disables it.
+// SnapRadius is in m, zero values fall back to 30 m and a MaxDetour of 3
+type MapMatchingConfig struct {
+	RoadNetwork string  `mapstructure:"road_network" json:"road_network"`
+	SnapRadius  float64 `mapstructure:"snap_radius" json:"snap_radius"`
+	MaxDetour   float64 `mapstructure:"max_detour" json:"max_detour"`
+}
+
+// SimplificationConfig selects the algorithm simplifying the traces before their segments are built (douglas_peucker
+// by default, or visvalingam) and its tolerance in m, a zero tolerance does not simplify. the dry run report compares
+// the fares and the payload sizes of the deliveries at each of ReportTolerances (1, 2, 5, 10, 20 and 50 m by default)
+type SimplificationConfig struct {
+	Algorithm        string    `mapstructure:"algorithm" json:"algorithm"`
+	Tolerance        float64   `mapstructure:"tolerance" json:"tolerance"`
+	ReportTolerances []float64 `mapstructure:"report_tolerances" json:"report_tolerances"`
+}
+
+// DefaultAtalantaConfig is the path of the config file of Atalanta, when no path is configured
+const DefaultAtalantaConfig = "./config/atalanta_config.yaml"
+
+// FareRulesConfig holds the path of the config file of Atalanta, whose rates the dry run estimates the fares at,
+// so the rates are not copied into the config of Hermes
+type FareRulesConfig struct {
+	AtalantaConfig string `mapstructure:"atalanta_config" json:"atalanta_config"`
+}
+
+// AtalantaFareRulesConfig holds the rates of the fare_rules section of the config of Atalanta
+type AtalantaFareRulesConfig struct {
+	MinFare              float64 `mapstructure:"min_fare" json:"min_fare"`
+	FlagAmount           float64 `mapstructure:"flag_amount" json:"flag_amount"`
+	IdleFarePerHour      float64 `mapstructure:"idle_fare_per_hour" json:"idle_fare_per_hour"`
+	MovingDayFarePerKm   float64 `mapstructure:"moving_day_fare_per_km" json:"moving_day_fare_per_km"`
+	MovingNightFarePerKm float64 `mapstructure:"moving_night_fare_per_km" json:"moving_night_fare_per_km"`
+}
+
+// AtalantaTimeBoundariesConfig holds the hours (UTC) of the day rate of the time_boundaries section of the config of Atalanta
+type AtalantaTimeBoundariesConfig struct {
+	DayStartHour int `mapstructure:"day_start_hour" json:"day_start_hour"`
+	DayEndHour   int `mapstructure:"day_end_hour" json:"day_end_hour"`
+}
+
+// AtalantaConfig is the part of the config of Atalanta the fares are calculated with
+type AtalantaConfig struct {
+	FareRules      AtalantaFareRulesConfig      `mapstructure:"fare_rules" json:"fare_rules"`
+	TimeBoundaries AtalantaTimeBoundariesConfig `mapstructure:"time_boundaries" json:"time_boundaries"`
+}
+
+// BoundingBoxConfig holds the bounds of a rectangular area, in degrees
+type BoundingBoxConfig struct {
+	MinLatitude  float64 `mapstructure:"min_latitude" json:"min_latitude"`
+	MaxLatitude  float64 `mapstructure:"max_latitude" json:"max_latitude"`
+	MinLongitude float64 `mapstructure:"min_longitude" json:"min_longitude"`
+	MaxLongitude float64 `mapstructure:"max_longitude" json:"max_longitude"`
+}
+
+// ValidationConfig holds the rules the segments are checked against, a zero value disables its rule
+// except MaxSpeed (km/h), which defaults to 100. MaxHopDistance is in km and MaxAccuracy in m.
+// PreferDeviceSpeed classifies the segments as idle or moving by the speed reported by the devices, when they report it
+type ValidationConfig struct {
+	MaxSpeed          float64           `mapstructure:"max_speed" json:"max_speed"`
+	MaxTimeGap        time.Duration     `mapstructure:"max_time_gap" json:"max_time_gap"`
+	MaxHopDistance    float64           `mapstructure:"max_hop_distance" json:"max_hop_distance"`
+	ServiceArea       BoundingBoxConfig `mapstructure:"service_area" json:"service_area"`
+	MaxAccuracy       float64           `mapstructure:"max_accuracy" json:"max_accuracy"`
+	PreferDeviceSpeed bool              `mapstructure:"prefer_device_speed" json:"prefer_device_speed"`
+}
+
+// HTTPConfig holds the config of the HTTP ingestion endpoint
+type HTTPConfig struct {
+	Enabled bool   `mapstructure:"enabled" json:"enabled"`
+	Address string `mapstructure:"address" json:"address"`
+	// MaxBodySize is the largest body of a request, in bytes
+	MaxBodySize int64 `mapstructure:"max_body_size" json:"max_body_size"`
+}
+
+// GRPCConfig holds the config of the gRPC ingestion service
+type GRPCConfig struct {
+	Enabled bool   `mapstructure:"enabled" json:"enabled"`
+	Address string `mapstructure:"address" json:"address"`
+}
+
+// JobConfig holds the ID of the job sent in the completion message once the input files are published,
+// a new ID is generated for each run if it is empty
+type JobConfig struct {
+	ID string `mapstructure:"id" json:"id"`
+}
+
+// PublishConfig holds the config of the publishing workers, each with its own RabbitMQ channel,
+// and the number of deliveries queued for them. zero values fall back to 4 workers and a queue of 100
+type PublishConfig struct {
+	Workers   int `mapstructure:"workers" json:"workers"`
+	QueueSize int `mapstructure:"queue_size" json:"queue_size"`
+}
+
+// RateLimitConfig holds the token-bucket limits of the deliveries published, shared by all the publishing workers.
+// a zero rate is not limited. the achieved rate and the time spent throttled are logged every ReportInterval
+type RateLimitConfig struct {
+	MessagesPerSecond float64       `mapstructure:"messages_per_second" json:"messages_per_second"`
+	BytesPerSecond    float64       `mapstructure:"bytes_per_second" json:"bytes_per_second"`
+	ReportInterval    time.Duration `mapstructure:"report_interval" json:"report_interval"`
+}
+
+// SplitConfig holds the number of segments above which a delivery is split into parts, a zero value does not split deliveries
+type SplitConfig struct {
+	MaxSegments int `mapstructure:"max_segments" json:"max_segments"`
+}
+
+// DedupConfig enables skipping the deliveries of the input files already published, by this run or the previous ones.
+// the published delivery IDs are kept in PublishedFile. exact duplicate points are always dropped
+type DedupConfig struct {
+	SkipPublished bool   `mapstructure:"skip_published" json:"skip_published"`
+	PublishedFile string `mapstructure:"published_file" json:"published_file"`
+}
+
 // Config is the config structure of the Hermes service
 type Config struct {
-	RabbitMQ RabbitMQConfig `mapstructure:"rabbitmq" json:"rabbitmq"`
-	CSV      CSVConfig      `mapstructure:"csv" json:"csv"`
+	RabbitMQ       RabbitMQConfig       `mapstructure:"rabbitmq" json:"rabbitmq"`
+	Job            JobConfig            `mapstructure:"job" json:"job"`
+	Publish        PublishConfig        `mapstructure:"publish" json:"publish"`
+	RateLimit      RateLimitConfig      `mapstructure:"rate_limit" json:"rate_limit"`
+	Split          SplitConfig          `mapstructure:"split" json:"split"`
+	Input          InputConfig          `mapstructure:"input" json:"input"`
+	CSV            CSVConfig            `mapstructure:"csv" json:"csv"`
+	NDJSON         NDJSONConfig         `mapstructure:"ndjson" json:"ndjson"`
+	Parquet        ParquetConfig        `mapstructure:"parquet" json:"parquet"`
+	Grouping       GroupingConfig       `mapstructure:"grouping" json:"grouping"`
+	Filter         FilterConfig         `mapstructure:"filter" json:"filter"`
+	Simplification SimplificationConfig `mapstructure:"simplification" json:"simplification"`
+	FareRules      FareRulesConfig      `mapstructure:"fare_rules" json:"fare_rules"`
+	StopDetection  StopDetectionConfig  `mapstructure:"stop_detection" json:"stop_detection"`
+	Validation     ValidationConfig     `mapstructure:"validation" json:"validation"`
+	Distance       DistanceConfig       `mapstructure:"distance" json:"distance"`
+	MapMatching    MapMatchingConfig    `mapstructure:"map_matching" json:"map_matching"`
+	Checkpoint     CheckpointConfig     `mapstructure:"checkpoint" json:"checkpoint"`
+	Dedup          DedupConfig          `mapstructure:"dedup" json:"dedup"`
+	Quarantine     QuarantineConfig     `mapstructure:"quarantine" json:"quarantine"`
+	HTTP           HTTPConfig           `mapstructure:"http" json:"http"`
+	GRPC           GRPCConfig           `mapstructure:"grpc" json:"grpc"`
 }
 
 // LoadConfig initializes Viper and loads the configuration from the yaml
@@ -47,6 +269,24 @@ func LoadConfig() (*Config, error) {
 	return config, nil
 }
 
+// LoadAtalantaConfig loads the fare rules of the config file of Atalanta, DefaultAtalantaConfig if filePath is empty
+func LoadAtalantaConfig(filePath string) (*AtalantaConfig, error) {
+	if filePath == "" {
+		filePath = DefaultAtalantaConfig
+	}
+	v := viper.New()
+	v.SetConfigFile(filePath)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read Atalanta config %s: %v", filePath, err)
+	}
+
+	config := &AtalantaConfig{}
+	if err := v.Unmarshal(config); err != nil {
+		return nil, fmt.Errorf("unable to decode Atalanta config %s: %v", filePath, err)
+	}
+	return config, nil
+}
+
 // logConfig prints out all the config values (for debugging)
 func logConfig(config *Config) {
 	conf, err := json.MarshalIndent(config, "", "\t")
@@ -6,19 +6,33 @@ toolchain go1.23.1
 
 require (
 	github.com/aref81/snappbox_fare_estimator/shared/broker v0.0.0-20241002142244-45718bae8f9f
+	github.com/aref81/snappbox_fare_estimator/shared/distance v0.0.0
 	github.com/aref81/snappbox_fare_estimator/shared/logger v0.0.0-20240927113355-79e1652ebead
 	github.com/aref81/snappbox_fare_estimator/shared/models v0.0.0-20240927113355-79e1652ebead
+	github.com/parquet-go/parquet-go v0.25.1
+	github.com/paulmach/osm v0.8.0
 	github.com/spf13/viper v1.19.0
+	github.com/stretchr/testify v1.9.0
 	go.uber.org/zap v1.27.0
+	google.golang.org/grpc v1.67.1
+	google.golang.org/protobuf v1.35.1
 )
 
 require (
-	github.com/aref81/snappbox_fare_estimator v0.0.0-20240926212217-4931ec870fc2 // indirect
+	github.com/andybalholm/brotli v1.1.0 // indirect
+	github.com/datadog/czlib v0.0.0-20160811164712-4bc9a24e37f2 // indirect
+	github.com/davecgh/go-spew v1.1.2-0.20180830191138-d8f796af33cc // indirect
 	github.com/fsnotify/fsnotify v1.7.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
 	github.com/hashicorp/hcl v1.0.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
 	github.com/magiconair/properties v1.8.7 // indirect
 	github.com/mitchellh/mapstructure v1.5.0 // indirect
+	github.com/paulmach/orb v0.1.3 // indirect
+	github.com/paulmach/protoscan v0.2.1 // indirect
 	github.com/pelletier/go-toml/v2 v2.2.2 // indirect
+	github.com/pierrec/lz4/v4 v4.1.21 // indirect
+	github.com/pmezard/go-difflib v1.0.1-0.20181226105442-5d4384ee4fb2 // indirect
 	github.com/sagikazarmark/locafero v0.4.0 // indirect
 	github.com/sagikazarmark/slog-shim v0.1.0 // indirect
 	github.com/sourcegraph/conc v0.3.0 // indirect
@@ -29,8 +43,16 @@ require (
 	github.com/subosito/gotenv v1.6.0 // indirect
 	go.uber.org/multierr v1.10.0 // indirect
 	golang.org/x/exp v0.0.0-20230905200255-921286631fa9 // indirect
-	golang.org/x/sys v0.18.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
+	golang.org/x/net v0.28.0 // indirect
+	golang.org/x/sys v0.24.0 // indirect
+	golang.org/x/text v0.17.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/aref81/snappbox_fare_estimator/shared/models => ../shared/models
+
+replace github.com/aref81/snappbox_fare_estimator/shared/broker => ../shared/broker
+
+replace github.com/aref81/snappbox_fare_estimator/shared/distance => ../shared/distance
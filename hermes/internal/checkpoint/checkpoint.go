@@ -0,0 +1,241 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultStateFile is the path of the state file, when no path is configured
+const DefaultStateFile = "./state/hermes_checkpoint.json"
+
+// DefaultSaveInterval is the minimum time between two saves of the state file, when no interval is configured
+const DefaultSaveInterval = time.Second
+
+// State is the progress of an ingestion run, as saved in the state file.
+// all the deliveries read before the position (File, Offset) are published, the last of them being LastDeliveryID
+type State struct {
+	File           string    `json:"file"`
+	Offset         int64     `json:"offset"`
+	Line           int64     `json:"line"`
+	LastDeliveryID int       `json:"last_delivery_id"`
+	Deliveries     int64     `json:"deliveries"`
+	Completed      bool      `json:"completed"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Origin returns the position to resume the input from
+func (s *State) Origin() models.PointOrigin {
+	return models.PointOrigin{
+		Source: s.File,
+		Line:   s.Line,
+		Offset: s.Offset,
+	}
+}
+
+// Load reads the state file, it returns nil if there is no state file
+func Load(path string) (*State, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read state file: %v", err)
+	}
+
+	state := &State{}
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("failed to decode state file %s: %v", path, err)
+	}
+	return state, nil
+}
+
+// Save writes the state file atomically, so a crash while saving never leaves a broken state file behind
+func Save(path string, state State) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+	content, err := json.MarshalIndent(state, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %v", err)
+	}
+
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return fmt.Errorf("failed to replace state file: %v", err)
+	}
+	return nil
+}
+
+// Remove deletes the state file, so the next run starts from the beginning
+func Remove(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove state file: %v", err)
+	}
+	return nil
+}
+
+// Tracker follows the deliveries of a run while they are published, and saves the position of the first delivery
+// which is not published yet. deliveries are published concurrently, so the position only moves past a delivery
+// once it and all the deliveries before it are published
+type Tracker struct {
+	path         string
+	saveInterval time.Duration
+	log          *zap.Logger
+
+	mutex     sync.Mutex
+	state     State
+	next      int64
+	watermark int64
+	pending   map[int64]*trackedDelivery
+	inputDone bool
+	lastSave  time.Time
+}
+
+// trackedDelivery is a delivery which is read, but not all the deliveries up to it are published yet
+type trackedDelivery struct {
+	id     int
+	origin *models.PointOrigin
+	done   bool
+	// skipped is set for a delivery published by a previous job, which is not counted
+	skipped bool
+}
+
+// NewTracker creates a new Tracker saving to the state file at most once every saveInterval.
+// the counts of the resumed state, if any, are carried over
+func NewTracker(path string, saveInterval time.Duration, resumed *State, log *zap.Logger) *Tracker {
+	if saveInterval <= 0 {
+		saveInterval = DefaultSaveInterval
+	}
+	t := &Tracker{
+		path:         path,
+		saveInterval: saveInterval,
+		log:          log,
+		pending:      make(map[int64]*trackedDelivery),
+		lastSave:     time.Now(),
+	}
+	if resumed != nil {
+		t.state = *resumed
+	}
+	return t
+}
+
+// Begin records a new delivery, starting at the origin of its first point, and returns its ticket
+func (t *Tracker) Begin(deliveryID int, origin *models.PointOrigin) int64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	ticket := t.next
+	t.next++
+	t.pending[ticket] = &trackedDelivery{id: deliveryID, origin: origin}
+
+	// all the deliveries before it are published, so the run can be resumed from this delivery
+	if ticket == t.watermark {
+		t.moveTo(origin)
+	}
+	return ticket
+}
+
+// Done records the delivery of the ticket as published
+func (t *Tracker) Done(ticket int64) {
+	t.finish(ticket, false)
+}
+
+// Skip records the delivery of the ticket as skipped, the position moves past it but it is not counted in Deliveries
+func (t *Tracker) Skip(ticket int64) {
+	t.finish(ticket, true)
+}
+
+// finish records the delivery of the ticket as done, and moves the position past all the deliveries done in order
+func (t *Tracker) finish(ticket int64, skipped bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delivery, ok := t.pending[ticket]
+	if !ok {
+		return
+	}
+	delivery.done = true
+	delivery.skipped = skipped
+
+	advanced := false
+	for {
+		delivery, ok := t.pending[t.watermark]
+		if !ok || !delivery.done {
+			break
+		}
+		delete(t.pending, t.watermark)
+		t.watermark++
+		t.state.LastDeliveryID = delivery.id
+		if !delivery.skipped {
+			t.state.Deliveries++
+		}
+		advanced = true
+
+		if next, ok := t.pending[t.watermark]; ok {
+			t.moveTo(next.origin)
+		}
+	}
+
+	if advanced {
+		t.checkCompleted()
+		if t.state.Completed || time.Since(t.lastSave) >= t.saveInterval {
+			t.save()
+		}
+	}
+}
+
+// Finish records that the whole input is read, the run is completed once all the deliveries are published
+func (t *Tracker) Finish() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.inputDone = true
+	t.checkCompleted()
+	t.save()
+}
+
+// State returns the current state of the run
+func (t *Tracker) State() State {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.state
+}
+
+// moveTo sets the position to resume from
+func (t *Tracker) moveTo(origin *models.PointOrigin) {
+	if origin == nil {
+		return
+	}
+	t.state.File = origin.Source
+	t.state.Offset = origin.Offset
+	t.state.Line = origin.Line
+}
+
+func (t *Tracker) checkCompleted() {
+	if t.inputDone && t.watermark == t.next && !t.state.Completed {
+		t.state.Completed = true
+		t.log.Info("Ingestion run completed",
+			zap.Int64("deliveries", t.state.Deliveries),
+			zap.Int("last_delivery_id", t.state.LastDeliveryID))
+	}
+}
+
+// save writes the state file, failures are logged and retried on the next save
+func (t *Tracker) save() {
+	t.state.UpdatedAt = time.Now()
+	if err := Save(t.path, t.state); err != nil {
+		t.log.Warn("Failed to save checkpoint", zap.String("state_file", t.path), zap.Error(err))
+		return
+	}
+	t.lastSave = time.Now()
+}
@@ -0,0 +1,89 @@
+package checkpoint
+
+import (
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad_Missing(t *testing.T) {
+	state, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+	assert.NoError(t, err)
+	assert.Nil(t, state, "a missing state file means a fresh run")
+}
+
+func TestTracker_OutOfOrderPublishing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "checkpoint.json")
+	tracker := NewTracker(path, 1, nil, zap.NewNop())
+
+	first := tracker.Begin(10, &models.PointOrigin{Source: "a.csv", Line: 2, Offset: 30})
+	second := tracker.Begin(11, &models.PointOrigin{Source: "a.csv", Line: 5, Offset: 90})
+	third := tracker.Begin(12, &models.PointOrigin{Source: "b.csv", Line: 2, Offset: 30})
+	assert.Equal(t, "a.csv", tracker.State().File)
+	assert.Equal(t, int64(30), tracker.State().Offset)
+
+	// the second delivery is published first, the position can not move past the first one yet
+	tracker.Done(second)
+	assert.Equal(t, int64(30), tracker.State().Offset)
+	assert.Equal(t, int64(0), tracker.State().Deliveries)
+
+	tracker.Done(first)
+	state := tracker.State()
+	assert.Equal(t, "b.csv", state.File)
+	assert.Equal(t, int64(30), state.Offset)
+	assert.Equal(t, int64(2), state.Line)
+	assert.Equal(t, 11, state.LastDeliveryID)
+	assert.Equal(t, int64(2), state.Deliveries)
+
+	saved, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, state.Offset, saved.Offset)
+	assert.Equal(t, state.LastDeliveryID, saved.LastDeliveryID)
+
+	tracker.Finish()
+	assert.False(t, tracker.State().Completed, "the run is not completed before all the deliveries are published")
+	tracker.Done(third)
+
+	saved, err = Load(path)
+	assert.NoError(t, err)
+	assert.True(t, saved.Completed)
+	assert.Equal(t, 12, saved.LastDeliveryID)
+	assert.Equal(t, int64(3), saved.Deliveries)
+}
+
+func TestTracker_Skip(t *testing.T) {
+	tracker := NewTracker(filepath.Join(t.TempDir(), "checkpoint.json"), 1, nil, zap.NewNop())
+
+	first := tracker.Begin(10, &models.PointOrigin{Source: "a.csv", Line: 2, Offset: 30})
+	second := tracker.Begin(11, &models.PointOrigin{Source: "a.csv", Line: 5, Offset: 90})
+	tracker.Skip(first)
+	tracker.Done(second)
+	tracker.Finish()
+
+	state := tracker.State()
+	assert.True(t, state.Completed)
+	assert.Equal(t, 11, state.LastDeliveryID)
+	assert.Equal(t, int64(1), state.Deliveries, "the skipped delivery should not be counted as published")
+}
+
+func TestTracker_Resumed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	resumed := &State{File: "a.csv", Offset: 90, Line: 5, LastDeliveryID: 10, Deliveries: 1}
+	tracker := NewTracker(path, 1, resumed, zap.NewNop())
+
+	ticket := tracker.Begin(11, &models.PointOrigin{Source: "a.csv", Line: 5, Offset: 90})
+	tracker.Done(ticket)
+	tracker.Finish()
+
+	saved, err := Load(path)
+	assert.NoError(t, err)
+	assert.True(t, saved.Completed)
+	assert.Equal(t, int64(2), saved.Deliveries, "the counts of the resumed run should be carried over")
+
+	assert.NoError(t, Remove(path))
+	saved, err = Load(path)
+	assert.NoError(t, err)
+	assert.Nil(t, saved)
+}
@@ -0,0 +1,103 @@
+package dedup
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// DefaultPublishedFile is the path of the file of the published delivery IDs, when no path is configured
+const DefaultPublishedFile = "./state/hermes_published_ids"
+
+// PublishedSet is the set of the delivery IDs already published, persisted to a file so it is kept across runs.
+// the file has one ID per line and is only appended to, so a crash loses at most the ID being written
+type PublishedSet struct {
+	FilePath string
+	mutex    sync.RWMutex
+	ids      map[int]struct{}
+	file     *os.File
+}
+
+// Open loads the IDs of the file, which is created if it does not exist
+func Open(filePath string) (*PublishedSet, error) {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create published IDs directory: %v", err)
+	}
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open published IDs file: %v", err)
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read published IDs file %s: %v", filePath, err)
+	}
+
+	set := &PublishedSet{
+		FilePath: filePath,
+		ids:      make(map[int]struct{}),
+		file:     file,
+	}
+	lines := bytes.Split(content, []byte("\n"))
+	// a last line without a newline was cut short by a crash, e.g. 1 of 15, it is not trusted and is removed from the
+	// file so it is not read as an ID by the next run
+	if last := lines[len(lines)-1]; len(last) > 0 {
+		if err := file.Truncate(int64(len(content) - len(last))); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to truncate published IDs file %s: %v", filePath, err)
+		}
+	}
+	for _, line := range lines[:len(lines)-1] {
+		id, err := strconv.Atoi(string(bytes.TrimSpace(line)))
+		if err != nil {
+			continue
+		}
+		set.ids[id] = struct{}{}
+	}
+	return set, nil
+}
+
+// Len returns the number of IDs in the set
+func (s *PublishedSet) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.ids)
+}
+
+// Contains tells whether the delivery ID is published
+func (s *PublishedSet) Contains(id int) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	_, ok := s.ids[id]
+	return ok
+}
+
+// Add adds the delivery ID to the set, and appends it to the file
+func (s *PublishedSet) Add(id int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.ids[id]; ok {
+		return nil
+	}
+	if _, err := s.file.WriteString(strconv.Itoa(id) + "\n"); err != nil {
+		return fmt.Errorf("failed to write published ID %d: %v", id, err)
+	}
+	s.ids[id] = struct{}{}
+	return nil
+}
+
+// Close closes the file
+func (s *PublishedSet) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close published IDs file: %v", err)
+	}
+	return nil
+}
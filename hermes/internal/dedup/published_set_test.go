@@ -0,0 +1,55 @@
+package dedup
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPublishedSet(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "state", "published_ids")
+
+	set, err := Open(filePath)
+	assert.NoError(t, err)
+	assert.Zero(t, set.Len())
+	assert.NoError(t, set.Add(12))
+	assert.NoError(t, set.Add(7))
+	assert.NoError(t, set.Add(12))
+	assert.True(t, set.Contains(12))
+	assert.False(t, set.Contains(1))
+	assert.NoError(t, set.Close())
+
+	content, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "12\n7\n", string(content), "an ID should only be written once")
+
+	reopened, err := Open(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, reopened.Len(), "the IDs should be kept across runs")
+	assert.True(t, reopened.Contains(7))
+	assert.NoError(t, reopened.Close())
+}
+
+func TestPublishedSet_CutShortLine(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "published_ids")
+	// the write of 15 was cut short by a crash
+	assert.NoError(t, os.WriteFile(filePath, []byte("12\n1"), 0644))
+
+	set, err := Open(filePath)
+	assert.NoError(t, err)
+	assert.True(t, set.Contains(12))
+	assert.False(t, set.Contains(1), "a line cut short should not be trusted")
+	assert.NoError(t, set.Add(15))
+	assert.NoError(t, set.Close())
+
+	content, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "12\n15\n", string(content))
+
+	reopened, err := Open(filePath)
+	assert.NoError(t, err)
+	assert.True(t, reopened.Contains(15))
+	assert.False(t, reopened.Contains(1), "the line cut short should not be read again")
+	assert.NoError(t, reopened.Close())
+}
@@ -3,88 +3,307 @@ package processor
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input"
 	"github.com/aref81/snappbox_fare_estimator/shared/broker"
-	"github.com/aref81/snappbox_fare_estimator/shared/broker/rabbitMQ"
 	"github.com/aref81/snappbox_fare_estimator/shared/models"
 	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Processor struct {
-	publisher broker.Publisher
-	log       *zap.Logger
+	publisher  broker.Publisher
+	pool       *PublishPool
+	split      int
+	filter     models.PointFilter
+	policy     *models.ValidationPolicy
+	stops      *models.StopDetector
+	tracker    ProgressTracker
+	published  PublishedSet
+	rejections input.RejectionSink
+	log        *zap.Logger
 }
 
-func NewDeliveryProcessor(rabbitMQPublisher *rabbitMQ.RabbitMQPublisher, log *zap.Logger) *Processor {
+// ProgressTracker is notified when a delivery is read and when it is published, e.g. to checkpoint the progress of a run
+type ProgressTracker interface {
+	// Begin records a new delivery starting at the origin of its first point, and returns a ticket for it
+	Begin(deliveryID int, origin *models.PointOrigin) int64
+	// Done records the delivery of the ticket as published
+	Done(ticket int64)
+	// Skip records the delivery of the ticket as skipped, as it was published before
+	Skip(ticket int64)
+}
+
+// PublishedSet is the set of the delivery IDs already published, e.g. by previous runs
+type PublishedSet interface {
+	Contains(id int) bool
+	Add(id int) error
+}
+
+// Stats holds the number of deliveries and points processed by a single ProcessDeliveries call
+// Published is the number of deliveries actually published, it is less than Deliveries if publishing some of them failed
+// or if some of them were skipped as already published (SkippedDeliveries)
+type Stats struct {
+	Deliveries        int64
+	Published         int64
+	SkippedDeliveries int64
+	Points            int64
+	DuplicatePoints   int64
+	RejectedPoints    int64
+}
+
+func NewDeliveryProcessor(publisher broker.Publisher, log *zap.Logger) *Processor {
 	return &Processor{
-		publisher: rabbitMQPublisher,
+		publisher: publisher,
+		filter:    models.DropCurrentFilter{},
+		policy:    models.NewValidationPolicy(models.ValidationRules{}),
 		log:       log,
 	}
 }
 
+// SetPointFilter sets the strategy cleaning the GPS noise of the deliveries, drop_current is used by default
+func (p *Processor) SetPointFilter(filter models.PointFilter) {
+	p.filter = filter
+}
+
+// SetValidationPolicy sets the rules the segments are checked against, only the default speed limit is checked otherwise
+func (p *Processor) SetValidationPolicy(policy *models.ValidationPolicy) {
+	p.policy = policy
+}
+
+// SetStopDetector sets the stop detection classifying the segments as idle or moving, which Atalanta bills them by.
+// the segments have no status otherwise, and are billed by their speed
+func (p *Processor) SetStopDetector(detector *models.StopDetector) {
+	p.stops = detector
+}
+
+// SetPublishPool sets the pool the deliveries are published by, they are published one at a time
+// by the goroutine reading them otherwise. the publisher of the processor is then only used for the job completion
+func (p *Processor) SetPublishPool(pool *PublishPool) {
+	p.pool = pool
+}
+
+// SetMaxSegments splits the deliveries longer than maxSegments segments into parts, which are published in order
+// by the same worker. deliveries are not split when it is 0
+func (p *Processor) SetMaxSegments(maxSegments int) {
+	p.split = maxSegments
+}
+
+// SetTracker sets the tracker notified of the progress of the deliveries
+func (p *Processor) SetTracker(tracker ProgressTracker) {
+	p.tracker = tracker
+}
+
+// SetPublishedSet sets the set of the deliveries already published, which are skipped,
+// the deliveries published are added to it
+func (p *Processor) SetPublishedSet(published PublishedSet) {
+	p.published = published
+}
+
+// SetRejectionSink sets the sink of the points rejected while building segments
+func (p *Processor) SetRejectionSink(sink input.RejectionSink) {
+	p.rejections = sink
+}
+
 // ProcessDeliveries process all coming deliveries from a channel
-func (p *Processor) ProcessDeliveries(deliveryPointChan <-chan *models.DeliveryPoint) error {
-	var currentDelivery *models.Delivery
-	var previousPoint *models.DeliveryPoint
+// the points of a delivery are collected until its ID changes, then filtered and built into segments.
+// it returns once all the deliveries are published, or failed to be
+func (p *Processor) ProcessDeliveries(deliveryPointChan <-chan *models.DeliveryPoint) (Stats, error) {
+	var points []models.DeliveryPoint
+	var stats Stats
+	var ticket int64
+	var published atomic.Int64
+	wg := sync.WaitGroup{}
 	startTime := time.Now()
 
+	publish := func(points []models.DeliveryPoint, ticket int64) {
+		if p.published != nil && p.published.Contains(points[0].DeliveryID) {
+			stats.SkippedDeliveries++
+			if p.tracker != nil {
+				p.tracker.Skip(ticket)
+			}
+			return
+		}
+
+		points, duplicates := dropDuplicatePoints(points)
+		stats.DuplicatePoints += duplicates
+		delivery, rejected := p.buildDelivery(points)
+		stats.RejectedPoints += rejected
+		wg.Add(1)
+		job := func(publisher broker.Publisher) {
+			defer wg.Done()
+			if p.publishDelivery(publisher, delivery, ticket) == nil {
+				published.Add(1)
+			}
+		}
+		if p.pool == nil {
+			job(p.publisher)
+			return
+		}
+		p.pool.submit(job)
+	}
+
 	for point := range deliveryPointChan {
+		stats.Points++
 		// If processor ID changes, process the last processor and start a new one
-		if currentDelivery == nil || currentDelivery.ID != point.DeliveryID {
-			if currentDelivery != nil {
+		if len(points) == 0 || points[0].DeliveryID != point.DeliveryID {
+			if len(points) > 0 {
 				// process previous processor
-				go func(delivery *models.Delivery) {
-					err := p.processSingleDelivery(delivery)
-					if err != nil {
-						p.log.Warn("Failed to process processor",
-							zap.Int("delivery_id", delivery.ID),
-							zap.Error(err))
-					}
-				}(currentDelivery)
+				publish(points, ticket)
 			}
 			// Create new processor
-			currentDelivery = models.NewDelivery(point.DeliveryID)
-			previousPoint = nil
-		}
-		// in case of first point
-		if previousPoint != nil {
-			err := currentDelivery.AddSegment(*previousPoint, *point)
-			if err != nil {
-				// if the new point is invalid, we skip this point and reach to the next
-				p.log.Warn("Failed to add new processor segment", zap.Error(err))
-				continue
+			points = nil
+			stats.Deliveries++
+			if p.tracker != nil {
+				ticket = p.tracker.Begin(point.DeliveryID, point.Origin)
 			}
-			previousPoint = point
-		} else {
-			previousPoint = point
 		}
+		points = append(points, *point)
 	}
 
 	// Process the last Delivery
-	go func(delivery *models.Delivery) {
-		err := p.processSingleDelivery(currentDelivery)
+	if len(points) > 0 {
+		publish(points, ticket)
+	}
+	wg.Wait()
+	stats.Published = published.Load()
+
+	p.log.Info("All the delivery records sent from hermes successfully.",
+		zap.Int64("deliveries", stats.Deliveries),
+		zap.Int64("published", stats.Published),
+		zap.Int64("skipped_deliveries", stats.SkippedDeliveries),
+		zap.Int64("points", stats.Points),
+		zap.Int64("duplicate_points", stats.DuplicatePoints),
+		zap.Int64("rejected_points", stats.RejectedPoints),
+		zap.String("Duration", fmt.Sprintf("%s", time.Now().Sub(startTime))))
+	p.log.Info("Validation violations by rule", zap.Any("violations", p.policy.Violations()))
+	return stats, nil
+}
+
+// pointKey identifies a point of a delivery, points with the same key are exact duplicates
+type pointKey struct {
+	timestamp int64
+	latitude  float64
+	longitude float64
+}
+
+// dropDuplicatePoints removes the exact duplicates of the points of a delivery (same timestamp and coordinates),
+// keeping the first of them, and returns the number removed
+func dropDuplicatePoints(points []models.DeliveryPoint) ([]models.DeliveryPoint, int64) {
+	seen := make(map[pointKey]struct{}, len(points))
+	kept := points[:0]
+	for _, point := range points {
+		key := pointKey{timestamp: point.Timestamp, latitude: point.Latitude, longitude: point.Longitude}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		kept = append(kept, point)
+	}
+	return kept, int64(len(points) - len(kept))
+}
+
+// buildDelivery filters the points of a delivery and builds its segments, returning the number of points dropped.
+// the stops are detected on all the points, as the filters may smooth the jitter of a stop away
+func (p *Processor) buildDelivery(points []models.DeliveryPoint) (*models.Delivery, int64) {
+	delivery, dropped := models.BuildDelivery(points[0].DeliveryID, points, p.filter, p.policy)
+	for i := range dropped {
+		// the invalid points are skipped, the delivery is built from the rest
+		p.log.Warn("Failed to add new processor segment", zap.String("filter", p.filter.Name()), zap.Error(dropped[i].Err))
+		p.reject(&dropped[i].Point, dropped[i].Err)
+	}
+	if p.stops != nil {
+		p.stops.Classify(delivery, points)
+	}
+	return delivery, int64(len(dropped))
+}
+
+// PublishJobCompletion publishes the control message ending a job, once all of its deliveries are published
+func (p *Processor) PublishJobCompletion(jobID string, deliveries int64) error {
+	completion := models.NewJobCompletion(jobID, deliveries, time.Now().Unix())
+	completionBytes, err := json.Marshal(completion)
+	if err != nil {
+		p.log.Error("Failed to serialize job completion", zap.String("job_id", jobID), zap.Error(err))
+		return err
+	}
+
+	err = p.publisher.PublishMessage(context.Background(), completionBytes)
+	if err != nil {
+		p.log.Error("Failed to publish job completion to RabbitMQ", zap.String("job_id", jobID), zap.Error(err))
+		return err
+	}
+
+	p.log.Info("Job completion published", zap.String("job_id", jobID), zap.Int64("deliveries", deliveries))
+	return nil
+}
+
+// reject reports a point rejected while building segments to the rejection sink
+func (p *Processor) reject(point *models.DeliveryPoint, err error) {
+	if p.rejections == nil {
+		return
+	}
+
+	reason := input.ReasonInvalidSegment
+	switch {
+	case errors.Is(err, models.ErrZeroTimeDifference):
+		reason = input.ReasonZeroTimeDifference
+	case errors.Is(err, models.ErrSpeedLimitExceeded):
+		reason = input.ReasonSpeedLimitExceeded
+	case errors.Is(err, models.ErrTimeGapExceeded):
+		reason = input.ReasonTimeGapExceeded
+	case errors.Is(err, models.ErrHopDistanceExceeded):
+		reason = input.ReasonHopDistanceExceeded
+	case errors.Is(err, models.ErrOutsideServiceArea):
+		reason = input.ReasonOutsideServiceArea
+	case errors.Is(err, models.ErrAccuracyExceeded):
+		reason = input.ReasonAccuracyExceeded
+	}
+
+	rejection := input.Rejection{Reason: reason, Detail: err.Error()}
+	if point.Origin != nil {
+		rejection.Source = point.Origin.Source
+		rejection.Line = point.Origin.Line
+		rejection.Row = point.Origin.Raw
+	}
+	p.rejections.Reject(rejection)
+}
+
+// publishDelivery processes the delivery (or each of its parts) with the publisher, and notifies the tracker once it is published
+func (p *Processor) publishDelivery(publisher broker.Publisher, delivery *models.Delivery, ticket int64) error {
+	for _, part := range delivery.Split(p.split) {
+		err := p.processSingleDelivery(publisher, part)
 		if err != nil {
 			p.log.Warn("Failed to process processor",
 				zap.Int("delivery_id", delivery.ID),
+				zap.Int("part", part.Part),
 				zap.Error(err))
+			return err
 		}
-	}(currentDelivery)
-
-	p.log.Info("All the delivery records sent from hermes successfully.",
-		zap.String("Duration", fmt.Sprintf("%s", time.Now().Sub(startTime))))
+	}
+	if p.published != nil {
+		if err := p.published.Add(delivery.ID); err != nil {
+			// the delivery is published anyway, it is only published again if its input is read again
+			p.log.Warn("Failed to record published delivery", zap.Int("delivery_id", delivery.ID), zap.Error(err))
+		}
+	}
+	if p.tracker != nil {
+		p.tracker.Done(ticket)
+	}
 	return nil
 }
 
 // processSingleDelivery processes a processor, including validation and pushing
-func (p *Processor) processSingleDelivery(delivery *models.Delivery) error {
+func (p *Processor) processSingleDelivery(publisher broker.Publisher, delivery *models.Delivery) error {
 	deliveryBytes, err := json.Marshal(delivery)
 	if err != nil {
 		p.log.Error("Failed to serialize processor", zap.Int("delivery_id", delivery.ID), zap.Error(err))
 		return err
 	}
 
-	err = p.publisher.PublishMessage(context.Background(), deliveryBytes)
+	err = publisher.PublishMessage(context.Background(), deliveryBytes)
 	if err != nil {
 		p.log.Error("Failed to publish processor to RabbitMQ", zap.Int("delivery_id", delivery.ID), zap.Error(err))
 		return err
@@ -0,0 +1,339 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/aref81/snappbox_fare_estimator/hermes/internal/checkpoint"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input"
+	"github.com/aref81/snappbox_fare_estimator/shared/broker"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// discardPublisher drops all the messages published to it
+type discardPublisher struct{}
+
+func (discardPublisher) PublishMessage(ctx context.Context, body []byte) error {
+	return nil
+}
+
+// recordingPublisher keeps the messages published to it, and fails the messages containing failOn
+type recordingPublisher struct {
+	mutex    sync.Mutex
+	messages [][]byte
+	failOn   string
+}
+
+func (p *recordingPublisher) PublishMessage(ctx context.Context, body []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.failOn != "" && strings.Contains(string(body), p.failOn) {
+		return errors.New("publish failed")
+	}
+	p.messages = append(p.messages, body)
+	return nil
+}
+
+// recordingSink keeps the rejections reported to it
+type recordingSink struct {
+	rejections []input.Rejection
+}
+
+func (s *recordingSink) Reject(rejection input.Rejection) {
+	s.rejections = append(s.rejections, rejection)
+}
+
+func TestProcessDeliveries_Rejections(t *testing.T) {
+	sink := &recordingSink{}
+	processor := NewDeliveryProcessor(discardPublisher{}, zap.NewNop())
+	processor.SetRejectionSink(sink)
+
+	pointChan := make(chan *models.DeliveryPoint, 10)
+	for i, point := range []models.DeliveryPoint{
+		{DeliveryID: 1, Latitude: 35.7000, Longitude: 51.4000, Timestamp: 1000},
+		{DeliveryID: 1, Latitude: 35.7010, Longitude: 51.4010, Timestamp: 1000}, // same timestamp
+		{DeliveryID: 1, Latitude: 36.7000, Longitude: 52.4000, Timestamp: 1200}, // speed spike
+		{DeliveryID: 1, Latitude: 35.7010, Longitude: 51.4010, Timestamp: 1300},
+	} {
+		point.Origin = &models.PointOrigin{Source: "a.csv", Line: int64(i + 2), Raw: "row"}
+		pointChan <- &point
+	}
+	close(pointChan)
+
+	stats, err := processor.ProcessDeliveries(pointChan)
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Deliveries: 1, Published: 1, Points: 4, RejectedPoints: 2}, stats)
+
+	assert.Len(t, sink.rejections, 2)
+	assert.Equal(t, input.ReasonZeroTimeDifference, sink.rejections[0].Reason)
+	assert.Equal(t, int64(3), sink.rejections[0].Line)
+	assert.Equal(t, input.ReasonSpeedLimitExceeded, sink.rejections[1].Reason)
+	assert.Equal(t, int64(4), sink.rejections[1].Line)
+	assert.Equal(t, "a.csv", sink.rejections[1].Source)
+	assert.Contains(t, sink.rejections[1].Detail, "speed =")
+}
+
+func TestProcessDeliveries_PointFilter(t *testing.T) {
+	sink := &recordingSink{}
+	processor := NewDeliveryProcessor(discardPublisher{}, zap.NewNop())
+	processor.SetRejectionSink(sink)
+	processor.SetPointFilter(models.DropPreviousOnSpikeFilter{})
+
+	pointChan := make(chan *models.DeliveryPoint, 10)
+	for i, point := range []models.DeliveryPoint{
+		{DeliveryID: 1, Latitude: 36.7000, Longitude: 52.4000, Timestamp: 1000}, // first point off the trace
+		{DeliveryID: 1, Latitude: 35.7000, Longitude: 51.4000, Timestamp: 1100},
+		{DeliveryID: 1, Latitude: 35.7010, Longitude: 51.4010, Timestamp: 1200},
+	} {
+		point.Origin = &models.PointOrigin{Source: "a.csv", Line: int64(i + 2)}
+		pointChan <- &point
+	}
+	close(pointChan)
+
+	stats, err := processor.ProcessDeliveries(pointChan)
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Deliveries: 1, Published: 1, Points: 3, RejectedPoints: 1}, stats)
+	assert.Len(t, sink.rejections, 1)
+	assert.Equal(t, int64(2), sink.rejections[0].Line, "the spike should be dropped rather than the rest of the trace")
+}
+
+func TestProcessDeliveries_ValidationPolicy(t *testing.T) {
+	sink := &recordingSink{}
+	processor := NewDeliveryProcessor(discardPublisher{}, zap.NewNop())
+	processor.SetRejectionSink(sink)
+	policy := models.NewValidationPolicy(models.ValidationRules{MaxHopDistance: 1})
+	processor.SetValidationPolicy(policy)
+
+	pointChan := make(chan *models.DeliveryPoint, 10)
+	for _, point := range []models.DeliveryPoint{
+		{DeliveryID: 1, Latitude: 35.7000, Longitude: 51.4000, Timestamp: 1000},
+		{DeliveryID: 1, Latitude: 35.7200, Longitude: 51.4000, Timestamp: 1300}, // about 2.2 km away
+		{DeliveryID: 1, Latitude: 35.7010, Longitude: 51.4000, Timestamp: 1400},
+	} {
+		pointChan <- &point
+	}
+	close(pointChan)
+
+	stats, err := processor.ProcessDeliveries(pointChan)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), stats.RejectedPoints)
+	assert.Len(t, sink.rejections, 1)
+	assert.Equal(t, input.ReasonHopDistanceExceeded, sink.rejections[0].Reason)
+	assert.Equal(t, int64(1), policy.Violations()[models.RuleMaxHopDistance])
+}
+
+func TestProcessDeliveries_MaxAccuracy(t *testing.T) {
+	sink := &recordingSink{}
+	processor := NewDeliveryProcessor(discardPublisher{}, zap.NewNop())
+	processor.SetRejectionSink(sink)
+	processor.SetValidationPolicy(models.NewValidationPolicy(models.ValidationRules{MaxAccuracy: 50}))
+
+	precise, coarse := 10.0, 500.0
+	pointChan := make(chan *models.DeliveryPoint, 10)
+	for _, point := range []models.DeliveryPoint{
+		{DeliveryID: 1, Latitude: 35.7000, Longitude: 51.4000, Timestamp: 1000, Accuracy: &precise},
+		{DeliveryID: 1, Latitude: 35.7030, Longitude: 51.4000, Timestamp: 1060, Accuracy: &coarse}, // a network fix
+		{DeliveryID: 1, Latitude: 35.7010, Longitude: 51.4000, Timestamp: 1120},
+	} {
+		pointChan <- &point
+	}
+	close(pointChan)
+
+	stats, err := processor.ProcessDeliveries(pointChan)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), stats.RejectedPoints)
+	assert.Len(t, sink.rejections, 1)
+	assert.Equal(t, input.ReasonAccuracyExceeded, sink.rejections[0].Reason)
+}
+
+func TestProcessDeliveries_JobCompletion(t *testing.T) {
+	publisher := &recordingPublisher{failOn: `"ID":2,`}
+	processor := NewDeliveryProcessor(publisher, zap.NewNop())
+
+	pointChan := make(chan *models.DeliveryPoint, 10)
+	for id := 1; id <= 3; id++ {
+		pointChan <- &models.DeliveryPoint{DeliveryID: id, Latitude: 35.7, Longitude: 51.4, Timestamp: 1000}
+	}
+	close(pointChan)
+
+	stats, err := processor.ProcessDeliveries(pointChan)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Deliveries)
+	assert.Equal(t, int64(2), stats.Published, "the delivery which failed to publish should not be counted")
+	assert.Len(t, publisher.messages, 2, "all the deliveries should be published when ProcessDeliveries returns")
+
+	assert.NoError(t, processor.PublishJobCompletion("job-1", stats.Published))
+	completion, ok := models.ParseJobCompletion(publisher.messages[2])
+	assert.True(t, ok, "the completion should be published after the deliveries")
+	assert.Equal(t, "job-1", completion.JobID)
+	assert.Equal(t, int64(2), completion.Deliveries)
+}
+
+// exclusivePublisher fails the test if it is used by two goroutines at once, like an amqp channel must not be
+type exclusivePublisher struct {
+	recordingPublisher
+	busy       atomic.Bool
+	concurrent atomic.Bool
+	closed     atomic.Bool
+}
+
+func (p *exclusivePublisher) Close() {
+	p.closed.Store(true)
+}
+
+func (p *exclusivePublisher) PublishMessage(ctx context.Context, body []byte) error {
+	if !p.busy.CompareAndSwap(false, true) {
+		p.concurrent.Store(true)
+	}
+	defer p.busy.Store(false)
+	time.Sleep(time.Millisecond)
+	return p.recordingPublisher.PublishMessage(ctx, body)
+}
+
+func TestProcessDeliveries_PublishPool(t *testing.T) {
+	workers := []*exclusivePublisher{{}, {}, {}}
+	publishers := make([]broker.Publisher, len(workers))
+	for i := range workers {
+		publishers[i] = workers[i]
+	}
+	pool := NewPublishPool(publishers, 2, zap.NewNop())
+
+	processor := NewDeliveryProcessor(discardPublisher{}, zap.NewNop())
+	processor.SetPublishPool(pool)
+
+	pointChan := make(chan *models.DeliveryPoint, 100)
+	for id := 1; id <= 50; id++ {
+		pointChan <- &models.DeliveryPoint{DeliveryID: id, Latitude: 35.7, Longitude: 51.4, Timestamp: 1000}
+	}
+	close(pointChan)
+
+	stats, err := processor.ProcessDeliveries(pointChan)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(50), stats.Published)
+
+	published := 0
+	for i, worker := range workers {
+		assert.False(t, worker.concurrent.Load(), "the publisher of worker %d should not be used concurrently", i)
+		published += len(worker.messages)
+	}
+	assert.Equal(t, 50, published, "all the deliveries should be published when ProcessDeliveries returns")
+
+	pool.Close()
+	for i, worker := range workers {
+		assert.True(t, worker.closed.Load(), "the publisher of worker %d should be closed with the pool", i)
+	}
+}
+
+func TestProcessDeliveries_Split(t *testing.T) {
+	publisher := &recordingPublisher{}
+	processor := NewDeliveryProcessor(publisher, zap.NewNop())
+	processor.SetMaxSegments(4)
+
+	pointChan := make(chan *models.DeliveryPoint, 20)
+	for i := 0; i < 11; i++ {
+		pointChan <- &models.DeliveryPoint{DeliveryID: 1, Latitude: 35.7 + float64(i)*0.001, Longitude: 51.4, Timestamp: int64(1000 + i*60)}
+	}
+	close(pointChan)
+
+	stats, err := processor.ProcessDeliveries(pointChan)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Published, "a split delivery should be counted once")
+	assert.Len(t, publisher.messages, 3)
+
+	for i, message := range publisher.messages {
+		var part models.Delivery
+		assert.NoError(t, json.Unmarshal(message, &part))
+		assert.Equal(t, i, part.Part, "the parts should be published in order")
+		assert.Equal(t, 3, part.Parts)
+	}
+}
+
+func TestProcessDeliveries_StopDetection(t *testing.T) {
+	publisher := &recordingPublisher{}
+	processor := NewDeliveryProcessor(publisher, zap.NewNop())
+	detector := models.NewStopDetector(0, 0, nil)
+	processor.SetStopDetector(&detector)
+
+	// the courier drives north for 3 minutes, then waits for 5 minutes with GPS jitter faster than the idle speed
+	pointChan := make(chan *models.DeliveryPoint, 100)
+	for i := 0; i <= 3; i++ {
+		pointChan <- &models.DeliveryPoint{DeliveryID: 1, Latitude: 35.7 + float64(i)*0.005, Longitude: 51.4, Timestamp: int64(1000 + i*60)}
+	}
+	for i := 1; i <= 60; i++ {
+		pointChan <- &models.DeliveryPoint{DeliveryID: 1, Latitude: 35.715 + float64(i%2)*0.0002, Longitude: 51.4, Timestamp: int64(1180 + i*5)}
+	}
+	close(pointChan)
+
+	_, err := processor.ProcessDeliveries(pointChan)
+	assert.NoError(t, err)
+	assert.Len(t, publisher.messages, 1)
+
+	var delivery models.Delivery
+	assert.NoError(t, json.Unmarshal(publisher.messages[0], &delivery))
+	assert.Len(t, delivery.Segments, 63)
+	for i, segment := range delivery.Segments {
+		if i < 3 {
+			assert.Equal(t, models.StatusMoving, segment.Status)
+			continue
+		}
+		assert.Greater(t, segment.Speed, models.IdleSpeed)
+		assert.Equal(t, models.StatusIdle, segment.Status, "the jitter of the stop should be idle")
+	}
+}
+
+// memorySet is a PublishedSet kept in memory
+type memorySet map[int]bool
+
+func (s memorySet) Contains(id int) bool {
+	return s[id]
+}
+
+func (s memorySet) Add(id int) error {
+	s[id] = true
+	return nil
+}
+
+func TestProcessDeliveries_Duplicates(t *testing.T) {
+	sink := &recordingSink{}
+	publisher := &recordingPublisher{}
+	processor := NewDeliveryProcessor(publisher, zap.NewNop())
+	processor.SetRejectionSink(sink)
+	published := memorySet{2: true}
+	processor.SetPublishedSet(published)
+	tracker := checkpoint.NewTracker(filepath.Join(t.TempDir(), "checkpoint.json"), 0, nil, zap.NewNop())
+	processor.SetTracker(tracker)
+
+	pointChan := make(chan *models.DeliveryPoint, 10)
+	for _, point := range []models.DeliveryPoint{
+		{DeliveryID: 1, Latitude: 35.7000, Longitude: 51.4000, Timestamp: 1000},
+		{DeliveryID: 1, Latitude: 35.7000, Longitude: 51.4000, Timestamp: 1000}, // duplicated ping
+		{DeliveryID: 1, Latitude: 35.7010, Longitude: 51.4010, Timestamp: 1060},
+		{DeliveryID: 1, Latitude: 35.7010, Longitude: 51.4010, Timestamp: 1060}, // duplicated ping
+		{DeliveryID: 2, Latitude: 35.7000, Longitude: 51.4000, Timestamp: 1000}, // published by a previous run
+		{DeliveryID: 2, Latitude: 35.7010, Longitude: 51.4010, Timestamp: 1060},
+	} {
+		pointChan <- &point
+	}
+	close(pointChan)
+
+	stats, err := processor.ProcessDeliveries(pointChan)
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Deliveries: 2, Published: 1, SkippedDeliveries: 1, Points: 6, DuplicatePoints: 2}, stats)
+	assert.Empty(t, sink.rejections, "duplicates should be dropped silently")
+	assert.Len(t, publisher.messages, 1)
+
+	var delivery models.Delivery
+	assert.NoError(t, json.Unmarshal(publisher.messages[0], &delivery))
+	assert.Equal(t, 1, delivery.ID)
+	assert.Len(t, delivery.Segments, 1)
+	assert.True(t, published.Contains(1), "the published delivery should be added to the set")
+	assert.Equal(t, stats.Published, tracker.State().Deliveries, "the skipped delivery should not be counted by the checkpoint")
+}
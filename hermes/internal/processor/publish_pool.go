@@ -0,0 +1,70 @@
+package processor
+
+import (
+	"github.com/aref81/snappbox_fare_estimator/shared/broker"
+	"go.uber.org/zap"
+	"sync"
+)
+
+const (
+	// DefaultPublishWorkers is the number of publishing workers, when no number is configured
+	DefaultPublishWorkers = 4
+	// DefaultPublishQueueSize is the number of deliveries waiting for a worker, when no size is configured
+	DefaultPublishQueueSize = 100
+)
+
+// closer is a publisher holding a resource, e.g. an amqp channel, released once its worker stops
+type closer interface {
+	Close()
+}
+
+// publishJob publishes a delivery with the publisher of the worker running it
+type publishJob func(publisher broker.Publisher)
+
+// PublishPool publishes deliveries with a fixed number of workers. each worker owns its publisher,
+// so a publisher (e.g. an amqp channel) is never used by two goroutines at once, and is closed by the pool.
+// jobs wait in a bounded queue, and Submit blocks while the queue is full
+type PublishPool struct {
+	jobs chan publishJob
+	wg   sync.WaitGroup
+	log  *zap.Logger
+}
+
+// NewPublishPool starts a worker for each of the publishers, with a queue of queueSize deliveries
+func NewPublishPool(publishers []broker.Publisher, queueSize int, log *zap.Logger) *PublishPool {
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	pool := &PublishPool{
+		jobs: make(chan publishJob, queueSize),
+		log:  log,
+	}
+	for _, publisher := range publishers {
+		pool.wg.Add(1)
+		go pool.work(publisher)
+	}
+	log.Info("Publish pool started", zap.Int("workers", len(publishers)), zap.Int("queue_size", queueSize))
+	return pool
+}
+
+// work runs the jobs with its publisher until the pool is closed, then closes its publisher
+func (p *PublishPool) work(publisher broker.Publisher) {
+	defer p.wg.Done()
+	for job := range p.jobs {
+		job(publisher)
+	}
+	if c, ok := publisher.(closer); ok {
+		c.Close()
+	}
+}
+
+// submit queues the job, blocking while the queue is full
+func (p *PublishPool) submit(job publishJob) {
+	p.jobs <- job
+}
+
+// Close stops the workers once the queued jobs are run, and closes their publishers
+func (p *PublishPool) Close() {
+	close(p.jobs)
+	p.wg.Wait()
+}
@@ -0,0 +1,200 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// upper bounds of the buckets of the histograms, the last bucket has no upper bound
+var (
+	// SpeedBuckets are in km/h
+	SpeedBuckets = []float64{5, 10, 20, 40, 60, 80, 100}
+	// GapBuckets are in seconds
+	GapBuckets = []float64{5, 10, 30, 60, 300, 900}
+)
+
+// Histogram counts values in buckets, Counts[i] is the number of values up to Bounds[i] (and above Bounds[i-1]),
+// the last count is the number of values above the last bound
+type Histogram struct {
+	Bounds []float64
+	Counts []int64
+}
+
+// NewHistogram creates an empty histogram with the bounds
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		Bounds: bounds,
+		Counts: make([]int64, len(bounds)+1),
+	}
+}
+
+// Add counts the value in its bucket
+func (h *Histogram) Add(value float64) {
+	h.Counts[sort.SearchFloat64s(h.Bounds, value)]++
+}
+
+// Report is a broker.Publisher which collects the deliveries of a dry run instead of publishing them,
+// so they are built and serialized exactly as they would be sent to RabbitMQ
+type Report struct {
+	mutex      sync.Mutex
+	Deliveries int64
+	Parts      int64
+	Segments   int64
+	Distance   float64
+	// IdleSegments are the segments billed by their time, IdleTime is their duration in seconds
+	IdleSegments int64
+	IdleTime     float64
+	Speeds       *Histogram
+	Gaps         *Histogram
+	FirstTime    int64
+	LastTime     int64
+	Completions  int64
+}
+
+// NewReport creates an empty report
+func NewReport() *Report {
+	return &Report{
+		Speeds:    NewHistogram(SpeedBuckets),
+		Gaps:      NewHistogram(GapBuckets),
+		FirstTime: math.MaxInt64,
+		LastTime:  math.MinInt64,
+	}
+}
+
+// PublishMessage adds the serialized delivery to the report, job completions are only counted
+func (r *Report) PublishMessage(ctx context.Context, body []byte) error {
+	if _, ok := models.ParseJobCompletion(body); ok {
+		r.mutex.Lock()
+		r.Completions++
+		r.mutex.Unlock()
+		return nil
+	}
+
+	var delivery models.Delivery
+	if err := json.Unmarshal(body, &delivery); err != nil {
+		return fmt.Errorf("failed to decode delivery: %v", err)
+	}
+	r.AddDelivery(&delivery)
+	return nil
+}
+
+// AddDelivery adds the segments of the delivery to the histograms and the time range,
+// a delivery split into parts is counted once, by its first part
+func (r *Report) AddDelivery(delivery *models.Delivery) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if delivery.IsPart() {
+		r.Parts++
+	}
+	if delivery.Part == 0 {
+		r.Deliveries++
+	}
+	for _, segment := range delivery.Segments {
+		r.Segments++
+		r.Distance += segment.Distance
+		r.Speeds.Add(segment.Speed)
+		gap := segment.ElapsedTime * 3600
+		r.Gaps.Add(gap)
+		if segment.IsIdle() {
+			r.IdleSegments++
+			r.IdleTime += gap
+		}
+		r.FirstTime = min(r.FirstTime, segment.StartTime)
+		r.LastTime = max(r.LastTime, segment.StartTime+int64(math.Round(gap)))
+	}
+}
+
+// Summary holds the counts of the run which are not seen by the report, i.e. before the deliveries are published
+type Summary struct {
+	Points          int64
+	DuplicatePoints int64
+	Deliveries      int64
+	// Rejections is the number of rejected points of each reason, whether rejected by the reader or while building segments
+	Rejections map[string]int64
+}
+
+// Write prints the report along with the summary of the run
+func (r *Report) Write(w io.Writer, summary Summary) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var rejected int64
+	reasons := make([]string, 0, len(summary.Rejections))
+	for reason, count := range summary.Rejections {
+		reasons = append(reasons, reason)
+		rejected += count
+	}
+	sort.Strings(reasons)
+
+	p := &printer{w: w}
+	p.printf("Dry run report\n")
+	p.printf("==============\n")
+	p.printf("deliveries:        %d\n", summary.Deliveries)
+	p.printf("built deliveries:  %d\n", r.Deliveries)
+	if r.Parts > 0 {
+		p.printf("split into parts:  %d\n", r.Parts)
+	}
+	p.printf("points:            %d\n", summary.Points)
+	p.printf("duplicate points:  %d\n", summary.DuplicatePoints)
+	p.printf("segments:          %d\n", r.Segments)
+	p.printf("distance:          %.3f km\n", r.Distance)
+	p.printf("idle segments:     %d (%s)\n", r.IdleSegments, time.Duration(math.Round(r.IdleTime))*time.Second)
+	if r.Segments > 0 {
+		first, last := time.Unix(r.FirstTime, 0).UTC(), time.Unix(r.LastTime, 0).UTC()
+		p.printf("time range:        %s - %s (%s)\n", first.Format(time.RFC3339), last.Format(time.RFC3339), last.Sub(first))
+	} else {
+		p.printf("time range:        -\n")
+	}
+
+	p.printf("\nrejected points by reason: %d\n", rejected)
+	for _, reason := range reasons {
+		p.printf("  %-24s %d\n", reason, summary.Rejections[reason])
+	}
+
+	p.printf("\nsegment speeds (km/h):\n")
+	p.histogram(r.Speeds, r.Segments, "%g")
+	p.printf("\ntime gaps between points (s):\n")
+	p.histogram(r.Gaps, r.Segments, "%g")
+	return p.err
+}
+
+// printer keeps the first error of writing the report
+type printer struct {
+	w   io.Writer
+	err error
+}
+
+func (p *printer) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
+
+// histogram prints a line for each bucket, with its share of the total
+func (p *printer) histogram(h *Histogram, total int64, boundFormat string) {
+	for i, count := range h.Counts {
+		var bucket string
+		switch {
+		case i == 0:
+			bucket = "<= " + fmt.Sprintf(boundFormat, h.Bounds[0])
+		case i == len(h.Bounds):
+			bucket = "> " + fmt.Sprintf(boundFormat, h.Bounds[i-1])
+		default:
+			bucket = fmt.Sprintf(boundFormat+" - "+boundFormat, h.Bounds[i-1], h.Bounds[i])
+		}
+		share := 0.0
+		if total > 0 {
+			share = float64(count) * 100 / float64(total)
+		}
+		p.printf("  %-12s %10d  %5.1f%%\n", bucket, count, share)
+	}
+}
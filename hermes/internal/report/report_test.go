@@ -0,0 +1,83 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	histogram := NewHistogram([]float64{10, 20})
+	for _, value := range []float64{0, 10, 15, 20, 25, 100} {
+		histogram.Add(value)
+	}
+	assert.Equal(t, []int64{2, 2, 2}, histogram.Counts, "the bounds should be included in their bucket")
+}
+
+func TestReport(t *testing.T) {
+	report := NewReport()
+	delivery := models.Delivery{ID: 1, Segments: []models.DeliverySegment{
+		{StartTime: 1000, ElapsedTime: 60.0 / 3600, Speed: 30, Distance: 0.5},
+		{StartTime: 1060, ElapsedTime: 600.0 / 3600, Speed: 3, Distance: 0.5},
+	}}
+	body, err := json.Marshal(delivery)
+	assert.NoError(t, err)
+	assert.NoError(t, report.PublishMessage(context.Background(), body))
+
+	completion, err := json.Marshal(models.NewJobCompletion("job-1", 1, 2000))
+	assert.NoError(t, err)
+	assert.NoError(t, report.PublishMessage(context.Background(), completion))
+
+	assert.Equal(t, int64(1), report.Deliveries, "the job completion should not be counted as a delivery")
+	assert.Equal(t, int64(2), report.Segments)
+	assert.Equal(t, int64(1000), report.FirstTime)
+	assert.Equal(t, int64(1660), report.LastTime)
+	assert.Equal(t, int64(1), report.Speeds.Counts[0])
+	assert.Equal(t, int64(1), report.Speeds.Counts[3])
+	assert.Equal(t, int64(1), report.Gaps.Counts[3])
+	assert.Equal(t, int64(1), report.Gaps.Counts[5])
+
+	var out bytes.Buffer
+	err = report.Write(&out, Summary{Points: 4, Deliveries: 1, Rejections: map[string]int64{"speed_limit_exceeded": 1}})
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "points:            4")
+	assert.Contains(t, out.String(), "idle segments:     1 (10m0s)")
+	assert.Contains(t, out.String(), "speed_limit_exceeded")
+	assert.Contains(t, out.String(), "1970-01-01T00:16:40Z - 1970-01-01T00:27:40Z (11m0s)")
+}
+
+func TestReport_InvalidMessage(t *testing.T) {
+	assert.Error(t, NewReport().PublishMessage(context.Background(), []byte("not json")))
+}
+
+func TestSimplificationComparison(t *testing.T) {
+	fareRules := models.FareRules{FlagAmount: 1.30, IdleFarePerHour: 11.90, MovingDayFarePerKm: 0.74, MovingNightFarePerKm: 1.30, DayStartHour: 5, DayEndHour: 24}
+	comparison, err := NewSimplificationComparison("", []float64{5, 1}, models.DropCurrentFilter{}, models.ValidationRules{}, fareRules)
+	assert.NoError(t, err)
+
+	// two deliveries going north along a straight road at 10 m per second, zigzagging by about 2 m
+	for id := 1; id <= 2; id++ {
+		for second := 0; second <= 60; second++ {
+			longitude := 51.4 + float64(second%2)*0.00004
+			comparison.AddPoint(&models.DeliveryPoint{DeliveryID: id, Latitude: 35.7 + float64(second)*0.00009, Longitude: longitude, Timestamp: int64(1000 + second)})
+		}
+	}
+	comparison.Flush()
+
+	assert.Equal(t, int64(122), comparison.totals[0].points)
+	assert.Equal(t, int64(122), comparison.totals[1].points, "1 m should be the first tolerance")
+	assert.Equal(t, int64(4), comparison.totals[2].points)
+	assert.Less(t, comparison.totals[2].payload*10, comparison.totals[0].payload)
+	assert.Less(t, comparison.totals[2].fare, comparison.totals[0].fare, "the zigzag should not be billed")
+
+	var out bytes.Buffer
+	assert.NoError(t, comparison.Write(&out))
+	assert.Contains(t, out.String(), "simplification (douglas_peucker)")
+	assert.Contains(t, out.String(), "+0.0%", "1 m should not change the deliveries")
+
+	_, err = NewSimplificationComparison("unknown", nil, models.DropCurrentFilter{}, models.ValidationRules{}, fareRules)
+	assert.Error(t, err)
+}
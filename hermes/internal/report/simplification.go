@@ -0,0 +1,125 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"io"
+	"sort"
+)
+
+// DefaultTolerances are the tolerances (in m) the simplification is compared at, when none are configured
+var DefaultTolerances = []float64{1, 2, 5, 10, 20, 50}
+
+// simplificationTotals holds the totals of the deliveries built at a tolerance
+type simplificationTotals struct {
+	points  int64
+	payload int64
+	fare    float64
+}
+
+// SimplificationComparison builds each delivery of a dry run without simplification and simplified at each
+// tolerance, to compare their fares and payload sizes. it has its own validation policy, so the violations
+// of the run are not counted again
+type SimplificationComparison struct {
+	algorithm  string
+	tolerances []float64
+	filters    []models.PointFilter
+	policy     *models.ValidationPolicy
+	stops      *models.StopDetector
+	fareRules  models.FareRules
+	points     []models.DeliveryPoint
+	totals     []simplificationTotals
+}
+
+// NewSimplificationComparison creates a comparison of the algorithm at the tolerances, on top of the point filter
+func NewSimplificationComparison(algorithm string, tolerances []float64, filter models.PointFilter, rules models.ValidationRules, fareRules models.FareRules) (*SimplificationComparison, error) {
+	if len(tolerances) == 0 {
+		tolerances = DefaultTolerances
+	}
+	tolerances = append([]float64(nil), tolerances...)
+	sort.Float64s(tolerances)
+
+	// the first totals are of the deliveries without simplification
+	filters := []models.PointFilter{filter}
+	for _, tolerance := range tolerances {
+		simplifier, err := models.NewSimplifier(algorithm, tolerance)
+		if err != nil {
+			return nil, err
+		}
+		algorithm = simplifier.Name()
+		filters = append(filters, models.SimplifiedFilter{PointFilter: filter, Simplifier: simplifier})
+	}
+	return &SimplificationComparison{
+		algorithm:  algorithm,
+		tolerances: tolerances,
+		filters:    filters,
+		policy:     models.NewValidationPolicy(rules),
+		fareRules:  fareRules,
+		totals:     make([]simplificationTotals, len(filters)),
+	}, nil
+}
+
+// SetStopDetector sets the stop detection classifying the segments, like the processor
+func (c *SimplificationComparison) SetStopDetector(detector *models.StopDetector) {
+	c.stops = detector
+}
+
+// AddPoint collects the points of a delivery until its ID changes, like the processor, then compares the delivery
+func (c *SimplificationComparison) AddPoint(point *models.DeliveryPoint) {
+	if len(c.points) > 0 && c.points[0].DeliveryID != point.DeliveryID {
+		c.Flush()
+	}
+	c.points = append(c.points, *point)
+}
+
+// Flush compares the last delivery collected
+func (c *SimplificationComparison) Flush() {
+	if len(c.points) == 0 {
+		return
+	}
+	for i, filter := range c.filters {
+		points := append([]models.DeliveryPoint(nil), c.points...)
+		delivery, _ := models.BuildDelivery(points[0].DeliveryID, points, filter, c.policy)
+		if c.stops != nil {
+			c.stops.Classify(delivery, c.points)
+		}
+		payload, err := json.Marshal(delivery)
+		if err != nil {
+			continue
+		}
+		if len(delivery.Segments) > 0 {
+			// the segments share their points
+			c.totals[i].points += int64(len(delivery.Segments)) + 1
+		}
+		c.totals[i].payload += int64(len(payload))
+		c.totals[i].fare += c.fareRules.CalculateFare(delivery)
+	}
+	c.points = c.points[:0]
+}
+
+// Write prints the totals at each tolerance, along with their change from the deliveries without simplification
+func (c *SimplificationComparison) Write(w io.Writer) error {
+	p := &printer{w: w}
+	p.printf("\nsimplification (%s), fares at the configured rates:\n", c.algorithm)
+	p.printf("  %-14s %10s %16s %8s %14s %8s\n", "tolerance (m)", "points", "payload (bytes)", "change", "fare", "change")
+	base := c.totals[0]
+	for i, totals := range c.totals {
+		tolerance := "none"
+		if i > 0 {
+			tolerance = fmt.Sprintf("%g", c.tolerances[i-1])
+		}
+		p.printf("  %-14s %10d %16d %8s %14.2f %8s\n", tolerance, totals.points,
+			totals.payload, change(float64(totals.payload), float64(base.payload)),
+			totals.fare, change(totals.fare, base.fare))
+	}
+	return p.err
+}
+
+// change formats the relative change of a value from the base
+func change(value float64, base float64) string {
+	if base == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%+.1f%%", (value-base)*100/base)
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/hermes/internal/processor"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/api"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"io"
+	"math"
+	"net"
+	"time"
+)
+
+// DefaultGRPCAddress is the address the gRPC server listens on, when no address is configured
+const DefaultGRPCAddress = ":9090"
+
+// GRPCServer exposes the DeliveryIngestion service, so live location updates of couriers are received as they arrive.
+// a delivery is only built and published once it is complete, see StreamPoints
+type GRPCServer struct {
+	api.UnimplementedDeliveryIngestionServer
+	address   string
+	server    *grpc.Server
+	processor *processor.Processor
+	log       *zap.Logger
+}
+
+// NewGRPCServer creates a new GRPCServer listening on the address
+func NewGRPCServer(address string, processor *processor.Processor, log *zap.Logger) *GRPCServer {
+	if address == "" {
+		address = DefaultGRPCAddress
+	}
+	s := &GRPCServer{
+		address:   address,
+		server:    grpc.NewServer(),
+		processor: processor,
+		log:       log,
+	}
+	api.RegisterDeliveryIngestionServer(s.server, s)
+	return s
+}
+
+// ListenAndServe listens on the address of the server and serves the streams until the server is stopped
+func (s *GRPCServer) ListenAndServe() error {
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", s.address, err)
+	}
+	return s.Serve(listener)
+}
+
+// Serve serves the streams on the listener until the server is stopped
+func (s *GRPCServer) Serve(listener net.Listener) error {
+	s.log.Info("gRPC ingestion server started", zap.String("address", listener.Addr().String()))
+	if err := s.server.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+	return nil
+}
+
+// Stop waits for the open streams to finish and stops the server
+func (s *GRPCServer) Stop() {
+	s.server.GracefulStop()
+}
+
+// StreamPoints feeds the points of the stream into the processor and returns the accepted/rejected counts once the client closes the stream.
+// a delivery is only built and published when a point of another delivery is received or the stream is closed, as
+// Atalanta bills each delivery it receives as a whole: it is not flushed while the courier is still sending its points,
+// so a courier should close the stream (or move on to the next delivery) once the delivery is dropped off
+func (s *GRPCServer) StreamPoints(stream api.DeliveryIngestion_StreamPointsServer) error {
+	startTime := time.Now()
+	pointChan := make(chan *models.DeliveryPoint, 100)
+	statsChan := make(chan processor.Stats, 1)
+	go func() {
+		stats, _ := s.processor.ProcessDeliveries(pointChan)
+		statsChan <- stats
+	}()
+
+	var received, rejectedMessages int64
+	var recvErr error
+	for {
+		message, err := stream.Recv()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				recvErr = err
+			}
+			break
+		}
+		received++
+
+		point, err := toDeliveryPoint(message)
+		if err != nil {
+			s.log.Warn("Invalid delivery point", zap.Int64("delivery_id", message.GetDeliveryId()), zap.Error(err))
+			rejectedMessages++
+			continue
+		}
+		pointChan <- point
+	}
+
+	// the deliveries received so far are still published when the stream breaks
+	close(pointChan)
+	processStats := <-statsChan
+
+	summary := &api.IngestSummary{
+		Accepted:         received - rejectedMessages - processStats.RejectedPoints,
+		Rejected:         rejectedMessages + processStats.RejectedPoints,
+		RejectedMessages: rejectedMessages,
+		RejectedPoints:   processStats.RejectedPoints,
+		Deliveries:       processStats.Deliveries,
+	}
+
+	s.log.Info("gRPC ingestion stream processed",
+		zap.Int64("accepted", summary.Accepted),
+		zap.Int64("rejected", summary.Rejected),
+		zap.Int64("deliveries", summary.Deliveries),
+		zap.String("Duration", fmt.Sprintf("%s", time.Now().Sub(startTime))),
+		zap.Error(recvErr))
+
+	if recvErr != nil {
+		return recvErr
+	}
+	return stream.SendAndClose(summary)
+}
+
+// toDeliveryPoint converts a message into a DeliveryPoint, messages with a missing or out of range value are rejected
+func toDeliveryPoint(message *api.DeliveryPoint) (*models.DeliveryPoint, error) {
+	if message.GetDeliveryId() <= 0 {
+		return nil, fmt.Errorf("invalid delivery ID %d", message.GetDeliveryId())
+	}
+	if message.GetLatitude() < -90 || message.GetLatitude() > 90 {
+		return nil, fmt.Errorf("invalid latitude %f", message.GetLatitude())
+	}
+	if message.GetLongitude() < -180 || message.GetLongitude() > 180 {
+		return nil, fmt.Errorf("invalid longitude %f", message.GetLongitude())
+	}
+	if message.GetTimestamp() <= 0 {
+		return nil, fmt.Errorf("invalid timestamp %d", message.GetTimestamp())
+	}
+
+	return &models.DeliveryPoint{
+		DeliveryID: int(message.GetDeliveryId()),
+		Latitude:   message.GetLatitude(),
+		Longitude:  message.GetLongitude(),
+		Timestamp:  message.GetTimestamp(),
+		Accuracy:   quality(message.Accuracy),
+		Speed:      quality(message.Speed),
+		Bearing:    quality(message.Bearing),
+		Provider:   message.GetProvider(),
+	}, nil
+}
+
+// quality returns the value of an optional quality field, nil when it is unset or negative (which some devices
+// report when unknown) like the quality columns of the input files
+func quality(value *float64) *float64 {
+	if value == nil || *value < 0 || math.IsNaN(*value) {
+		return nil
+	}
+	quality := *value
+	return &quality
+}
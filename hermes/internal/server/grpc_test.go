@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"github.com/aref81/snappbox_fare_estimator/hermes/internal/processor"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/api"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/client"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+	"time"
+)
+
+// newTestClient serves a GRPCServer on an in-process listener and returns a client connected to it
+func newTestClient(t *testing.T) (*client.Client, *recordingPublisher) {
+	publisher := &recordingPublisher{}
+	return serveTestClient(t, processor.NewDeliveryProcessor(publisher, zap.NewNop())), publisher
+}
+
+// serveTestClient serves a GRPCServer with the processor on an in-process listener and returns a client connected to it
+func serveTestClient(t *testing.T, prc *processor.Processor) *client.Client {
+	grpcServer := NewGRPCServer("", prc, zap.NewNop())
+
+	listener := bufconn.Listen(1024 * 1024)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	grpcClient, err := client.Dial("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}))
+	assert.NoError(t, err)
+	t.Cleanup(func() { grpcClient.Close() })
+	return grpcClient
+}
+
+func TestStreamPoints(t *testing.T) {
+	grpcClient, publisher := newTestClient(t)
+
+	summary, err := grpcClient.SendPoints(context.Background(), []models.DeliveryPoint{
+		{DeliveryID: 1, Latitude: 35.7000, Longitude: 51.4000, Timestamp: 1000},
+		{DeliveryID: 1, Latitude: 35.7010, Longitude: 51.4010, Timestamp: 1100},
+		{DeliveryID: 1, Latitude: 36.7000, Longitude: 52.4000, Timestamp: 1200}, // speed spike, rejected by the processor
+		{DeliveryID: 1, Latitude: 135.7, Longitude: 51.4, Timestamp: 1300},      // invalid latitude, rejected by the server
+		{DeliveryID: 2, Latitude: 35.7000, Longitude: 51.4000, Timestamp: 1000},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), summary.GetAccepted())
+	assert.Equal(t, int64(2), summary.GetRejected())
+	assert.Equal(t, int64(1), summary.GetRejectedMessages())
+	assert.Equal(t, int64(1), summary.GetRejectedPoints())
+	assert.Equal(t, int64(2), summary.GetDeliveries())
+	assert.Eventually(t, func() bool { return publisher.published() == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestStreamPoints_LiveUpdates(t *testing.T) {
+	grpcClient, publisher := newTestClient(t)
+
+	stream, err := grpcClient.OpenStream(context.Background())
+	assert.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		point := models.DeliveryPoint{DeliveryID: 3, Latitude: 35.7 + float64(i)*0.001, Longitude: 51.4, Timestamp: int64(1000 + i*60)}
+		assert.NoError(t, stream.Send(point))
+	}
+	summary, err := stream.CloseAndRecv()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), summary.GetAccepted())
+	assert.Equal(t, int64(0), summary.GetRejected())
+	assert.Equal(t, int64(1), summary.GetDeliveries())
+	assert.Eventually(t, func() bool { return publisher.published() == 1 }, time.Second, 10*time.Millisecond)
+
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	assert.Len(t, publisher.deliveries[0].Segments, 4)
+}
+
+func TestStreamPoints_Quality(t *testing.T) {
+	publisher := &recordingPublisher{}
+	prc := processor.NewDeliveryProcessor(publisher, zap.NewNop())
+	prc.SetValidationPolicy(models.NewValidationPolicy(models.ValidationRules{MaxAccuracy: 20}))
+	grpcClient := serveTestClient(t, prc)
+
+	accurate, inaccurate := 5.0, 80.0
+	summary, err := grpcClient.SendPoints(context.Background(), []models.DeliveryPoint{
+		{DeliveryID: 1, Latitude: 35.7000, Longitude: 51.4000, Timestamp: 1000, Accuracy: &accurate},
+		{DeliveryID: 1, Latitude: 35.7010, Longitude: 51.4010, Timestamp: 1100, Accuracy: &inaccurate}, // rejected by the max accuracy
+		{DeliveryID: 1, Latitude: 35.7020, Longitude: 51.4020, Timestamp: 1200},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), summary.GetAccepted())
+	assert.Equal(t, int64(1), summary.GetRejectedPoints())
+}
+
+func TestToDeliveryPoint_Quality(t *testing.T) {
+	accuracy, speed, unknown := 4.5, 8.0, -1.0
+	point, err := toDeliveryPoint(&api.DeliveryPoint{
+		DeliveryId: 1, Latitude: 35.7, Longitude: 51.4, Timestamp: 1000,
+		Accuracy: &accuracy, Speed: &speed, Bearing: &unknown, Provider: "gps",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 4.5, *point.Accuracy)
+	assert.Equal(t, 8.0, *point.Speed)
+	assert.Nil(t, point.Bearing, "a negative value should be read as unknown")
+	assert.Equal(t, "gps", point.Provider)
+
+	point, err = toDeliveryPoint(&api.DeliveryPoint{DeliveryId: 1, Latitude: 35.7, Longitude: 51.4, Timestamp: 1000})
+	assert.NoError(t, err)
+	assert.Nil(t, point.Accuracy)
+	assert.Nil(t, point.Speed)
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/hermes/internal/processor"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input/csv"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input/ndjson"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"go.uber.org/zap"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// DeliveriesPath is the path of the ingestion endpoint
+const DeliveriesPath = "/deliveries"
+
+// DefaultHTTPAddress is the address the server listens on, when no address is configured
+const DefaultHTTPAddress = ":8080"
+
+// DefaultMaxBodySize is the largest body (in bytes, as sent) of a request, when no size is configured
+const DefaultMaxBodySize = 32 << 20
+
+// HTTPServer exposes an endpoint to submit batches of delivery points, which are processed like the input files
+type HTTPServer struct {
+	server      *http.Server
+	processor   *processor.Processor
+	csvSchema   csv.Schema
+	maxBodySize int64
+	log         *zap.Logger
+}
+
+// IngestResponse is the result of a single ingestion request
+type IngestResponse struct {
+	Accepted       int64  `json:"accepted"`
+	Rejected       int64  `json:"rejected"`
+	RejectedRows   int64  `json:"rejected_rows"`
+	RejectedPoints int64  `json:"rejected_points"`
+	Deliveries     int64  `json:"deliveries"`
+	Error          string `json:"error,omitempty"`
+}
+
+// limitedBody is the body of a request read up to the max body size, which tells whether the request was larger
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// bodyReader is a DeliveryReader which keeps the stats of the rows read from a request body
+type bodyReader interface {
+	input.DeliveryReader
+	Stats() input.Stats
+}
+
+// NewHTTPServer creates a new HTTPServer listening on the address, CSV bodies are read with the given schema
+func NewHTTPServer(address string, processor *processor.Processor, csvSchema csv.Schema, log *zap.Logger) *HTTPServer {
+	if address == "" {
+		address = DefaultHTTPAddress
+	}
+	s := &HTTPServer{
+		processor:   processor,
+		csvSchema:   csvSchema,
+		maxBodySize: DefaultMaxBodySize,
+		log:         log,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(DeliveriesPath, s.handleDeliveries)
+	s.server = &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// SetMaxBodySize sets the largest body (in bytes) of a request, larger requests fail with 413 once the limit is read.
+// a size of 0 keeps the default
+func (s *HTTPServer) SetMaxBodySize(size int64) {
+	if size > 0 {
+		s.maxBodySize = size
+	}
+}
+
+// Handler returns the http handler of the server, mostly useful for tests
+func (s *HTTPServer) Handler() http.Handler {
+	return s.server.Handler
+}
+
+// ListenAndServe serves the requests until the server is closed
+func (s *HTTPServer) ListenAndServe() error {
+	s.log.Info("HTTP ingestion server started", zap.String("address", s.server.Addr))
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Close stops the server immediately
+func (s *HTTPServer) Close() error {
+	return s.server.Close()
+}
+
+// handleDeliveries streams the body of the request through the processor and responds with the accepted/rejected counts
+// the body may be CSV (text/csv) or JSON Lines (application/x-ndjson), optionally compressed
+func (s *HTTPServer) handleDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// the points read before the limit is reached are still processed
+	body := &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, s.maxBodySize)}
+	r.Body = body
+	reader, err := s.newBodyReader(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	startTime := time.Now()
+	pointChan := make(chan *models.DeliveryPoint, 100)
+	readErrChan := make(chan error, 1)
+	go func() {
+		readErrChan <- reader.StreamDeliveryPoints(pointChan, s.log)
+	}()
+
+	processStats, err := s.processor.ProcessDeliveries(pointChan)
+	readErr := <-readErrChan
+	if readErr == nil {
+		readErr = err
+	}
+
+	readStats := reader.Stats()
+	response := IngestResponse{
+		Accepted:       readStats.Accepted() - processStats.RejectedPoints,
+		Rejected:       readStats.Rejected + processStats.RejectedPoints,
+		RejectedRows:   readStats.Rejected,
+		RejectedPoints: processStats.RejectedPoints,
+		Deliveries:     processStats.Deliveries,
+	}
+	status := http.StatusOK
+	if body.exceeded {
+		response.Error = fmt.Sprintf("request body larger than %d bytes", s.maxBodySize)
+		status = http.StatusRequestEntityTooLarge
+	} else if readErr != nil {
+		response.Error = readErr.Error()
+		status = http.StatusBadRequest
+	}
+
+	s.log.Info("HTTP ingestion request processed",
+		zap.String("remote_address", r.RemoteAddr),
+		zap.Int64("accepted", response.Accepted),
+		zap.Int64("rejected", response.Rejected),
+		zap.Int64("deliveries", response.Deliveries),
+		zap.String("Duration", fmt.Sprintf("%s", time.Now().Sub(startTime))),
+		zap.Error(readErr))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.log.Warn("Failed to write HTTP response", zap.Error(err))
+	}
+}
+
+// newBodyReader creates the reader matching the content type of the request
+func (s *HTTPServer) newBodyReader(r *http.Request) (bodyReader, error) {
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type: %v", err)
+	}
+
+	name := "http:" + r.RemoteAddr
+	switch contentType {
+	case "text/csv":
+		return csv.NewStreamReader(name, r.Body, s.csvSchema, 0), nil
+	case "application/x-ndjson", "application/jsonl", "application/json-lines":
+		return ndjson.NewStreamReader(name, r.Body, 0), nil
+	default:
+		return nil, fmt.Errorf("unsupported content type %q, expected text/csv or application/x-ndjson", contentType)
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aref81/snappbox_fare_estimator/hermes/internal/processor"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input/csv"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingPublisher keeps the deliveries published to it
+type recordingPublisher struct {
+	mutex      sync.Mutex
+	deliveries []models.Delivery
+}
+
+func (p *recordingPublisher) PublishMessage(ctx context.Context, body []byte) error {
+	var delivery models.Delivery
+	if err := json.Unmarshal(body, &delivery); err != nil {
+		return err
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.deliveries = append(p.deliveries, delivery)
+	return nil
+}
+
+func (p *recordingPublisher) published() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.deliveries)
+}
+
+// postDeliveries sends the body to the ingestion endpoint and decodes the response
+func postDeliveries(t *testing.T, handler http.Handler, contentType string, body string) (int, IngestResponse) {
+	request := httptest.NewRequest(http.MethodPost, DeliveriesPath, strings.NewReader(body))
+	request.Header.Set("Content-Type", contentType)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	var response IngestResponse
+	if recorder.Code != http.StatusUnsupportedMediaType && recorder.Code != http.StatusMethodNotAllowed {
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	}
+	return recorder.Code, response
+}
+
+func newTestServer() (*HTTPServer, *recordingPublisher) {
+	publisher := &recordingPublisher{}
+	prc := processor.NewDeliveryProcessor(publisher, zap.NewNop())
+	return NewHTTPServer("", prc, csv.DefaultSchema(), zap.NewNop()), publisher
+}
+
+func TestHandleDeliveries_CSV(t *testing.T) {
+	httpServer, publisher := newTestServer()
+
+	body := "id_delivery,lat,lng,timestamp\n" +
+		"1,35.7000,51.4000,1000\n" +
+		"1,35.7010,51.4010,1100\n" +
+		"1,36.7000,52.4000,1200\n" + // speed spike, rejected by the processor
+		"bad,35.7,51.4,1300\n" + // invalid row, rejected by the reader
+		"2,35.7000,51.4000,1000\n"
+
+	status, response := postDeliveries(t, httpServer.Handler(), "text/csv", body)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, IngestResponse{
+		Accepted:       3,
+		Rejected:       2,
+		RejectedRows:   1,
+		RejectedPoints: 1,
+		Deliveries:     2,
+	}, response)
+	assert.Eventually(t, func() bool { return publisher.published() == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestHandleDeliveries_NDJSON(t *testing.T) {
+	httpServer, publisher := newTestServer()
+
+	body := `{"id_delivery":7,"lat":35.7,"lng":51.4,"timestamp":1000}
+{"id_delivery":7,"lat":35.701,"lng":51.401,"timestamp":1100}
+`
+	status, response := postDeliveries(t, httpServer.Handler(), "application/x-ndjson; charset=utf-8", body)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int64(2), response.Accepted)
+	assert.Equal(t, int64(0), response.Rejected)
+	assert.Eventually(t, func() bool { return publisher.published() == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestHandleDeliveries_MaxBodySize(t *testing.T) {
+	httpServer, _ := newTestServer()
+	body := "id_delivery,lat,lng,timestamp\n" + strings.Repeat("1,35.7000,51.4000,1000\n", 10)
+
+	httpServer.SetMaxBodySize(int64(len(body)))
+	status, _ := postDeliveries(t, httpServer.Handler(), "text/csv", body)
+	assert.Equal(t, http.StatusOK, status, "a body of the max size should be accepted")
+
+	httpServer.SetMaxBodySize(int64(len(body) - 1))
+	status, response := postDeliveries(t, httpServer.Handler(), "text/csv", body)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+	assert.Contains(t, response.Error, "request body larger than")
+}
+
+func TestHandleDeliveries_InvalidRequests(t *testing.T) {
+	httpServer, _ := newTestServer()
+
+	status, _ := postDeliveries(t, httpServer.Handler(), "application/xml", "<points/>")
+	assert.Equal(t, http.StatusUnsupportedMediaType, status)
+
+	status, response := postDeliveries(t, httpServer.Handler(), "text/csv", "id_delivery,lat,timestamp\n1,35.7,1000\n")
+	assert.Equal(t, http.StatusBadRequest, status, "a header with a missing column should fail the request")
+	assert.Contains(t, response.Error, "missing required columns")
+
+	request := httptest.NewRequest(http.MethodGet, DeliveriesPath, nil)
+	recorder := httptest.NewRecorder()
+	httpServer.Handler().ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
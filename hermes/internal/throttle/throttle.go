@@ -0,0 +1,179 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/shared/broker"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultReportInterval is the interval between two logs of the achieved rate, when no interval is configured
+const DefaultReportInterval = 10 * time.Second
+
+// TokenBucket refills at Rate tokens per second up to Burst tokens. a reservation larger than the tokens left
+// takes the bucket into debt, and waits until it is paid back, so a message larger than the burst is still sent
+type TokenBucket struct {
+	Rate   float64
+	Burst  float64
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewTokenBucket creates a full bucket refilling at rate tokens per second, holding a second of tokens
+func NewTokenBucket(rate float64) *TokenBucket {
+	return &TokenBucket{
+		Rate:   rate,
+		Burst:  rate,
+		tokens: rate,
+		last:   time.Now(),
+		now:    time.Now,
+	}
+}
+
+// Reserve takes n tokens and returns how long to wait before using them
+func (b *TokenBucket) Reserve(n float64) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := b.now()
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(b.Burst, b.tokens+elapsed*b.Rate)
+	}
+	b.last = now
+
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.Rate * float64(time.Second))
+}
+
+// Limiter limits the rate of messages and of bytes published, a nil bucket does not limit its rate.
+// it counts what went through it and the time publishers waited for it
+type Limiter struct {
+	messages  *TokenBucket
+	bytes     *TokenBucket
+	published atomic.Int64
+	sent      atomic.Int64
+	throttled atomic.Int64
+}
+
+// NewLimiter creates a Limiter of messagesPerSecond and bytesPerSecond, a zero rate is not limited
+func NewLimiter(messagesPerSecond float64, bytesPerSecond float64) *Limiter {
+	limiter := &Limiter{}
+	if messagesPerSecond > 0 {
+		limiter.messages = NewTokenBucket(messagesPerSecond)
+	}
+	if bytesPerSecond > 0 {
+		limiter.bytes = NewTokenBucket(bytesPerSecond)
+	}
+	return limiter
+}
+
+// Wait blocks until a message of size bytes can be published, or the context is done
+func (l *Limiter) Wait(ctx context.Context, size int) error {
+	var delay time.Duration
+	if l.messages != nil {
+		delay = l.messages.Reserve(1)
+	}
+	if l.bytes != nil {
+		delay = max(delay, l.bytes.Reserve(float64(size)))
+	}
+	l.published.Add(1)
+	l.sent.Add(int64(size))
+	if delay <= 0 {
+		return nil
+	}
+
+	l.throttled.Add(int64(delay))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats holds the counts of a Limiter, Throttled is the total time publishers waited, summed over concurrent publishers
+type Stats struct {
+	Messages  int64
+	Bytes     int64
+	Throttled time.Duration
+}
+
+// Stats returns the counts since the limiter was created
+func (l *Limiter) Stats() Stats {
+	return Stats{
+		Messages:  l.published.Load(),
+		Bytes:     l.sent.Load(),
+		Throttled: time.Duration(l.throttled.Load()),
+	}
+}
+
+// Report logs the achieved rate and the time spent throttled every interval, while messages are published,
+// until the context is done
+func (l *Limiter) Report(ctx context.Context, interval time.Duration, log *zap.Logger) {
+	if interval <= 0 {
+		interval = DefaultReportInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := l.Stats()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stats := l.Stats()
+		if stats.Messages == last.Messages {
+			continue
+		}
+		seconds := interval.Seconds()
+		log.Info("Publish rate",
+			zap.Float64("messages_per_second", float64(stats.Messages-last.Messages)/seconds),
+			zap.Float64("bytes_per_second", float64(stats.Bytes-last.Bytes)/seconds),
+			zap.String("throttled", fmt.Sprintf("%s", stats.Throttled-last.Throttled)),
+			zap.Int64("messages", stats.Messages),
+			zap.String("total_throttled", fmt.Sprintf("%s", stats.Throttled)))
+		last = stats
+	}
+}
+
+// Publisher is a broker.Publisher which waits for its Limiter before publishing
+type Publisher struct {
+	publisher broker.Publisher
+	limiter   *Limiter
+}
+
+// NewPublisher wraps the publisher, publishers sharing the limiter share its rate
+func NewPublisher(publisher broker.Publisher, limiter *Limiter) *Publisher {
+	return &Publisher{
+		publisher: publisher,
+		limiter:   limiter,
+	}
+}
+
+// PublishMessage publishes the message once the limiter allows it
+func (p *Publisher) PublishMessage(ctx context.Context, body []byte) error {
+	if err := p.limiter.Wait(ctx, len(body)); err != nil {
+		return err
+	}
+	return p.publisher.PublishMessage(ctx, body)
+}
+
+// Close closes the wrapped publisher, if it can be closed
+func (p *Publisher) Close() {
+	if c, ok := p.publisher.(interface{ Close() }); ok {
+		c.Close()
+	}
+}
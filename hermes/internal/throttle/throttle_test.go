@@ -0,0 +1,79 @@
+package throttle
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingPublisher counts the messages published to it
+type recordingPublisher struct {
+	mutex    sync.Mutex
+	messages int
+}
+
+func (p *recordingPublisher) PublishMessage(ctx context.Context, body []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.messages++
+	return nil
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(1000, 0)
+	bucket := NewTokenBucket(10)
+	bucket.now = func() time.Time { return now }
+	bucket.last = now
+
+	for i := 0; i < 10; i++ {
+		assert.Zero(t, bucket.Reserve(1), "the burst should not wait")
+	}
+	assert.Equal(t, 100*time.Millisecond, bucket.Reserve(1))
+	assert.Equal(t, 200*time.Millisecond, bucket.Reserve(1), "reservations should queue behind each other")
+
+	now = now.Add(time.Second)
+	assert.Equal(t, 100*time.Millisecond, bucket.Reserve(9), "the bucket should refill at its rate")
+
+	now = now.Add(time.Hour)
+	assert.Equal(t, 500*time.Millisecond, bucket.Reserve(15), "the bucket should not hold more than its burst")
+}
+
+func TestPublisher_RateLimited(t *testing.T) {
+	recorder := &recordingPublisher{}
+	limiter := NewLimiter(1000, 0)
+	publishers := []*Publisher{NewPublisher(recorder, limiter), NewPublisher(recorder, limiter)}
+
+	startTime := time.Now()
+	wg := sync.WaitGroup{}
+	for _, publisher := range publishers {
+		wg.Add(1)
+		go func(publisher *Publisher) {
+			defer wg.Done()
+			for i := 0; i < 600; i++ {
+				assert.NoError(t, publisher.PublishMessage(context.Background(), []byte("delivery")))
+			}
+		}(publisher)
+	}
+	wg.Wait()
+
+	// the first 1000 messages are the burst, the other 200 take 200ms at 1000 messages per second
+	assert.GreaterOrEqual(t, time.Since(startTime), 180*time.Millisecond, "the workers should share the rate")
+	assert.Equal(t, 1200, recorder.messages)
+	stats := limiter.Stats()
+	assert.Equal(t, int64(1200), stats.Messages)
+	assert.Equal(t, int64(1200*len("delivery")), stats.Bytes)
+	assert.Greater(t, stats.Throttled, time.Duration(0))
+}
+
+func TestPublisher_BytesLimited(t *testing.T) {
+	limiter := NewLimiter(0, 1000)
+	publisher := NewPublisher(&recordingPublisher{}, limiter)
+
+	assert.NoError(t, publisher.PublishMessage(context.Background(), make([]byte, 1000)))
+	// the burst is used up, so the next message waits for its bytes until the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, publisher.PublishMessage(ctx, make([]byte, 1500)), context.DeadlineExceeded)
+}
@@ -0,0 +1,4 @@
+// Package api holds the gRPC API of Hermes, generated from api/proto/ingestion.proto
+package api
+
+//go:generate protoc --proto_path=../../api/proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ingestion.proto
@@ -0,0 +1,124 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.2
+// source: ingestion.proto
+
+package api
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	DeliveryIngestion_StreamPoints_FullMethodName = "/hermes.v1.DeliveryIngestion/StreamPoints"
+)
+
+// DeliveryIngestionClient is the client API for DeliveryIngestion service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// DeliveryIngestion receives live location updates of couriers
+type DeliveryIngestionClient interface {
+	// StreamPoints receives the points of one or more deliveries, which are built and published like the input files.
+	// the points of a delivery are expected to be sent together and in order of their timestamp,
+	// the summary is returned once the client closes the stream
+	StreamPoints(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[DeliveryPoint, IngestSummary], error)
+}
+
+type deliveryIngestionClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDeliveryIngestionClient(cc grpc.ClientConnInterface) DeliveryIngestionClient {
+	return &deliveryIngestionClient{cc}
+}
+
+func (c *deliveryIngestionClient) StreamPoints(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[DeliveryPoint, IngestSummary], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &DeliveryIngestion_ServiceDesc.Streams[0], DeliveryIngestion_StreamPoints_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DeliveryPoint, IngestSummary]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DeliveryIngestion_StreamPointsClient = grpc.ClientStreamingClient[DeliveryPoint, IngestSummary]
+
+// DeliveryIngestionServer is the server API for DeliveryIngestion service.
+// All implementations must embed UnimplementedDeliveryIngestionServer
+// for forward compatibility.
+//
+// DeliveryIngestion receives live location updates of couriers
+type DeliveryIngestionServer interface {
+	// StreamPoints receives the points of one or more deliveries, which are built and published like the input files.
+	// the points of a delivery are expected to be sent together and in order of their timestamp,
+	// the summary is returned once the client closes the stream
+	StreamPoints(grpc.ClientStreamingServer[DeliveryPoint, IngestSummary]) error
+	mustEmbedUnimplementedDeliveryIngestionServer()
+}
+
+// UnimplementedDeliveryIngestionServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedDeliveryIngestionServer struct{}
+
+func (UnimplementedDeliveryIngestionServer) StreamPoints(grpc.ClientStreamingServer[DeliveryPoint, IngestSummary]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamPoints not implemented")
+}
+func (UnimplementedDeliveryIngestionServer) mustEmbedUnimplementedDeliveryIngestionServer() {}
+func (UnimplementedDeliveryIngestionServer) testEmbeddedByValue()                           {}
+
+// UnsafeDeliveryIngestionServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DeliveryIngestionServer will
+// result in compilation errors.
+type UnsafeDeliveryIngestionServer interface {
+	mustEmbedUnimplementedDeliveryIngestionServer()
+}
+
+func RegisterDeliveryIngestionServer(s grpc.ServiceRegistrar, srv DeliveryIngestionServer) {
+	// If the following call pancis, it indicates UnimplementedDeliveryIngestionServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&DeliveryIngestion_ServiceDesc, srv)
+}
+
+func _DeliveryIngestion_StreamPoints_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(DeliveryIngestionServer).StreamPoints(&grpc.GenericServerStream[DeliveryPoint, IngestSummary]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DeliveryIngestion_StreamPointsServer = grpc.ClientStreamingServer[DeliveryPoint, IngestSummary]
+
+// DeliveryIngestion_ServiceDesc is the grpc.ServiceDesc for DeliveryIngestion service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DeliveryIngestion_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "hermes.v1.DeliveryIngestion",
+	HandlerType: (*DeliveryIngestionServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamPoints",
+			Handler:       _DeliveryIngestion_StreamPoints_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "ingestion.proto",
+}
@@ -0,0 +1,100 @@
+// Package client is a Go client of the gRPC ingestion API of Hermes
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/api"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Client sends delivery points to Hermes over gRPC
+type Client struct {
+	conn      *grpc.ClientConn
+	ingestion api.DeliveryIngestionClient
+}
+
+// Stream is an open StreamPoints call, points are sent one by one as they happen
+type Stream struct {
+	stream api.DeliveryIngestion_StreamPointsClient
+}
+
+// Dial creates a new Client connected to the address, the connection is insecure unless other credentials are given in opts
+func Dial(address string, opts ...grpc.DialOption) (*Client, error) {
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+	conn, err := grpc.NewClient(address, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to hermes: %v", err)
+	}
+	return &Client{
+		conn:      conn,
+		ingestion: api.NewDeliveryIngestionClient(conn),
+	}, nil
+}
+
+// NewClient creates a new Client over an existing connection, which is not closed by the Client
+func NewClient(conn grpc.ClientConnInterface) *Client {
+	return &Client{
+		ingestion: api.NewDeliveryIngestionClient(conn),
+	}
+}
+
+// Close closes the connection opened by Dial
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// OpenStream starts a new StreamPoints call
+func (c *Client) OpenStream(ctx context.Context) (*Stream, error) {
+	stream, err := c.ingestion.StreamPoints(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %v", err)
+	}
+	return &Stream{stream: stream}, nil
+}
+
+// SendPoints sends all the points in a single stream and returns its summary
+func (c *Client) SendPoints(ctx context.Context, points []models.DeliveryPoint) (*api.IngestSummary, error) {
+	stream, err := c.OpenStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, point := range points {
+		if err := stream.Send(point); err != nil {
+			return nil, err
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+// Send sends a single point, the points of a delivery should be sent together and in order
+func (s *Stream) Send(point models.DeliveryPoint) error {
+	err := s.stream.Send(&api.DeliveryPoint{
+		DeliveryId: int64(point.DeliveryID),
+		Latitude:   point.Latitude,
+		Longitude:  point.Longitude,
+		Timestamp:  point.Timestamp,
+		Accuracy:   point.Accuracy,
+		Speed:      point.Speed,
+		Bearing:    point.Bearing,
+		Provider:   point.Provider,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send point: %v", err)
+	}
+	return nil
+}
+
+// CloseAndRecv closes the stream and waits for the summary, once all the points are processed
+func (s *Stream) CloseAndRecv() (*api.IngestSummary, error) {
+	summary, err := s.stream.CloseAndRecv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to close stream: %v", err)
+	}
+	return summary, nil
+}
@@ -0,0 +1,250 @@
+package generator
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// defaults of the Options, used for zero values
+const (
+	DefaultDeliveries   = 100
+	DefaultPoints       = 100
+	DefaultInterval     = 30 * time.Second
+	DefaultStopDuration = 3 * time.Minute
+	// NightEndHour is the hour (UTC) night-time deliveries start before, matching the default time boundaries of Atalanta
+	NightEndHour = 5
+)
+
+// DefaultArea is the bounding box of Tehran
+var DefaultArea = models.BoundingBox{MinLatitude: 35.56, MaxLatitude: 35.83, MinLongitude: 51.20, MaxLongitude: 51.60}
+
+// Header is the header row of the generated files, in the Hermes input format
+var Header = []string{"id_delivery", "lat", "lng", "timestamp"}
+
+const (
+	// minSpeed and maxSpeed are the speeds (km/h) of a moving courier
+	minSpeed = 10.0
+	maxSpeed = 45.0
+	// stopJitter is the GPS jitter (in metres) of the points of an idle stop
+	stopJitter = 5.0
+	// minSpike and maxSpike are the distances (in km) a spike is thrown off the trace
+	minSpike        = 2.0
+	maxSpike        = 10.0
+	metresPerDegree = 111320.0
+)
+
+// Options configures the generated traces, zero values fall back to their defaults, except the rates and shares
+type Options struct {
+	// Deliveries is the number of deliveries, with IDs from 1
+	Deliveries int
+	// Points is the number of points of each delivery
+	Points int
+	// Interval is the time between two points of a delivery
+	Interval time.Duration
+	// Area is the bounding box all the points (spikes aside) are generated in
+	Area models.BoundingBox
+	// StopRate is the probability of an idle stop starting at each point, StopDuration is how long a stop lasts
+	StopRate     float64
+	StopDuration time.Duration
+	// NightShare is the share of the deliveries starting at night (between 00:00 and 05:00 UTC), the rest start in the day
+	NightShare float64
+	// SpikeRate is the probability of each point being a GPS spike, thrown a few km off the trace
+	SpikeRate float64
+	// Start is the first day of the deliveries, which are spread over the week from it
+	Start time.Time
+	// Seed makes runs with the same options generate the same traces
+	Seed int64
+}
+
+// Stats holds the numbers of the generated file
+type Stats struct {
+	Deliveries      int64
+	Points          int64
+	StopPoints      int64
+	Spikes          int64
+	NightDeliveries int64
+}
+
+// withDefaults validates the options and fills in their defaults
+func (o Options) withDefaults() (Options, error) {
+	if o.Deliveries <= 0 {
+		o.Deliveries = DefaultDeliveries
+	}
+	if o.Points <= 0 {
+		o.Points = DefaultPoints
+	}
+	if o.Interval <= 0 {
+		o.Interval = DefaultInterval
+	}
+	if o.Area.IsZero() {
+		o.Area = DefaultArea
+	}
+	if o.StopDuration <= 0 {
+		o.StopDuration = DefaultStopDuration
+	}
+	if o.Start.IsZero() {
+		o.Start = time.Date(2024, 8, 12, 0, 0, 0, 0, time.UTC)
+	}
+
+	if o.Interval < time.Second {
+		return o, errors.New("invalid interval, timestamps are in seconds so it should be at least 1s")
+	}
+	if o.Area.MinLatitude >= o.Area.MaxLatitude || o.Area.MinLongitude >= o.Area.MaxLongitude {
+		return o, errors.New("invalid area, the min bounds should be less than the max bounds")
+	}
+	for _, share := range []struct {
+		name  string
+		value float64
+	}{{"stop rate", o.StopRate}, {"night share", o.NightShare}, {"spike rate", o.SpikeRate}} {
+		if share.value < 0 || share.value > 1 {
+			return o, fmt.Errorf("invalid %s %f, expected a value between 0 and 1", share.name, share.value)
+		}
+	}
+	return o, nil
+}
+
+// Generator writes synthetic delivery traces
+type Generator struct {
+	options Options
+	random  *rand.Rand
+	stats   Stats
+}
+
+// NewGenerator creates a new Generator with the options
+func NewGenerator(options Options) (*Generator, error) {
+	options, err := options.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	return &Generator{
+		options: options,
+		random:  rand.New(rand.NewSource(options.Seed)),
+	}, nil
+}
+
+// Write writes the header and the points of all the deliveries to w as CSV, in the Hermes input format
+func (g *Generator) Write(w io.Writer) (Stats, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(Header); err != nil {
+		return g.stats, fmt.Errorf("failed to write header: %v", err)
+	}
+
+	row := make([]string, len(Header))
+	for id := 1; id <= g.options.Deliveries; id++ {
+		for _, point := range g.delivery(id) {
+			row[0] = strconv.Itoa(point.DeliveryID)
+			row[1] = strconv.FormatFloat(point.Latitude, 'f', 6, 64)
+			row[2] = strconv.FormatFloat(point.Longitude, 'f', 6, 64)
+			row[3] = strconv.FormatInt(point.Timestamp, 10)
+			if err := writer.Write(row); err != nil {
+				return g.stats, fmt.Errorf("failed to write delivery %d: %v", id, err)
+			}
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return g.stats, fmt.Errorf("failed to write points: %v", err)
+	}
+	return g.stats, nil
+}
+
+// delivery generates the points of a delivery, a random walk with a slowly turning heading which bounces off the area
+func (g *Generator) delivery(id int) []models.DeliveryPoint {
+	area := g.options.Area
+	latitude := area.MinLatitude + g.random.Float64()*(area.MaxLatitude-area.MinLatitude)
+	longitude := area.MinLongitude + g.random.Float64()*(area.MaxLongitude-area.MinLongitude)
+	heading := g.random.Float64() * 2 * math.Pi
+	speed := minSpeed + g.random.Float64()*(maxSpeed-minSpeed)
+	timestamp := g.startTime()
+
+	interval := g.options.Interval.Seconds()
+	stopPoints := int(math.Ceil(g.options.StopDuration.Seconds() / interval))
+	stopLeft := 0
+
+	points := make([]models.DeliveryPoint, 0, g.options.Points)
+	for i := 0; i < g.options.Points; i++ {
+		stopped := false
+		if i > 0 {
+			timestamp += int64(interval)
+			if stopLeft == 0 && g.random.Float64() < g.options.StopRate {
+				stopLeft = stopPoints
+			}
+			if stopLeft > 0 {
+				stopLeft--
+				stopped = true
+			} else {
+				heading += g.random.NormFloat64() * 0.3
+				speed = math.Min(maxSpeed, math.Max(minSpeed, speed+g.random.NormFloat64()*3))
+				latitude, longitude, heading = g.move(latitude, longitude, heading, speed*interval/3.6)
+			}
+		}
+
+		point := models.DeliveryPoint{DeliveryID: id, Latitude: latitude, Longitude: longitude, Timestamp: timestamp}
+		switch {
+		case i > 0 && g.random.Float64() < g.options.SpikeRate:
+			// the trace goes on from the real position, only the reported point is off
+			point.Latitude, point.Longitude = offset(latitude, longitude, g.random.Float64()*2*math.Pi,
+				(minSpike+g.random.Float64()*(maxSpike-minSpike))*1000)
+			g.stats.Spikes++
+		case stopped:
+			point.Latitude, point.Longitude = offset(latitude, longitude, g.random.Float64()*2*math.Pi,
+				g.random.Float64()*stopJitter)
+			g.stats.StopPoints++
+		}
+		points = append(points, point)
+	}
+
+	g.stats.Deliveries++
+	g.stats.Points += int64(len(points))
+	return points
+}
+
+// startTime picks the start of a delivery on a random day of the week, at night for a NightShare of the deliveries
+func (g *Generator) startTime() int64 {
+	day := g.options.Start.Add(time.Duration(g.random.Intn(7)) * 24 * time.Hour)
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+
+	var seconds int
+	if g.random.Float64() < g.options.NightShare {
+		seconds = g.random.Intn(NightEndHour * 3600)
+		g.stats.NightDeliveries++
+	} else {
+		seconds = NightEndHour*3600 + g.random.Intn((24-NightEndHour)*3600)
+	}
+	return day.Unix() + int64(seconds)
+}
+
+// move moves the position by distance metres along the heading, turning back when the area would be left
+func (g *Generator) move(latitude, longitude, heading, distance float64) (float64, float64, float64) {
+	nextLatitude, nextLongitude := offset(latitude, longitude, heading, distance)
+	area := g.options.Area
+	if nextLatitude < area.MinLatitude || nextLatitude > area.MaxLatitude {
+		heading = math.Pi - heading
+	}
+	if nextLongitude < area.MinLongitude || nextLongitude > area.MaxLongitude {
+		heading = -heading
+	}
+	if !area.Contains(nextLatitude, nextLongitude) {
+		nextLatitude, nextLongitude = offset(latitude, longitude, heading, distance)
+	}
+	if !area.Contains(nextLatitude, nextLongitude) {
+		// the area is smaller than a step, stay in place
+		return latitude, longitude, heading
+	}
+	return nextLatitude, nextLongitude, heading
+}
+
+// offset returns the position distance metres away along the heading (in radians, clockwise from north)
+func offset(latitude, longitude, heading, distance float64) (float64, float64) {
+	dLatitude := distance * math.Cos(heading) / metresPerDegree
+	dLongitude := distance * math.Sin(heading) / (metresPerDegree * math.Cos(latitude*math.Pi/180))
+	return latitude + dLatitude, longitude + dLongitude
+}
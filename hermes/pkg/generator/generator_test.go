@@ -0,0 +1,68 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func generate(t *testing.T, options Options) ([][]string, Stats) {
+	generator, err := NewGenerator(options)
+	assert.NoError(t, err)
+	var out bytes.Buffer
+	stats, err := generator.Write(&out)
+	assert.NoError(t, err)
+	rows, err := csv.NewReader(&out).ReadAll()
+	assert.NoError(t, err)
+	return rows, stats
+}
+
+func TestGenerator_Reproducible(t *testing.T) {
+	options := Options{Deliveries: 5, Points: 20, StopRate: 0.1, SpikeRate: 0.1, NightShare: 0.5, Seed: 42}
+	first, _ := generate(t, options)
+	second, _ := generate(t, options)
+	assert.Equal(t, first, second, "the same seed should generate the same traces")
+
+	options.Seed = 43
+	other, _ := generate(t, options)
+	assert.NotEqual(t, first, other)
+}
+
+func TestGenerator_Traces(t *testing.T) {
+	rows, stats := generate(t, Options{Deliveries: 10, Points: 50, Interval: 10 * time.Second, Seed: 1})
+
+	assert.Equal(t, Header, rows[0])
+	assert.Len(t, rows, 1+10*50)
+	assert.Equal(t, Stats{Deliveries: 10, Points: 500}, stats)
+
+	for i := 2; i < len(rows); i++ {
+		latitude, _ := strconv.ParseFloat(rows[i][1], 64)
+		longitude, _ := strconv.ParseFloat(rows[i][2], 64)
+		assert.True(t, DefaultArea.Contains(latitude, longitude), "row %d should be inside the area", i)
+		if rows[i][0] == rows[i-1][0] {
+			timestamp, _ := strconv.ParseInt(rows[i][3], 10, 64)
+			previous, _ := strconv.ParseInt(rows[i-1][3], 10, 64)
+			assert.Equal(t, int64(10), timestamp-previous)
+		}
+	}
+}
+
+func TestGenerator_StopsSpikesAndNights(t *testing.T) {
+	_, stats := generate(t, Options{Deliveries: 100, Points: 100, StopRate: 0.05, SpikeRate: 0.02, NightShare: 1, Seed: 1})
+	assert.NotZero(t, stats.StopPoints)
+	assert.NotZero(t, stats.Spikes)
+	assert.Equal(t, int64(100), stats.NightDeliveries)
+
+	_, stats = generate(t, Options{Deliveries: 100, Points: 100, Seed: 1})
+	assert.Zero(t, stats.StopPoints+stats.Spikes+stats.NightDeliveries, "stops, spikes and nights should only be generated when asked for")
+}
+
+func TestGenerator_InvalidOptions(t *testing.T) {
+	_, err := NewGenerator(Options{SpikeRate: 2})
+	assert.Error(t, err)
+	_, err = NewGenerator(Options{Interval: time.Millisecond})
+	assert.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package input
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Columns holds the names of the columns (or fields) required to build a DeliveryPoint, and of the optional
+// columns of the quality of its fix, which are read when present
+type Columns struct {
+	DeliveryID string
+	Latitude   string
+	Longitude  string
+	Timestamp  string
+	Accuracy   string
+	Speed      string
+	Bearing    string
+	Provider   string
+}
+
+// DefaultColumns returns the column names of the standard export: id_delivery,lat,lng,timestamp
+// followed by the optional accuracy,speed,bearing,provider
+func DefaultColumns() Columns {
+	return Columns{
+		DeliveryID: "id_delivery",
+		Latitude:   "lat",
+		Longitude:  "lng",
+		Timestamp:  "timestamp",
+		Accuracy:   "accuracy",
+		Speed:      "speed",
+		Bearing:    "bearing",
+		Provider:   "provider",
+	}
+}
+
+// WithDefaults fills the empty column names with their DefaultColumns value
+func (c Columns) WithDefaults() Columns {
+	defaults := DefaultColumns()
+	if c.DeliveryID == "" {
+		c.DeliveryID = defaults.DeliveryID
+	}
+	if c.Latitude == "" {
+		c.Latitude = defaults.Latitude
+	}
+	if c.Longitude == "" {
+		c.Longitude = defaults.Longitude
+	}
+	if c.Timestamp == "" {
+		c.Timestamp = defaults.Timestamp
+	}
+	if c.Accuracy == "" {
+		c.Accuracy = defaults.Accuracy
+	}
+	if c.Speed == "" {
+		c.Speed = defaults.Speed
+	}
+	if c.Bearing == "" {
+		c.Bearing = defaults.Bearing
+	}
+	if c.Provider == "" {
+		c.Provider = defaults.Provider
+	}
+	return c
+}
+
+// ParseQuality parses the value of an optional quality column (accuracy, speed or bearing), an empty, invalid or
+// negative value (which some devices report when unknown) returns nil, so the point is kept without it
+func ParseQuality(value string) *float64 {
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || number < 0 {
+		return nil
+	}
+	return &number
+}
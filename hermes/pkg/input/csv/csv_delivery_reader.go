@@ -2,77 +2,257 @@ package csv
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input"
 	"github.com/aref81/snappbox_fare_estimator/shared/models"
 	"go.uber.org/zap"
-	"os"
+	"io"
 	"strconv"
+	"strings"
 )
 
 // DeliveryReader implements the input interface for working with CSV file
+// the file may be plain or compressed with gzip or bzip2
 type DeliveryReader struct {
-	FilePath string
+	FilePath         string
+	Schema           Schema
+	ProgressInterval int
+	stream           io.Reader
+	resume           *models.PointOrigin
+	rejections       input.RejectionSink
+	stats            input.Stats
 }
 
-// NewDeliveryReader creates a new CSV reader with the provided file path
-func NewDeliveryReader(filePath string) input.DeliveryReader {
+// NewDeliveryReader creates a new CSV reader with the provided file path and schema
+func NewDeliveryReader(filePath string, schema Schema, progressInterval int) input.DeliveryReader {
 	return &DeliveryReader{
-		FilePath: filePath,
+		FilePath:         filePath,
+		Schema:           schema,
+		ProgressInterval: progressInterval,
 	}
 }
 
+// NewStreamReader creates a new CSV reader over a stream, such as a request body, instead of a file
+func NewStreamReader(name string, stream io.Reader, schema Schema, progressInterval int) *DeliveryReader {
+	return &DeliveryReader{
+		FilePath:         name,
+		Schema:           schema,
+		ProgressInterval: progressInterval,
+		stream:           stream,
+	}
+}
+
+// Stats returns the number of rows read and rejected so far
+func (r *DeliveryReader) Stats() input.Stats {
+	return r.stats
+}
+
+// ResumeAt makes the reader start from the row of the origin, instead of the beginning of the file
+func (r *DeliveryReader) ResumeAt(origin models.PointOrigin) {
+	r.resume = &origin
+}
+
+// SetRejectionSink makes the reader report its rejected rows to the sink
+func (r *DeliveryReader) SetRejectionSink(sink input.RejectionSink) {
+	r.rejections = sink
+}
+
+// CheckHeader reads the first row of the file and makes sure all the required columns are present,
+// so a run can fail fast before any point is published
+func CheckHeader(filePath string, schema Schema) error {
+	_, _, err := readColumnIndex(filePath, schema)
+	return err
+}
+
+// readColumnIndex reads the first row of the file and returns the index of the columns, from its header or by position,
+// along with the offset of the first data row
+func readColumnIndex(filePath string, schema Schema) (columnIndex, int64, error) {
+	source, err := input.OpenSource(filePath)
+	if err != nil {
+		return columnIndex{}, 0, err
+	}
+	defer source.Close()
+
+	reader := csv.NewReader(source)
+	reader.Comma = schema.Delimiter
+	reader.FieldsPerRecord = -1
+
+	row, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return positionalIndex, 0, nil
+		}
+		return columnIndex{}, 0, fmt.Errorf("failed to read the first row of %s: %v", filePath, err)
+	}
+
+	if !schema.isHeader(row) {
+		if len(row) < positionalIndex.width {
+			return columnIndex{}, 0, fmt.Errorf("%s has no header and only %d columns, expected at least %d", filePath, len(row), positionalIndex.width)
+		}
+		return positionalIndex, 0, nil
+	}
+	index, err := schema.resolveColumns(row)
+	if err != nil {
+		return columnIndex{}, 0, fmt.Errorf("%s: %v", filePath, err)
+	}
+	return index, reader.InputOffset(), nil
+}
+
 // StreamDeliveryPoints reads the CSV file row by row, processes each row, and pushes it to channel
+// the channel is closed once the file is read, or reading it fails
 func (r *DeliveryReader) StreamDeliveryPoints(publisherChan chan *models.DeliveryPoint, log *zap.Logger) error {
-	file, err := os.Open(r.FilePath)
+	defer close(publisherChan)
+
+	index := positionalIndex
+	firstRow := true
+	var baseOffset, baseLine int64
+
+	// when resuming, the columns are taken from the first row of the file before skipping to the resumed row
+	if r.resume != nil && r.resume.Offset > 0 {
+		var err error
+		index, _, err = readColumnIndex(r.FilePath, r.Schema)
+		if err != nil {
+			log.Error("Invalid CSV header", zap.String("file", r.FilePath), zap.Error(err))
+			return err
+		}
+		firstRow = false
+		baseOffset, baseLine = r.resume.Offset, r.resume.Line-1
+	}
+
+	source, err := r.openSource()
 	if err != nil {
 		log.Error("failed to open file", zap.Error(err))
-		return fmt.Errorf("failed to open file: %v", err)
+		return err
+	}
+	defer source.Close()
+
+	if err := source.SkipTo(baseOffset); err != nil {
+		log.Error("Failed to resume file", zap.Error(err))
+		return err
 	}
-	defer file.Close()
 
-	reader := csv.NewReader(file)
+	log.Info("Streaming CSV file",
+		zap.String("file", source.Path),
+		zap.String("compression", string(source.Compression)),
+		zap.Int64("offset", baseOffset))
+
+	reader := csv.NewReader(source)
+	reader.Comma = r.Schema.Delimiter
+	reader.FieldsPerRecord = -1
+	progress := input.NewProgress(source, r.ProgressInterval, log)
 
 	for {
+		offset := baseOffset + reader.InputOffset()
 		row, err := reader.Read()
 		if err != nil {
-			if err.Error() == "EOF" {
+			if errors.Is(err, io.EOF) {
 				break
 			}
+			// malformed rows (e.g. a bare quote) are rejected, the rest of the file can still be read
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				log.Warn("Invalid row", zap.Int("line", parseErr.StartLine), zap.Error(err))
+				r.stats.Rows++
+				r.stats.Rejected++
+				if r.rejections != nil {
+					r.rejections.Reject(input.Rejection{Source: r.FilePath, Line: baseLine + int64(parseErr.StartLine), Reason: input.ReasonParseError, Detail: parseErr.Err.Error()})
+				}
+				continue
+			}
 			log.Error("Failed to read row", zap.Error(err))
 			return err
 		}
+		progress.Row()
 
-		id, err := strconv.Atoi(row[0])
-		if err != nil {
-			log.Warn("Invalid processor ID", zap.String("value", row[0]))
-			continue
-		}
-		lat, err := strconv.ParseFloat(row[1], 64)
-		if err != nil {
-			log.Warn("Invalid latitude", zap.String("value", row[1]), zap.Int("delivery_id", id))
-			continue
-		}
-		lng, err := strconv.ParseFloat(row[2], 64)
-		if err != nil {
-			log.Warn("Invalid longitude", zap.String("value", row[2]))
-			continue
+		if firstRow {
+			firstRow = false
+			if r.Schema.isHeader(row) {
+				index, err = r.Schema.resolveColumns(row)
+				if err != nil {
+					log.Error("Invalid CSV header", zap.String("file", source.Path), zap.Error(err))
+					return err
+				}
+				continue
+			}
 		}
-		timestamp, err := strconv.ParseInt(row[3], 10, 64)
-		if err != nil {
-			log.Warn("Invalid timestamp", zap.String("value", row[3]))
-			continue
+
+		r.stats.Rows++
+		line, _ := reader.FieldPos(0)
+		origin := &models.PointOrigin{Source: r.FilePath, Line: baseLine + int64(line), Offset: offset}
+		if r.rejections != nil {
+			origin.Raw = strings.Join(row, string(r.Schema.Delimiter))
 		}
 
-		publisherChan <- &models.DeliveryPoint{
-			DeliveryID: id,
-			Latitude:   lat,
-			Longitude:  lng,
-			Timestamp:  timestamp,
+		point, reason := parseRow(row, index, origin.Line, log)
+		if point == nil {
+			r.stats.Rejected++
+			if r.rejections != nil {
+				r.rejections.Reject(input.Rejection{Source: r.FilePath, Line: origin.Line, Row: origin.Raw, Reason: reason})
+			}
+			continue
 		}
+		point.Origin = origin
+		publisherChan <- point
 	}
 
+	progress.Done()
 	log.Info("CSV streaming and publishing completed successfully")
-	close(publisherChan)
 	return nil
 }
+
+// openSource opens the file, or wraps the stream the reader was created with
+func (r *DeliveryReader) openSource() (*input.Source, error) {
+	if r.stream != nil {
+		return input.NewStreamSource(r.FilePath, r.stream)
+	}
+	return input.OpenSource(r.FilePath)
+}
+
+// parseRow builds a DeliveryPoint from a row, invalid rows are logged and skipped with the reason of rejecting them
+func parseRow(row []string, index columnIndex, line int64, log *zap.Logger) (*models.DeliveryPoint, string) {
+	if len(row) < index.width {
+		log.Warn("Invalid row, missing columns", zap.Strings("row", row), zap.Int64("line", line))
+		return nil, input.ReasonMissingColumns
+	}
+
+	id, err := strconv.Atoi(strings.TrimSpace(row[index.deliveryID]))
+	if err != nil {
+		log.Warn("Invalid delivery ID", zap.String("value", row[index.deliveryID]), zap.Int64("line", line))
+		return nil, input.ReasonInvalidDeliveryID
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(row[index.latitude]), 64)
+	if err != nil {
+		log.Warn("Invalid latitude", zap.String("value", row[index.latitude]), zap.Int("delivery_id", id), zap.Int64("line", line))
+		return nil, input.ReasonInvalidLatitude
+	}
+	lng, err := strconv.ParseFloat(strings.TrimSpace(row[index.longitude]), 64)
+	if err != nil {
+		log.Warn("Invalid longitude", zap.String("value", row[index.longitude]), zap.Int("delivery_id", id), zap.Int64("line", line))
+		return nil, input.ReasonInvalidLongitude
+	}
+	timestamp, err := strconv.ParseInt(strings.TrimSpace(row[index.timestamp]), 10, 64)
+	if err != nil {
+		log.Warn("Invalid timestamp", zap.String("value", row[index.timestamp]), zap.Int("delivery_id", id), zap.Int64("line", line))
+		return nil, input.ReasonInvalidTimestamp
+	}
+
+	return &models.DeliveryPoint{
+		DeliveryID: id,
+		Latitude:   lat,
+		Longitude:  lng,
+		Timestamp:  timestamp,
+		Accuracy:   input.ParseQuality(cell(row, index.accuracy)),
+		Speed:      input.ParseQuality(cell(row, index.speed)),
+		Bearing:    input.ParseQuality(cell(row, index.bearing)),
+		Provider:   cell(row, index.provider),
+	}, ""
+}
+
+// cell returns the trimmed value of an optional column, empty when the column is absent or the row is shorter
+func cell(row []string, position int) string {
+	if position < 0 || position >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[position])
+}
@@ -0,0 +1,194 @@
+package csv
+
+import (
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFile writes the content into a temp file and returns its path
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "points.csv")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+// readAll streams the file with the schema and returns all the points
+func readAll(t *testing.T, path string, schema Schema) ([]models.DeliveryPoint, error) {
+	pointChan := make(chan *models.DeliveryPoint, 10)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- NewDeliveryReader(path, schema, 0).StreamDeliveryPoints(pointChan, zap.NewNop())
+	}()
+
+	var points []models.DeliveryPoint
+	for point := range pointChan {
+		// origins are checked by the resume tests
+		point.Origin = nil
+		points = append(points, *point)
+	}
+	return points, <-errChan
+}
+
+func TestStreamDeliveryPoints_DefaultHeader(t *testing.T) {
+	path := writeFile(t, "id_delivery,lat,lng,timestamp\n1,35.706552,51.412262,1723697700\n1,35.702591,51.412704,1723697730\n")
+
+	points, err := readAll(t, path, DefaultSchema())
+	assert.NoError(t, err)
+	assert.Equal(t, []models.DeliveryPoint{
+		{DeliveryID: 1, Latitude: 35.706552, Longitude: 51.412262, Timestamp: 1723697700},
+		{DeliveryID: 1, Latitude: 35.702591, Longitude: 51.412704, Timestamp: 1723697730},
+	}, points, "the header should not be read as a point")
+}
+
+func TestStreamDeliveryPoints_MappedColumns(t *testing.T) {
+	// different order, extra columns and a semicolon delimiter
+	path := writeFile(t, "ts;courier;latitude;longitude;order\n1723697700;c1;35.7;51.4;42\n1723697730;c1;35.8;51.5;42\n")
+
+	schema, err := NewSchema(";", "", input.Columns{
+		DeliveryID: "order",
+		Latitude:   "latitude",
+		Longitude:  "longitude",
+		Timestamp:  "ts",
+	})
+	assert.NoError(t, err)
+
+	points, err := readAll(t, path, schema)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.DeliveryPoint{
+		{DeliveryID: 42, Latitude: 35.7, Longitude: 51.4, Timestamp: 1723697700},
+		{DeliveryID: 42, Latitude: 35.8, Longitude: 51.5, Timestamp: 1723697730},
+	}, points)
+}
+
+func TestStreamDeliveryPoints_WithoutHeader(t *testing.T) {
+	path := writeFile(t, "1,35.7,51.4,1723697700\nbad,35.7,51.4,1723697730\n2,35.8,51.5\n2,35.8,51.5,1723697790\n")
+
+	points, err := readAll(t, path, DefaultSchema())
+	assert.NoError(t, err)
+	assert.Equal(t, []models.DeliveryPoint{
+		{DeliveryID: 1, Latitude: 35.7, Longitude: 51.4, Timestamp: 1723697700},
+		{DeliveryID: 2, Latitude: 35.8, Longitude: 51.5, Timestamp: 1723697790},
+	}, points, "invalid and short rows should be skipped")
+}
+
+func TestStreamDeliveryPoints_Quality(t *testing.T) {
+	// empty, invalid and negative values are unknown
+	path := writeFile(t, "id_delivery,lat,lng,timestamp,provider,accuracy,speed,bearing\n"+
+		"1,35.7,51.4,1723697700,gps,4.5,0,270\n"+
+		"1,35.8,51.5,1723697730,,-1,n/a,\n"+
+		"1,35.9,51.6,1723697760\n")
+
+	points, err := readAll(t, path, DefaultSchema())
+	assert.NoError(t, err)
+	accuracy, speed, bearing := 4.5, 0.0, 270.0
+	assert.Equal(t, []models.DeliveryPoint{
+		{DeliveryID: 1, Latitude: 35.7, Longitude: 51.4, Timestamp: 1723697700, Accuracy: &accuracy, Speed: &speed, Bearing: &bearing, Provider: "gps"},
+		{DeliveryID: 1, Latitude: 35.8, Longitude: 51.5, Timestamp: 1723697730},
+		{DeliveryID: 1, Latitude: 35.9, Longitude: 51.6, Timestamp: 1723697760},
+	}, points)
+
+	// the extra columns of files without a header are not read as quality columns, they may hold anything
+	path = writeFile(t, "1,35.7,51.4,1723697700,4.5,0,270,gps\n")
+	points, err = readAll(t, path, DefaultSchema())
+	assert.NoError(t, err)
+	assert.Equal(t, []models.DeliveryPoint{
+		{DeliveryID: 1, Latitude: 35.7, Longitude: 51.4, Timestamp: 1723697700},
+	}, points)
+}
+
+func TestCheckHeader_MissingColumn(t *testing.T) {
+	path := writeFile(t, "id_delivery,lat,timestamp\n1,35.7,1723697700\n")
+
+	err := CheckHeader(path, DefaultSchema())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "missing required columns [lng]")
+
+	_, err = readAll(t, path, DefaultSchema())
+	assert.Error(t, err, "streaming should fail on the header as well")
+}
+
+func TestNewSchema_Invalid(t *testing.T) {
+	_, err := NewSchema(";;", "", input.Columns{})
+	assert.Error(t, err, "multi character delimiters are not supported")
+
+	_, err = NewSchema("", "sometimes", input.Columns{})
+	assert.Error(t, err, "unknown header modes should be rejected")
+
+	schema, err := NewSchema("\t", "Absent", input.Columns{Latitude: "y"})
+	assert.NoError(t, err)
+	assert.Equal(t, '\t', schema.Delimiter)
+	assert.Equal(t, HeaderAbsent, schema.Header)
+	assert.Equal(t, "y", schema.Columns.Latitude)
+	assert.Equal(t, "lng", schema.Columns.Longitude, "unset columns should keep their default name")
+}
+
+func TestStreamDeliveryPoints_Resume(t *testing.T) {
+	path := writeFile(t, "id_delivery,lat,lng,timestamp\n1,35.7,51.4,1000\n1,35.8,51.5,1100\n2,35.7,51.4,1000\n2,35.8,51.5,1100\n")
+
+	pointChan := make(chan *models.DeliveryPoint, 10)
+	assert.NoError(t, NewDeliveryReader(path, DefaultSchema(), 0).StreamDeliveryPoints(pointChan, zap.NewNop()))
+	var origins []models.PointOrigin
+	for point := range pointChan {
+		origins = append(origins, *point.Origin)
+	}
+	assert.Equal(t, []models.PointOrigin{
+		{Source: path, Line: 2, Offset: 30},
+		{Source: path, Line: 3, Offset: 47},
+		{Source: path, Line: 4, Offset: 64},
+		{Source: path, Line: 5, Offset: 81},
+	}, origins)
+
+	// resuming at the first point of the second delivery
+	reader := NewDeliveryReader(path, DefaultSchema(), 0).(*DeliveryReader)
+	reader.ResumeAt(origins[2])
+	pointChan = make(chan *models.DeliveryPoint, 10)
+	assert.NoError(t, reader.StreamDeliveryPoints(pointChan, zap.NewNop()))
+
+	var resumed []models.DeliveryPoint
+	for point := range pointChan {
+		resumed = append(resumed, *point)
+	}
+	assert.Equal(t, []models.DeliveryPoint{
+		{DeliveryID: 2, Latitude: 35.7, Longitude: 51.4, Timestamp: 1000, Origin: &origins[2]},
+		{DeliveryID: 2, Latitude: 35.8, Longitude: 51.5, Timestamp: 1100, Origin: &origins[3]},
+	}, resumed, "the header and the rows before the origin should be skipped")
+}
+
+// recordingSink keeps the rejections reported to it
+type recordingSink struct {
+	rejections []input.Rejection
+}
+
+func (s *recordingSink) Reject(rejection input.Rejection) {
+	s.rejections = append(s.rejections, rejection)
+}
+
+func TestStreamDeliveryPoints_Rejections(t *testing.T) {
+	path := writeFile(t, "id_delivery;lat;lng;timestamp\n1;35.7;51.4;1000\nbad;35.7;51.4;1100\n1;35.7\n1;35.7;x;1200\n1;35.8;51.5;1300\n")
+	schema, err := NewSchema(";", "", input.Columns{})
+	assert.NoError(t, err)
+
+	sink := &recordingSink{}
+	reader := NewDeliveryReader(path, schema, 0).(*DeliveryReader)
+	reader.SetRejectionSink(sink)
+
+	pointChan := make(chan *models.DeliveryPoint, 10)
+	assert.NoError(t, reader.StreamDeliveryPoints(pointChan, zap.NewNop()))
+	var raws []string
+	for point := range pointChan {
+		raws = append(raws, point.Origin.Raw)
+	}
+
+	assert.Equal(t, []string{"1;35.7;51.4;1000", "1;35.8;51.5;1300"}, raws, "the original rows should be kept for the processor")
+	assert.Equal(t, []input.Rejection{
+		{Source: path, Line: 3, Row: "bad;35.7;51.4;1100", Reason: input.ReasonInvalidDeliveryID},
+		{Source: path, Line: 4, Row: "1;35.7", Reason: input.ReasonMissingColumns},
+		{Source: path, Line: 5, Row: "1;35.7;x;1200", Reason: input.ReasonInvalidLongitude},
+	}, sink.rejections)
+	assert.Equal(t, input.Stats{Rows: 5, Rejected: 3}, reader.Stats())
+}
@@ -0,0 +1,339 @@
+package csv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultRangeSize is the size of the byte ranges a file is split into, when no size is configured
+const DefaultRangeSize = 8 << 20
+
+// ParallelReader reads a plain CSV file with several goroutines, each parsing its own byte range of the file.
+// ranges start at the beginning of a line where the delivery ID changes, so the points of a delivery are never split
+// between two ranges, and the ranges are pushed to the channel in the order of the file.
+// at most Workers ranges are kept in memory at once. rows with quoted line breaks are not supported,
+// and compressed files can not be split, so they are read by a single DeliveryReader
+type ParallelReader struct {
+	FilePath         string
+	Schema           Schema
+	Workers          int
+	RangeSize        int64
+	ProgressInterval int
+	resume           *models.PointOrigin
+	rejections       input.RejectionSink
+}
+
+// byteRange is a part of the file, from the start of a line up to the start of another line (or the end of the file)
+type byteRange struct {
+	start int64
+	end   int64
+}
+
+// rangeResult holds the points and rejections of a range, lines are counted from the start of the range
+type rangeResult struct {
+	points     []*models.DeliveryPoint
+	rejections []input.Rejection
+	rows       int64
+	lines      int64
+	err        error
+}
+
+// NewParallelReader creates a new ParallelReader with the provided file path and schema, parsing with the given number of workers
+func NewParallelReader(filePath string, schema Schema, workers int, rangeSize int64, progressInterval int) input.DeliveryReader {
+	if workers < 1 {
+		workers = 1
+	}
+	if rangeSize <= 0 {
+		rangeSize = DefaultRangeSize
+	}
+	return &ParallelReader{
+		FilePath:         filePath,
+		Schema:           schema,
+		Workers:          workers,
+		RangeSize:        rangeSize,
+		ProgressInterval: progressInterval,
+	}
+}
+
+// ResumeAt makes the reader start from the row of the origin, instead of the beginning of the file
+func (r *ParallelReader) ResumeAt(origin models.PointOrigin) {
+	r.resume = &origin
+}
+
+// SetRejectionSink makes the reader report its rejected rows to the sink
+func (r *ParallelReader) SetRejectionSink(sink input.RejectionSink) {
+	r.rejections = sink
+}
+
+// StreamDeliveryPoints splits the file into ranges, parses them concurrently and pushes their points to the channel in order
+// the channel is closed once the file is read, or reading it fails
+func (r *ParallelReader) StreamDeliveryPoints(publisherChan chan *models.DeliveryPoint, log *zap.Logger) error {
+	source, err := input.OpenSource(r.FilePath)
+	if err != nil {
+		close(publisherChan)
+		log.Error("failed to open file", zap.Error(err))
+		return err
+	}
+	compression := source.Compression
+	source.Close()
+
+	if compression != input.CompressionNone || r.Workers == 1 {
+		return r.sequentialReader().StreamDeliveryPoints(publisherChan, log)
+	}
+	defer close(publisherChan)
+
+	index, dataStart, err := readColumnIndex(r.FilePath, r.Schema)
+	if err != nil {
+		log.Error("Invalid CSV header", zap.String("file", r.FilePath), zap.Error(err))
+		return err
+	}
+	// the header takes the first line
+	lineBase := int64(0)
+	if dataStart > 0 {
+		lineBase = 1
+	}
+	if r.resume != nil && r.resume.Offset > 0 {
+		dataStart, lineBase = r.resume.Offset, r.resume.Line-1
+	}
+
+	file, err := os.Open(r.FilePath)
+	if err != nil {
+		log.Error("failed to open file", zap.Error(err))
+		return fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		log.Error("failed to stat file", zap.Error(err))
+		return fmt.Errorf("failed to stat file: %v", err)
+	}
+
+	ranges, err := r.splitRanges(file, dataStart, info.Size(), index)
+	if err != nil {
+		log.Error("Failed to split file into ranges", zap.String("file", r.FilePath), zap.Error(err))
+		return err
+	}
+
+	log.Info("Streaming CSV file in parallel",
+		zap.String("file", r.FilePath),
+		zap.Int("ranges", len(ranges)),
+		zap.Int("workers", r.Workers),
+		zap.Int64("offset", dataStart))
+
+	// a range holds its slot until it is pushed, so at most Workers ranges are in memory
+	startTime := time.Now()
+	slots := make(chan struct{}, r.Workers)
+	results := make([]chan rangeResult, len(ranges))
+	for i := range results {
+		results[i] = make(chan rangeResult, 1)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for i, part := range ranges {
+			select {
+			case slots <- struct{}{}:
+			case <-stop:
+				return
+			}
+			go func(i int, part byteRange) {
+				results[i] <- r.parseRange(file, part, index)
+			}(i, part)
+		}
+	}()
+
+	progressInterval := int64(r.ProgressInterval)
+	if progressInterval <= 0 {
+		progressInterval = input.DefaultProgressInterval
+	}
+	var rows, rejected int64
+	for i, part := range ranges {
+		result := <-results[i]
+		if result.err != nil {
+			log.Error("Failed to read range", zap.Int64("start", part.start), zap.Int64("end", part.end), zap.Error(result.err))
+			return result.err
+		}
+
+		for _, rejection := range result.rejections {
+			rejection.Line += lineBase
+			log.Warn("Invalid row", zap.String("reason", rejection.Reason), zap.Int64("line", rejection.Line), zap.String("detail", rejection.Detail))
+			if r.rejections != nil {
+				r.rejections.Reject(rejection)
+			}
+		}
+		for _, point := range result.points {
+			point.Origin.Line += lineBase
+			publisherChan <- point
+		}
+
+		if (rows+result.rows)/progressInterval > rows/progressInterval {
+			log.Info("Reading input",
+				zap.String("file", r.FilePath),
+				zap.Int64("rows", rows+result.rows),
+				zap.Int64("bytes_read", part.end),
+				zap.Int64("total_bytes", info.Size()),
+				zap.String("Duration", fmt.Sprintf("%s", time.Now().Sub(startTime))),
+				zap.String("percent", fmt.Sprintf("%.1f%%", float64(part.end)*100/float64(info.Size()))))
+		}
+		rows += result.rows
+		rejected += int64(len(result.rejections))
+		lineBase += result.lines
+		<-slots
+	}
+
+	log.Info("CSV streaming and publishing completed successfully",
+		zap.String("file", r.FilePath),
+		zap.Int64("rows", rows),
+		zap.Int64("rejected", rejected),
+		zap.String("Duration", fmt.Sprintf("%s", time.Now().Sub(startTime))))
+	return nil
+}
+
+// sequentialReader creates a DeliveryReader with the same settings, for files which can not be split
+func (r *ParallelReader) sequentialReader() *DeliveryReader {
+	reader := &DeliveryReader{
+		FilePath:         r.FilePath,
+		Schema:           r.Schema,
+		ProgressInterval: r.ProgressInterval,
+		resume:           r.resume,
+		rejections:       r.rejections,
+	}
+	return reader
+}
+
+// splitRanges splits the data of the file into ranges of about RangeSize bytes, aligned to delivery boundaries
+func (r *ParallelReader) splitRanges(file *os.File, start int64, size int64, index columnIndex) ([]byteRange, error) {
+	var ranges []byteRange
+	for start < size {
+		end := size
+		if start+r.RangeSize < size {
+			var err error
+			end, err = r.nextDeliveryBoundary(file, start+r.RangeSize, size, index)
+			if err != nil {
+				return nil, err
+			}
+		}
+		ranges = append(ranges, byteRange{start: start, end: end})
+		start = end
+	}
+	return ranges, nil
+}
+
+// nextDeliveryBoundary finds the start of the first line at or after the offset whose delivery ID differs from the line before it
+func (r *ParallelReader) nextDeliveryBoundary(file *os.File, offset int64, size int64, index columnIndex) (int64, error) {
+	// reading from the byte before the offset tells whether the offset is already at the start of a line
+	position := offset - 1
+	reader := bufio.NewReaderSize(io.NewSectionReader(file, position, size-position), 64*1024)
+
+	skipped, err := reader.ReadBytes('\n')
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return size, nil
+		}
+		return 0, fmt.Errorf("failed to read %s at offset %d: %v", r.FilePath, position, err)
+	}
+	position += int64(len(skipped))
+
+	previousID := ""
+	for first := true; ; first = false {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, fmt.Errorf("failed to read %s at offset %d: %v", r.FilePath, position, err)
+		}
+		if len(line) == 0 {
+			return size, nil
+		}
+
+		id := r.deliveryIDOf(line, index)
+		if !first && id != previousID {
+			return position, nil
+		}
+		previousID = id
+		position += int64(len(line))
+	}
+}
+
+// deliveryIDOf returns the raw delivery ID of a line, without parsing the whole row
+func (r *ParallelReader) deliveryIDOf(line []byte, index columnIndex) string {
+	delimiter := []byte(string(r.Schema.Delimiter))
+	for i := 0; i < index.deliveryID; i++ {
+		position := bytes.Index(line, delimiter)
+		if position < 0 {
+			return ""
+		}
+		line = line[position+len(delimiter):]
+	}
+	if position := bytes.Index(line, delimiter); position >= 0 {
+		line = line[:position]
+	}
+	return strings.Trim(string(line), " \t\r\n\"")
+}
+
+// parseRange parses the rows of a range, rejected rows are returned rather than logged so they are reported in order
+func (r *ParallelReader) parseRange(file *os.File, part byteRange, index columnIndex) rangeResult {
+	var result rangeResult
+	counter := &lineCounter{reader: io.NewSectionReader(file, part.start, part.end-part.start)}
+	reader := csv.NewReader(counter)
+	reader.Comma = r.Schema.Delimiter
+	reader.FieldsPerRecord = -1
+	nop := zap.NewNop()
+
+	for {
+		offset := part.start + reader.InputOffset()
+		row, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				result.rows++
+				result.rejections = append(result.rejections, input.Rejection{Source: r.FilePath, Line: int64(parseErr.StartLine), Reason: input.ReasonParseError, Detail: parseErr.Err.Error()})
+				continue
+			}
+			result.err = err
+			return result
+		}
+		result.rows++
+
+		line, _ := reader.FieldPos(0)
+		origin := &models.PointOrigin{Source: r.FilePath, Line: int64(line), Offset: offset}
+		if r.rejections != nil {
+			origin.Raw = strings.Join(row, string(r.Schema.Delimiter))
+		}
+
+		point, reason := parseRow(row, index, origin.Line, nop)
+		if point == nil {
+			result.rejections = append(result.rejections, input.Rejection{Source: r.FilePath, Line: origin.Line, Row: origin.Raw, Reason: reason})
+			continue
+		}
+		point.Origin = origin
+		result.points = append(result.points, point)
+	}
+
+	result.lines = counter.lines
+	return result
+}
+
+// lineCounter counts the line breaks read through it
+type lineCounter struct {
+	reader io.Reader
+	lines  int64
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.lines += int64(bytes.Count(p[:n], []byte{'\n'}))
+	return n, err
+}
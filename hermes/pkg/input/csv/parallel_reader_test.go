@@ -0,0 +1,102 @@
+package csv
+
+import (
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"os"
+	"strings"
+	"testing"
+)
+
+// streamWith reads all the points and rejections of a reader
+func streamWith(t *testing.T, reader input.DeliveryReader) ([]models.DeliveryPoint, []input.Rejection) {
+	sink := &recordingSink{}
+	reader.(input.Quarantinable).SetRejectionSink(sink)
+
+	pointChan := make(chan *models.DeliveryPoint, 10)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- reader.StreamDeliveryPoints(pointChan, zap.NewNop())
+	}()
+
+	var points []models.DeliveryPoint
+	for point := range pointChan {
+		points = append(points, *point)
+	}
+	assert.NoError(t, <-errChan)
+	return points, sink.rejections
+}
+
+// deliveriesFile writes a file of deliveries with a few points each, and some invalid rows in between
+func deliveriesFile(t *testing.T) string {
+	var content strings.Builder
+	content.WriteString("id_delivery,lat,lng,timestamp\n")
+	for id := 1; id <= 40; id++ {
+		for i := 0; i <= id%5; i++ {
+			fmt.Fprintf(&content, "%d,35.%d,51.4,%d\n", id, 700+i, 1000+i*60)
+		}
+		if id%7 == 0 {
+			fmt.Fprintf(&content, "%d,35.7,x,1000\n", id)
+		}
+	}
+	return writeFile(t, content.String())
+}
+
+func TestParallelReader_SameAsSequential(t *testing.T) {
+	path := deliveriesFile(t)
+
+	expectedPoints, expectedRejections := streamWith(t, NewDeliveryReader(path, DefaultSchema(), 0))
+	points, rejections := streamWith(t, NewParallelReader(path, DefaultSchema(), 3, 64, 0))
+
+	assert.Equal(t, expectedPoints, points, "points and their origins should be the same as a sequential read")
+	assert.Equal(t, expectedRejections, rejections)
+}
+
+func TestParallelReader_DeliveryBoundaries(t *testing.T) {
+	path := deliveriesFile(t)
+	reader := NewParallelReader(path, DefaultSchema(), 3, 64, 0).(*ParallelReader)
+
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	info, err := file.Stat()
+	assert.NoError(t, err)
+
+	index, dataStart, err := readColumnIndex(path, DefaultSchema())
+	assert.NoError(t, err)
+	ranges, err := reader.splitRanges(file, dataStart, info.Size(), index)
+	assert.NoError(t, err)
+	assert.Greater(t, len(ranges), 1)
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	for i := 1; i < len(ranges); i++ {
+		start := ranges[i].start
+		assert.Equal(t, ranges[i-1].end, start)
+		assert.Equal(t, byte('\n'), content[start-1], "ranges should start at the beginning of a line")
+
+		previous := content[:start-1]
+		previous = previous[strings.LastIndexByte(string(previous), '\n')+1:]
+		assert.NotEqual(t, reader.deliveryIDOf(previous, index), reader.deliveryIDOf(content[start:], index),
+			"a delivery should not be split between two ranges")
+	}
+}
+
+func TestParallelReader_Resume(t *testing.T) {
+	path := deliveriesFile(t)
+	points, _ := streamWith(t, NewParallelReader(path, DefaultSchema(), 3, 64, 0))
+
+	// resuming at the first point of delivery 20
+	resumeAt := 0
+	for points[resumeAt].DeliveryID != 20 {
+		resumeAt++
+	}
+	reader := NewParallelReader(path, DefaultSchema(), 3, 64, 0).(*ParallelReader)
+	reader.ResumeAt(*points[resumeAt].Origin)
+	resumed, _ := streamWith(t, reader)
+
+	assert.Equal(t, points[resumeAt:], resumed)
+}
@@ -0,0 +1,141 @@
+package csv
+
+import (
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// HeaderMode tells the reader whether the first row of a file is a header
+type HeaderMode string
+
+const (
+	// HeaderAuto treats the first row as a header when none of its cells is numeric
+	HeaderAuto    HeaderMode = "auto"
+	HeaderPresent HeaderMode = "present"
+	HeaderAbsent  HeaderMode = "absent"
+)
+
+// Schema describes the layout of a CSV input file
+type Schema struct {
+	Delimiter rune
+	Header    HeaderMode
+	Columns   input.Columns
+}
+
+// columnIndex holds the position of each required column in a row, and of the optional columns (-1 when absent)
+type columnIndex struct {
+	deliveryID int
+	latitude   int
+	longitude  int
+	timestamp  int
+	accuracy   int
+	speed      int
+	bearing    int
+	provider   int
+	// width is the minimum number of cells a row needs to have
+	width int
+}
+
+// positionalIndex is used for files without a header: id, lat, lng, timestamp. the quality columns are only read
+// when a header names them, as the extra columns of a file without a header may hold anything
+var positionalIndex = columnIndex{deliveryID: 0, latitude: 1, longitude: 2, timestamp: 3, accuracy: -1, speed: -1, bearing: -1, provider: -1, width: 4}
+
+// DefaultSchema returns the schema of the standard export: id_delivery,lat,lng,timestamp
+func DefaultSchema() Schema {
+	return Schema{
+		Delimiter: ',',
+		Header:    HeaderAuto,
+		Columns:   input.DefaultColumns(),
+	}
+}
+
+// NewSchema creates a Schema from its configured values, empty values fall back to DefaultSchema
+func NewSchema(delimiter string, header string, columns input.Columns) (Schema, error) {
+	schema := DefaultSchema()
+
+	if delimiter != "" {
+		if utf8.RuneCountInString(delimiter) != 1 {
+			return schema, fmt.Errorf("delimiter must be a single character, got %q", delimiter)
+		}
+		schema.Delimiter, _ = utf8.DecodeRuneInString(delimiter)
+	}
+
+	switch mode := HeaderMode(strings.ToLower(header)); mode {
+	case "":
+	case HeaderAuto, HeaderPresent, HeaderAbsent:
+		schema.Header = mode
+	default:
+		return schema, fmt.Errorf("invalid header mode %q, expected one of auto, present or absent", header)
+	}
+
+	schema.Columns = columns.WithDefaults()
+	return schema, nil
+}
+
+// isHeader decides if the first row of a file is a header based on the header mode
+func (s Schema) isHeader(row []string) bool {
+	switch s.Header {
+	case HeaderPresent:
+		return true
+	case HeaderAbsent:
+		return false
+	}
+
+	for _, cell := range row {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(cell), 64); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveColumns maps the configured column names to their position in the header, the optional columns may be missing
+func (s Schema) resolveColumns(header []string) (columnIndex, error) {
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		if _, exists := positions[name]; !exists {
+			positions[name] = i
+		}
+	}
+
+	var missing []string
+	find := func(name string) int {
+		position, ok := positions[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return position
+	}
+
+	optional := func(name string) int {
+		if position, ok := positions[name]; ok {
+			return position
+		}
+		return -1
+	}
+
+	index := columnIndex{
+		deliveryID: find(s.Columns.DeliveryID),
+		latitude:   find(s.Columns.Latitude),
+		longitude:  find(s.Columns.Longitude),
+		timestamp:  find(s.Columns.Timestamp),
+		accuracy:   optional(s.Columns.Accuracy),
+		speed:      optional(s.Columns.Speed),
+		bearing:    optional(s.Columns.Bearing),
+		provider:   optional(s.Columns.Provider),
+	}
+	if len(missing) > 0 {
+		return index, fmt.Errorf("missing required columns %v in header %v", missing, header)
+	}
+
+	for _, position := range []int{index.deliveryID, index.latitude, index.longitude, index.timestamp} {
+		if position+1 > index.width {
+			index.width = position + 1
+		}
+	}
+	return index, nil
+}
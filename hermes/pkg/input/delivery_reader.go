@@ -6,6 +6,14 @@ import (
 )
 
 // DeliveryReader is an abstraction for reading Delivery data
+// implementations push the points to the channel and close it when they are done
 type DeliveryReader interface {
 	StreamDeliveryPoints(publisherChan chan *models.DeliveryPoint, log *zap.Logger) error
 }
+
+// Resumable is a DeliveryReader which can start reading its input at the position of a point,
+// e.g. to resume a run from a checkpoint. ResumeAt must be called before streaming
+type Resumable interface {
+	DeliveryReader
+	ResumeAt(origin models.PointOrigin)
+}
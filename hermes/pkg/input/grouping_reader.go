@@ -0,0 +1,324 @@
+package input
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// DefaultMaxBufferedPoints is the number of points kept in memory before spilling to disk, when no limit is configured
+const DefaultMaxBufferedPoints = 1000000
+
+// GroupingReader groups the points of another reader by delivery ID, for inputs where the points of deliveries are interleaved.
+// all the points are buffered until the input is read, so each delivery is emitted only once it is complete.
+// when the buffer is full it is sorted and spilled to a run file, and the runs are merged at the end (external sort).
+// deliveries are emitted in order of their ID, and the points of a delivery keep the order they were read in
+type GroupingReader struct {
+	MaxBufferedPoints int
+	SpillDir          string
+	reader            DeliveryReader
+}
+
+// groupedPoint is a buffered point, Seq is its position in the input and keeps the order of the points of a delivery
+type groupedPoint struct {
+	Seq   int64
+	Point models.DeliveryPoint
+	// Zeros flags the quality fields of the point reported as 0 in spill files, as gob does not write zero values
+	// even behind a pointer
+	Zeros uint8
+}
+
+// flags of groupedPoint.Zeros
+const (
+	zeroAccuracy uint8 = 1 << iota
+	zeroSpeed
+	zeroBearing
+)
+
+// flagZeros sets the flags of the quality fields of the point reported as 0, before it is spilled
+func (p *groupedPoint) flagZeros() {
+	p.Zeros = 0
+	if isZero(p.Point.Accuracy) {
+		p.Zeros |= zeroAccuracy
+	}
+	if isZero(p.Point.Speed) {
+		p.Zeros |= zeroSpeed
+	}
+	if isZero(p.Point.Bearing) {
+		p.Zeros |= zeroBearing
+	}
+}
+
+// restoreZeros sets the quality fields flagged as 0 back, once the point is read from a spill file
+func (p *groupedPoint) restoreZeros() {
+	if p.Zeros&zeroAccuracy != 0 {
+		p.Point.Accuracy = new(float64)
+	}
+	if p.Zeros&zeroSpeed != 0 {
+		p.Point.Speed = new(float64)
+	}
+	if p.Zeros&zeroBearing != 0 {
+		p.Point.Bearing = new(float64)
+	}
+}
+
+// isZero tells whether an optional value is reported, as 0
+func isZero(value *float64) bool {
+	return value != nil && *value == 0
+}
+
+// NewGroupingReader creates a new GroupingReader over the reader, spill files are created in spillDir (the temp dir if empty)
+func NewGroupingReader(reader DeliveryReader, maxBufferedPoints int, spillDir string) DeliveryReader {
+	if maxBufferedPoints <= 0 {
+		maxBufferedPoints = DefaultMaxBufferedPoints
+	}
+	return &GroupingReader{
+		MaxBufferedPoints: maxBufferedPoints,
+		SpillDir:          spillDir,
+		reader:            reader,
+	}
+}
+
+// SetRejectionSink makes the underlying reader report its rejected rows to the sink
+func (g *GroupingReader) SetRejectionSink(sink RejectionSink) {
+	if quarantinable, ok := g.reader.(Quarantinable); ok {
+		quarantinable.SetRejectionSink(sink)
+	}
+}
+
+// StreamDeliveryPoints reads all the points of the underlying reader, then pushes them to the channel grouped by delivery
+func (g *GroupingReader) StreamDeliveryPoints(publisherChan chan *models.DeliveryPoint, log *zap.Logger) error {
+	defer close(publisherChan)
+
+	startTime := time.Now()
+	pointChan := make(chan *models.DeliveryPoint, 100)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- g.reader.StreamDeliveryPoints(pointChan, log)
+	}()
+
+	var runs []*spillRun
+	defer func() {
+		for _, run := range runs {
+			run.remove()
+		}
+	}()
+
+	buffer := make([]groupedPoint, 0, min(g.MaxBufferedPoints, 1024))
+	var seq int64
+	for point := range pointChan {
+		buffer = append(buffer, groupedPoint{Seq: seq, Point: *point})
+		seq++
+
+		if len(buffer) >= g.MaxBufferedPoints {
+			run, err := g.spill(buffer)
+			if err != nil {
+				log.Error("Failed to spill delivery points to disk", zap.Error(err))
+				for range pointChan {
+				}
+				<-errChan
+				return err
+			}
+			runs = append(runs, run)
+			buffer = buffer[:0]
+			log.Info("Delivery points spilled to disk", zap.String("file", run.path), zap.Int("runs", len(runs)))
+		}
+	}
+	readErr := <-errChan
+
+	sortGroupedPoints(buffer)
+	cursors := []*groupCursor{newBufferCursor(buffer)}
+	for _, run := range runs {
+		cursor, err := newRunCursor(run)
+		if err != nil {
+			log.Error("Failed to read spilled delivery points", zap.String("file", run.path), zap.Error(err))
+			return err
+		}
+		cursors = append(cursors, cursor)
+	}
+
+	deliveries, points, err := mergeGroupedPoints(cursors, publisherChan)
+	if err != nil {
+		log.Error("Failed to merge spilled delivery points", zap.Error(err))
+		return err
+	}
+
+	log.Info("Delivery points grouped",
+		zap.Int64("deliveries", deliveries),
+		zap.Int64("points", points),
+		zap.Int("spilled_runs", len(runs)),
+		zap.String("Duration", fmt.Sprintf("%s", time.Now().Sub(startTime))))
+	return readErr
+}
+
+// spill sorts the buffer and writes it to a new run file
+func (g *GroupingReader) spill(buffer []groupedPoint) (*spillRun, error) {
+	sortGroupedPoints(buffer)
+
+	file, err := os.CreateTemp(g.SpillDir, "hermes-grouping-*.run")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %v", err)
+	}
+	run := &spillRun{path: file.Name()}
+
+	writer := bufio.NewWriter(file)
+	encoder := gob.NewEncoder(writer)
+	for i := range buffer {
+		buffer[i].flagZeros()
+		if err := encoder.Encode(&buffer[i]); err != nil {
+			file.Close()
+			run.remove()
+			return nil, fmt.Errorf("failed to write spill file: %v", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		run.remove()
+		return nil, fmt.Errorf("failed to write spill file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		run.remove()
+		return nil, fmt.Errorf("failed to close spill file: %v", err)
+	}
+	return run, nil
+}
+
+// sortGroupedPoints sorts the points by delivery ID, and by their position in the input within a delivery
+func sortGroupedPoints(points []groupedPoint) {
+	sort.Slice(points, func(i, j int) bool {
+		return groupedLess(points[i], points[j])
+	})
+}
+
+func groupedLess(a, b groupedPoint) bool {
+	if a.Point.DeliveryID != b.Point.DeliveryID {
+		return a.Point.DeliveryID < b.Point.DeliveryID
+	}
+	return a.Seq < b.Seq
+}
+
+// mergeGroupedPoints merges the sorted cursors and pushes the points to the channel, returning the number of deliveries and points
+func mergeGroupedPoints(cursors []*groupCursor, publisherChan chan *models.DeliveryPoint) (int64, int64, error) {
+	var deliveries, points int64
+	lastID := 0
+
+	queue := make(cursorQueue, 0, len(cursors))
+	for _, cursor := range cursors {
+		if cursor.ok {
+			queue = append(queue, cursor)
+		}
+	}
+	heap.Init(&queue)
+
+	for queue.Len() > 0 {
+		cursor := queue[0]
+		point := cursor.current.Point
+		if points == 0 || point.DeliveryID != lastID {
+			deliveries++
+			lastID = point.DeliveryID
+		}
+		points++
+		publisherChan <- &point
+
+		if err := cursor.advance(); err != nil {
+			return deliveries, points, err
+		}
+		if cursor.ok {
+			heap.Fix(&queue, 0)
+		} else {
+			heap.Pop(&queue)
+		}
+	}
+	return deliveries, points, nil
+}
+
+// spillRun is a file of sorted points written when the buffer was full
+type spillRun struct {
+	path string
+	file *os.File
+}
+
+func (r *spillRun) remove() {
+	if r.file != nil {
+		r.file.Close()
+	}
+	os.Remove(r.path)
+}
+
+// groupCursor iterates over a sorted sequence of points, current is valid while ok is true
+type groupCursor struct {
+	current groupedPoint
+	ok      bool
+	next    func() (groupedPoint, bool, error)
+}
+
+func (c *groupCursor) advance() error {
+	point, ok, err := c.next()
+	if err != nil {
+		return err
+	}
+	c.current, c.ok = point, ok
+	return nil
+}
+
+// newBufferCursor iterates over the points kept in memory
+func newBufferCursor(buffer []groupedPoint) *groupCursor {
+	i := 0
+	cursor := &groupCursor{next: func() (groupedPoint, bool, error) {
+		if i >= len(buffer) {
+			return groupedPoint{}, false, nil
+		}
+		i++
+		return buffer[i-1], true, nil
+	}}
+	cursor.advance()
+	return cursor
+}
+
+// newRunCursor iterates over the points of a run file
+func newRunCursor(run *spillRun) (*groupCursor, error) {
+	file, err := os.Open(run.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spill file: %v", err)
+	}
+	run.file = file
+
+	decoder := gob.NewDecoder(bufio.NewReader(file))
+	cursor := &groupCursor{next: func() (groupedPoint, bool, error) {
+		var point groupedPoint
+		if err := decoder.Decode(&point); err != nil {
+			if errors.Is(err, io.EOF) {
+				return groupedPoint{}, false, nil
+			}
+			return groupedPoint{}, false, fmt.Errorf("failed to read spill file %s: %v", run.path, err)
+		}
+		point.restoreZeros()
+		return point, true, nil
+	}}
+	if err := cursor.advance(); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// cursorQueue is a min-heap of cursors ordered by their current point
+type cursorQueue []*groupCursor
+
+func (q cursorQueue) Len() int           { return len(q) }
+func (q cursorQueue) Less(i, j int) bool { return groupedLess(q[i].current, q[j].current) }
+func (q cursorQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *cursorQueue) Push(x any)        { *q = append(*q, x.(*groupCursor)) }
+func (q *cursorQueue) Pop() any {
+	old := *q
+	cursor := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return cursor
+}
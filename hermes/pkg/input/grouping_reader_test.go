@@ -0,0 +1,68 @@
+package input
+
+import (
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"os"
+	"testing"
+)
+
+func TestGroupingReader_InMemory(t *testing.T) {
+	reader := NewGroupingReader(&fakeReader{points: pointsOf(2, 1, 2, 3, 1, 2)}, 0, t.TempDir())
+
+	ids, err := collect(t, reader)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 1, 2, 2, 2, 3}, ids)
+}
+
+func TestGroupingReader_Spill(t *testing.T) {
+	spillDir := t.TempDir()
+	input := pointsOf(5, 3, 5, 1, 3, 5, 1, 4, 3, 5, 2)
+	reader := NewGroupingReader(&fakeReader{points: input}, 3, spillDir)
+
+	pointChan := make(chan *models.DeliveryPoint, 20)
+	assert.NoError(t, reader.StreamDeliveryPoints(pointChan, zap.NewNop()))
+
+	var points []*models.DeliveryPoint
+	for point := range pointChan {
+		points = append(points, point)
+	}
+	assert.Len(t, points, len(input))
+	for i := 1; i < len(points); i++ {
+		previous, current := points[i-1], points[i]
+		assert.LessOrEqual(t, previous.DeliveryID, current.DeliveryID, "deliveries should be contiguous")
+		if previous.DeliveryID == current.DeliveryID {
+			assert.Less(t, previous.Timestamp, current.Timestamp, "points of a delivery should keep their order")
+		}
+	}
+
+	files, err := os.ReadDir(spillDir)
+	assert.NoError(t, err)
+	assert.Empty(t, files, "spill files should be removed")
+}
+
+// TestGroupingReader_SpillQuality tests that the quality of the points is kept through the spill files,
+// including the values reported as 0
+func TestGroupingReader_SpillQuality(t *testing.T) {
+	accuracy, speed := 12.5, 0.0
+	input := pointsOf(2, 1, 2, 1)
+	input[0].Accuracy, input[0].Speed, input[0].Provider = &accuracy, &speed, "gps"
+	input[1].Bearing = &speed
+	reader := NewGroupingReader(&fakeReader{points: input}, 1, t.TempDir())
+
+	pointChan := make(chan *models.DeliveryPoint, 10)
+	assert.NoError(t, reader.StreamDeliveryPoints(pointChan, zap.NewNop()))
+
+	quality := make(map[int64]models.DeliveryPoint)
+	for point := range pointChan {
+		quality[point.Timestamp] = *point
+	}
+	assert.Equal(t, &accuracy, quality[0].Accuracy)
+	assert.Equal(t, &speed, quality[0].Speed)
+	assert.Equal(t, "gps", quality[0].Provider)
+	assert.Nil(t, quality[0].Bearing)
+	assert.Equal(t, &speed, quality[1].Bearing)
+	assert.Nil(t, quality[1].Speed)
+	assert.Nil(t, quality[2].Accuracy)
+}
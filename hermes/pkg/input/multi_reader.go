@@ -0,0 +1,210 @@
+package input
+
+import (
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// ReaderFactory creates the DeliveryReader of a single input file
+type ReaderFactory func(path string) DeliveryReader
+
+// MultiReader streams the delivery points of several files as a single input
+// files are read one after the other in the given order, unless parallelism is more than one.
+// in parallel mode each file is read by its own goroutine and the points of a delivery are
+// pushed to the channel together, so deliveries are not interleaved as long as a delivery
+// does not straddle two files
+type MultiReader struct {
+	Paths       []string
+	Parallelism int
+	newReader   ReaderFactory
+	resume      *models.PointOrigin
+	rejections  RejectionSink
+}
+
+// fileResult holds the outcome of streaming a single file
+type fileResult struct {
+	path    string
+	points  int64
+	firstID int
+	lastID  int
+	err     error
+}
+
+// NewMultiReader creates a new MultiReader over the paths, using newReader to read each file
+func NewMultiReader(paths []string, parallelism int, newReader ReaderFactory) DeliveryReader {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	return &MultiReader{
+		Paths:       paths,
+		Parallelism: parallelism,
+		newReader:   newReader,
+	}
+}
+
+// ResumeAt makes the reader skip the files before the file of the origin, and start that file from the origin
+func (m *MultiReader) ResumeAt(origin models.PointOrigin) {
+	m.resume = &origin
+}
+
+// SetRejectionSink makes the reader of each file report its rejected rows to the sink
+func (m *MultiReader) SetRejectionSink(sink RejectionSink) {
+	m.rejections = sink
+}
+
+// StreamDeliveryPoints streams the points of all the files into the channel and closes it at the end
+func (m *MultiReader) StreamDeliveryPoints(publisherChan chan *models.DeliveryPoint, log *zap.Logger) error {
+	defer close(publisherChan)
+
+	startTime := time.Now()
+	paths, err := m.remainingPaths()
+	if err != nil {
+		log.Error("Failed to resume input files", zap.Error(err))
+		return err
+	}
+	if len(paths) < len(m.Paths) {
+		log.Info("Skipping input files completed by a previous run", zap.Strings("files", m.Paths[:len(m.Paths)-len(paths)]))
+	}
+	results := make([]fileResult, len(paths))
+
+	if m.Parallelism == 1 {
+		for i, path := range paths {
+			results[i] = m.streamFile(path, log, func(points []*models.DeliveryPoint) {
+				for _, point := range points {
+					publisherChan <- point
+				}
+			})
+		}
+	} else {
+		var mutex sync.Mutex
+		var wg sync.WaitGroup
+		semaphore := make(chan struct{}, m.Parallelism)
+
+		for i, path := range paths {
+			wg.Add(1)
+			semaphore <- struct{}{}
+			go func(i int, path string) {
+				defer wg.Done()
+				defer func() { <-semaphore }()
+
+				results[i] = m.streamFile(path, log, func(points []*models.DeliveryPoint) {
+					// a whole delivery is pushed at once to keep its points contiguous
+					mutex.Lock()
+					defer mutex.Unlock()
+					for _, point := range points {
+						publisherChan <- point
+					}
+				})
+			}(i, path)
+		}
+		wg.Wait()
+		m.checkStraddlingDeliveries(results, log)
+	}
+
+	var totalPoints int64
+	var failedFiles []string
+	for _, result := range results {
+		totalPoints += result.points
+		if result.err != nil {
+			failedFiles = append(failedFiles, result.path)
+		}
+	}
+
+	log.Info("All input files streamed",
+		zap.Int("files", len(paths)),
+		zap.Int("failed_files", len(failedFiles)),
+		zap.Int64("total_points", totalPoints),
+		zap.String("Duration", fmt.Sprintf("%s", time.Now().Sub(startTime))))
+
+	if len(failedFiles) > 0 {
+		return fmt.Errorf("failed to read %d input files: %v", len(failedFiles), failedFiles)
+	}
+	return nil
+}
+
+// remainingPaths returns the paths left to read, starting from the file of the resumed origin
+func (m *MultiReader) remainingPaths() ([]string, error) {
+	if m.resume == nil {
+		return m.Paths, nil
+	}
+	for i, path := range m.Paths {
+		if path == m.resume.Source {
+			return m.Paths[i:], nil
+		}
+	}
+	return nil, fmt.Errorf("resumed file %s is not one of the input files", m.resume.Source)
+}
+
+// streamFile reads a single file and hands its points to push, grouped by contiguous delivery ID
+func (m *MultiReader) streamFile(path string, log *zap.Logger, push func(points []*models.DeliveryPoint)) fileResult {
+	startTime := time.Now()
+	result := fileResult{path: path}
+
+	fileChan := make(chan *models.DeliveryPoint, 100)
+	errChan := make(chan error, 1)
+	reader := m.newReader(path)
+	if quarantinable, ok := reader.(Quarantinable); ok && m.rejections != nil {
+		quarantinable.SetRejectionSink(m.rejections)
+	}
+	if m.resume != nil && m.resume.Source == path {
+		resumable, ok := reader.(Resumable)
+		if !ok {
+			result.err = fmt.Errorf("the reader of %s can not resume", path)
+			log.Error("Failed to read input file", zap.String("file", path), zap.Error(result.err))
+			return result
+		}
+		resumable.ResumeAt(*m.resume)
+	}
+	go func() {
+		errChan <- reader.StreamDeliveryPoints(fileChan, log)
+	}()
+
+	var batch []*models.DeliveryPoint
+	for point := range fileChan {
+		if result.points == 0 {
+			result.firstID = point.DeliveryID
+		}
+		if len(batch) > 0 && batch[0].DeliveryID != point.DeliveryID {
+			push(batch)
+			batch = nil
+		}
+		batch = append(batch, point)
+		result.lastID = point.DeliveryID
+		result.points++
+	}
+	if len(batch) > 0 {
+		push(batch)
+	}
+
+	result.err = <-errChan
+	if result.err != nil {
+		log.Error("Failed to read input file", zap.String("file", path), zap.Error(result.err))
+	} else {
+		log.Info("Input file completed",
+			zap.String("file", path),
+			zap.Int64("points", result.points),
+			zap.String("Duration", fmt.Sprintf("%s", time.Now().Sub(startTime))))
+	}
+	return result
+}
+
+// checkStraddlingDeliveries warns about deliveries which may have been split between two files in parallel mode
+func (m *MultiReader) checkStraddlingDeliveries(results []fileResult, log *zap.Logger) {
+	lastIDs := make(map[int]string)
+	for _, result := range results {
+		if result.points > 0 {
+			lastIDs[result.lastID] = result.path
+		}
+	}
+	for _, result := range results {
+		if path, ok := lastIDs[result.firstID]; ok && result.points > 0 && path != result.path {
+			log.Warn("Delivery straddles two input files and may be split, use parallel_files: 1 for such inputs",
+				zap.Int("delivery_id", result.firstID),
+				zap.String("ends_in", path),
+				zap.String("starts_in", result.path))
+		}
+	}
+}
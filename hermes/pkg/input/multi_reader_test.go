@@ -0,0 +1,157 @@
+package input
+
+import (
+	"errors"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeReader streams a fixed list of points, pretending to read a file
+type fakeReader struct {
+	points []*models.DeliveryPoint
+	err    error
+}
+
+func (f *fakeReader) StreamDeliveryPoints(publisherChan chan *models.DeliveryPoint, log *zap.Logger) error {
+	defer close(publisherChan)
+	for _, point := range f.points {
+		publisherChan <- point
+	}
+	return f.err
+}
+
+// pointsOf creates a point for each of the given delivery IDs
+func pointsOf(ids ...int) []*models.DeliveryPoint {
+	points := make([]*models.DeliveryPoint, len(ids))
+	for i, id := range ids {
+		points[i] = &models.DeliveryPoint{DeliveryID: id, Timestamp: int64(i)}
+	}
+	return points
+}
+
+// collect streams all the points of the reader and returns their delivery IDs
+func collect(t *testing.T, reader DeliveryReader) ([]int, error) {
+	pointChan := make(chan *models.DeliveryPoint, 10)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- reader.StreamDeliveryPoints(pointChan, zap.NewNop())
+	}()
+
+	var ids []int
+	for point := range pointChan {
+		ids = append(ids, point.DeliveryID)
+	}
+	return ids, <-errChan
+}
+
+func TestMultiReader_Sequential(t *testing.T) {
+	files := map[string]*fakeReader{
+		"chunk_0.csv": {points: pointsOf(1, 1, 2)},
+		"chunk_1.csv": {points: pointsOf(2, 3, 3)},
+	}
+	reader := NewMultiReader([]string{"chunk_0.csv", "chunk_1.csv"}, 1, func(path string) DeliveryReader {
+		return files[path]
+	})
+
+	ids, err := collect(t, reader)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 1, 2, 2, 3, 3}, ids, "files should be streamed in order")
+}
+
+func TestMultiReader_ParallelKeepsDeliveriesContiguous(t *testing.T) {
+	files := map[string]*fakeReader{
+		"chunk_0.csv": {points: pointsOf(1, 1, 1, 2, 2, 3)},
+		"chunk_1.csv": {points: pointsOf(4, 4, 5, 5, 5, 6)},
+		"chunk_2.csv": {points: pointsOf(7, 8, 8, 9)},
+	}
+	reader := NewMultiReader([]string{"chunk_0.csv", "chunk_1.csv", "chunk_2.csv"}, 3, func(path string) DeliveryReader {
+		return files[path]
+	})
+
+	ids, err := collect(t, reader)
+	assert.NoError(t, err)
+	assert.Len(t, ids, 16)
+
+	// every delivery should appear in a single contiguous run
+	seen := make(map[int]bool)
+	for i, id := range ids {
+		if i > 0 && ids[i-1] == id {
+			continue
+		}
+		assert.False(t, seen[id], "delivery %d is interleaved with another delivery", id)
+		seen[id] = true
+	}
+}
+
+func TestMultiReader_FailedFile(t *testing.T) {
+	files := map[string]*fakeReader{
+		"chunk_0.csv": {points: pointsOf(1), err: errors.New("broken file")},
+		"chunk_1.csv": {points: pointsOf(2)},
+	}
+	reader := NewMultiReader([]string{"chunk_0.csv", "chunk_1.csv"}, 1, func(path string) DeliveryReader {
+		return files[path]
+	})
+
+	ids, err := collect(t, reader)
+	assert.Error(t, err, "a failed file should be reported")
+	assert.Equal(t, []int{1, 2}, ids, "the remaining files should still be streamed")
+}
+
+// resumableReader is a fakeReader which skips the points before the offset it is resumed at
+type resumableReader struct {
+	fakeReader
+}
+
+func (r *resumableReader) ResumeAt(origin models.PointOrigin) {
+	r.points = r.points[origin.Offset:]
+}
+
+func TestMultiReader_Resume(t *testing.T) {
+	files := map[string]*resumableReader{
+		"chunk_0.csv": {fakeReader{points: pointsOf(1, 1, 2)}},
+		"chunk_1.csv": {fakeReader{points: pointsOf(2, 3, 3, 4)}},
+		"chunk_2.csv": {fakeReader{points: pointsOf(5)}},
+	}
+	reader := NewMultiReader([]string{"chunk_0.csv", "chunk_1.csv", "chunk_2.csv"}, 1, func(path string) DeliveryReader {
+		return files[path]
+	}).(Resumable)
+	reader.ResumeAt(models.PointOrigin{Source: "chunk_1.csv", Offset: 1})
+
+	ids, err := collect(t, reader)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{3, 3, 4, 5}, ids, "files and points before the origin should be skipped")
+
+	reader.ResumeAt(models.PointOrigin{Source: "other.csv"})
+	_, err = collect(t, reader)
+	assert.Error(t, err, "an origin outside of the input files should fail")
+}
+
+func TestResolvePaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"chunk_10.csv", "chunk_2.csv", "chunk_1.csv.gz", ".hidden"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	paths, err := ResolvePaths(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "chunk_1.csv.gz"),
+		filepath.Join(dir, "chunk_2.csv"),
+		filepath.Join(dir, "chunk_10.csv"),
+	}, paths, "directory files should be in natural order")
+
+	paths, err = ResolvePaths(filepath.Join(dir, "*.csv"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "chunk_2.csv"), filepath.Join(dir, "chunk_10.csv")}, paths)
+
+	paths, err = ResolvePaths(filepath.Join(dir, "chunk_2.csv"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "chunk_2.csv")}, paths)
+
+	_, err = ResolvePaths(filepath.Join(dir, "missing_*.csv"))
+	assert.Error(t, err, "an empty match should fail")
+}
@@ -0,0 +1,196 @@
+package ndjson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"go.uber.org/zap"
+	"io"
+	"strconv"
+)
+
+// DeliveryReader implements the input interface for working with JSON Lines (NDJSON) files
+// each line holds a single point: {"id_delivery":1,"lat":35.7,"lng":51.4,"timestamp":1723697700}, optionally
+// with the quality of its fix: "accuracy", "speed", "bearing" and "provider"
+type DeliveryReader struct {
+	FilePath         string
+	ProgressInterval int
+	stream           io.Reader
+	resume           *models.PointOrigin
+	rejections       input.RejectionSink
+	stats            input.Stats
+}
+
+// pointRecord is a single line of the file, values are kept raw so both numbers and numeric strings are accepted
+type pointRecord struct {
+	DeliveryID json.RawMessage `json:"id_delivery"`
+	Latitude   json.RawMessage `json:"lat"`
+	Longitude  json.RawMessage `json:"lng"`
+	Timestamp  json.RawMessage `json:"timestamp"`
+	Accuracy   json.RawMessage `json:"accuracy"`
+	Speed      json.RawMessage `json:"speed"`
+	Bearing    json.RawMessage `json:"bearing"`
+	Provider   json.RawMessage `json:"provider"`
+}
+
+// NewDeliveryReader creates a new NDJSON reader with the provided file path
+func NewDeliveryReader(filePath string, progressInterval int) input.DeliveryReader {
+	return &DeliveryReader{
+		FilePath:         filePath,
+		ProgressInterval: progressInterval,
+	}
+}
+
+// NewStreamReader creates a new NDJSON reader over a stream, such as a request body, instead of a file
+func NewStreamReader(name string, stream io.Reader, progressInterval int) *DeliveryReader {
+	return &DeliveryReader{
+		FilePath:         name,
+		ProgressInterval: progressInterval,
+		stream:           stream,
+	}
+}
+
+// Stats returns the number of lines read and rejected so far
+func (r *DeliveryReader) Stats() input.Stats {
+	return r.stats
+}
+
+// ResumeAt makes the reader start from the line of the origin, instead of the beginning of the file
+func (r *DeliveryReader) ResumeAt(origin models.PointOrigin) {
+	r.resume = &origin
+}
+
+// SetRejectionSink makes the reader report its rejected lines to the sink
+func (r *DeliveryReader) SetRejectionSink(sink input.RejectionSink) {
+	r.rejections = sink
+}
+
+// StreamDeliveryPoints reads the file line by line, processes each line, and pushes it to channel
+// the channel is closed once the file is read, or reading it fails
+func (r *DeliveryReader) StreamDeliveryPoints(publisherChan chan *models.DeliveryPoint, log *zap.Logger) error {
+	defer close(publisherChan)
+
+	source, err := r.openSource()
+	if err != nil {
+		log.Error("failed to open file", zap.Error(err))
+		return err
+	}
+	defer source.Close()
+
+	var offset int64
+	lineNumber := 0
+	if r.resume != nil && r.resume.Offset > 0 {
+		offset, lineNumber = r.resume.Offset, int(r.resume.Line-1)
+		if err := source.SkipTo(offset); err != nil {
+			log.Error("Failed to resume file", zap.Error(err))
+			return err
+		}
+	}
+
+	log.Info("Streaming NDJSON file",
+		zap.String("file", source.Path),
+		zap.String("compression", string(source.Compression)),
+		zap.Int64("offset", offset))
+
+	reader := bufio.NewReaderSize(source, 64*1024)
+	progress := input.NewProgress(source, r.ProgressInterval, log)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			log.Error("Failed to read line", zap.Error(err))
+			return err
+		}
+		lineNumber++
+		lineOffset := offset
+		offset += int64(len(line))
+
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			progress.Row()
+			r.stats.Rows++
+			point, reason, detail := parseLine(line, lineNumber, log)
+			if point != nil {
+				point.Origin = &models.PointOrigin{Source: r.FilePath, Line: int64(lineNumber), Offset: lineOffset}
+				if r.rejections != nil {
+					point.Origin.Raw = string(line)
+				}
+				publisherChan <- point
+			} else {
+				r.stats.Rejected++
+				if r.rejections != nil {
+					r.rejections.Reject(input.Rejection{Source: r.FilePath, Line: int64(lineNumber), Row: string(line), Reason: reason, Detail: detail})
+				}
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+
+	progress.Done()
+	log.Info("NDJSON streaming and publishing completed successfully")
+	return nil
+}
+
+// openSource opens the file, or wraps the stream the reader was created with
+func (r *DeliveryReader) openSource() (*input.Source, error) {
+	if r.stream != nil {
+		return input.NewStreamSource(r.FilePath, r.stream)
+	}
+	return input.OpenSource(r.FilePath)
+}
+
+// parseLine builds a DeliveryPoint from a line, invalid lines are logged and skipped with the reason of rejecting them
+func parseLine(line []byte, lineNumber int, log *zap.Logger) (*models.DeliveryPoint, string, string) {
+	var record pointRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		log.Warn("Invalid JSON line", zap.Int("line", lineNumber), zap.Error(err))
+		return nil, input.ReasonParseError, err.Error()
+	}
+
+	id, err := strconv.Atoi(rawValue(record.DeliveryID))
+	if err != nil {
+		log.Warn("Invalid delivery ID", zap.String("value", string(record.DeliveryID)), zap.Int("line", lineNumber))
+		return nil, input.ReasonInvalidDeliveryID, ""
+	}
+	lat, err := strconv.ParseFloat(rawValue(record.Latitude), 64)
+	if err != nil {
+		log.Warn("Invalid latitude", zap.String("value", string(record.Latitude)), zap.Int("delivery_id", id), zap.Int("line", lineNumber))
+		return nil, input.ReasonInvalidLatitude, ""
+	}
+	lng, err := strconv.ParseFloat(rawValue(record.Longitude), 64)
+	if err != nil {
+		log.Warn("Invalid longitude", zap.String("value", string(record.Longitude)), zap.Int("delivery_id", id), zap.Int("line", lineNumber))
+		return nil, input.ReasonInvalidLongitude, ""
+	}
+	timestamp, err := strconv.ParseInt(rawValue(record.Timestamp), 10, 64)
+	if err != nil {
+		log.Warn("Invalid timestamp", zap.String("value", string(record.Timestamp)), zap.Int("delivery_id", id), zap.Int("line", lineNumber))
+		return nil, input.ReasonInvalidTimestamp, ""
+	}
+
+	return &models.DeliveryPoint{
+		DeliveryID: id,
+		Latitude:   lat,
+		Longitude:  lng,
+		Timestamp:  timestamp,
+		Accuracy:   input.ParseQuality(rawValue(record.Accuracy)),
+		Speed:      input.ParseQuality(rawValue(record.Speed)),
+		Bearing:    input.ParseQuality(rawValue(record.Bearing)),
+		Provider:   rawValue(record.Provider),
+	}, "", ""
+}
+
+// rawValue returns the text of a JSON number, or the content of a JSON string
+func rawValue(raw json.RawMessage) string {
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value
+	}
+	return string(raw)
+}
@@ -0,0 +1,65 @@
+package ndjson
+
+import (
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStreamDeliveryPoints(t *testing.T) {
+	content := `{"id_delivery":1,"lat":35.706552,"lng":51.412262,"timestamp":1723697700}
+{"id_delivery":"1","lat":"35.702591","lng":"51.412704","timestamp":"1723697730"}
+
+not a json line
+{"id_delivery":2,"lat":35.7,"timestamp":1723697790}
+{"id_delivery":2,"lat":35.7,"lng":51.4,"timestamp":1723697820,"accuracy":5,"speed":"8.5","bearing":-1,"provider":"fused"}`
+	path := filepath.Join(t.TempDir(), "points.jsonl")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	pointChan := make(chan *models.DeliveryPoint, 10)
+	err := NewDeliveryReader(path, 0).StreamDeliveryPoints(pointChan, zap.NewNop())
+	assert.NoError(t, err)
+
+	var points []models.DeliveryPoint
+	for point := range pointChan {
+		// origins are checked by the resume tests
+		point.Origin = nil
+		points = append(points, *point)
+	}
+
+	// the bearing of -1 is unknown
+	accuracy, speed := 5.0, 8.5
+	assert.Equal(t, []models.DeliveryPoint{
+		{DeliveryID: 1, Latitude: 35.706552, Longitude: 51.412262, Timestamp: 1723697700},
+		{DeliveryID: 1, Latitude: 35.702591, Longitude: 51.412704, Timestamp: 1723697730},
+		{DeliveryID: 2, Latitude: 35.7, Longitude: 51.4, Timestamp: 1723697820, Accuracy: &accuracy, Speed: &speed, Provider: "fused"},
+	}, points, "invalid lines and lines with missing fields should be skipped")
+}
+
+func TestStreamDeliveryPoints_Resume(t *testing.T) {
+	content := `{"id_delivery":1,"lat":35.7,"lng":51.4,"timestamp":1000}
+
+{"id_delivery":2,"lat":35.7,"lng":51.4,"timestamp":1000}
+{"id_delivery":2,"lat":35.8,"lng":51.5,"timestamp":1100}
+`
+	path := filepath.Join(t.TempDir(), "points.jsonl")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	reader := NewDeliveryReader(path, 0).(*DeliveryReader)
+	reader.ResumeAt(models.PointOrigin{Source: path, Line: 3, Offset: 58})
+	pointChan := make(chan *models.DeliveryPoint, 10)
+	assert.NoError(t, reader.StreamDeliveryPoints(pointChan, zap.NewNop()))
+
+	var origins []models.PointOrigin
+	for point := range pointChan {
+		assert.Equal(t, 2, point.DeliveryID)
+		origins = append(origins, *point.Origin)
+	}
+	assert.Equal(t, []models.PointOrigin{
+		{Source: path, Line: 3, Offset: 58},
+		{Source: path, Line: 4, Offset: 115},
+	}, origins)
+}
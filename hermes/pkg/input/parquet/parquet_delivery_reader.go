@@ -0,0 +1,309 @@
+package parquet
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"github.com/parquet-go/parquet-go"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBatchSize is the number of rows read at once, when no batch size is configured
+const DefaultBatchSize = 1024
+
+// DeliveryReader implements the input interface for working with Apache Parquet files
+// the file is read row group by row group in batches of rows, so the memory used does not depend on the file size
+type DeliveryReader struct {
+	FilePath   string
+	Columns    input.Columns
+	BatchSize  int
+	resume     *models.PointOrigin
+	rejections input.RejectionSink
+}
+
+// columnIndex holds the leaf column index of each required column in the file schema, and of the optional
+// columns (-1 when absent)
+type columnIndex struct {
+	deliveryID int
+	latitude   int
+	longitude  int
+	timestamp  int
+	accuracy   int
+	speed      int
+	bearing    int
+	provider   int
+}
+
+// NewDeliveryReader creates a new Parquet reader with the provided file path and column names
+func NewDeliveryReader(filePath string, columns input.Columns, batchSize int) input.DeliveryReader {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	return &DeliveryReader{
+		FilePath:  filePath,
+		Columns:   columns.WithDefaults(),
+		BatchSize: batchSize,
+	}
+}
+
+// ResumeAt makes the reader start from the row of the origin, instead of the beginning of the file
+func (r *DeliveryReader) ResumeAt(origin models.PointOrigin) {
+	r.resume = &origin
+}
+
+// SetRejectionSink makes the reader report its rejected rows to the sink
+func (r *DeliveryReader) SetRejectionSink(sink input.RejectionSink) {
+	r.rejections = sink
+}
+
+// StreamDeliveryPoints reads the file row group by row group, processes each row, and pushes it to channel
+// the channel is closed once the file is read, or reading it fails
+func (r *DeliveryReader) StreamDeliveryPoints(publisherChan chan *models.DeliveryPoint, log *zap.Logger) error {
+	defer close(publisherChan)
+
+	file, err := os.Open(r.FilePath)
+	if err != nil {
+		log.Error("failed to open file", zap.Error(err))
+		return fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		log.Error("failed to stat file", zap.Error(err))
+		return fmt.Errorf("failed to stat file: %v", err)
+	}
+
+	parquetFile, err := parquet.OpenFile(file, info.Size())
+	if err != nil {
+		log.Error("failed to open parquet file", zap.Error(err))
+		return fmt.Errorf("failed to open parquet file: %v", err)
+	}
+
+	index, err := r.resolveColumns(parquetFile.Schema())
+	if err != nil {
+		log.Error("Invalid parquet schema", zap.String("file", r.FilePath), zap.Error(err))
+		return err
+	}
+
+	log.Info("Streaming Parquet file",
+		zap.String("file", r.FilePath),
+		zap.Int("row_groups", len(parquetFile.RowGroups())),
+		zap.Int64("total_rows", parquetFile.NumRows()))
+
+	startTime := time.Now()
+	rowBuffer := make([]parquet.Row, r.BatchSize)
+	var readRows, resumeRow int64
+	if r.resume != nil {
+		resumeRow = r.resume.Offset
+	}
+
+	for i, rowGroup := range parquetFile.RowGroups() {
+		// row groups before the resumed row are skipped, and the row group holding it is seeked
+		if resumeRow >= readRows+rowGroup.NumRows() {
+			readRows += rowGroup.NumRows()
+			continue
+		}
+		rows := rowGroup.Rows()
+		if resumeRow > readRows {
+			if err := rows.SeekToRow(resumeRow - readRows); err != nil {
+				rows.Close()
+				log.Error("Failed to resume file", zap.Int("row_group", i), zap.Error(err))
+				return err
+			}
+			readRows = resumeRow
+		}
+
+		for {
+			n, err := rows.ReadRows(rowBuffer)
+			for j, row := range rowBuffer[:n] {
+				rowNumber := readRows + int64(j)
+				origin := &models.PointOrigin{Source: r.FilePath, Line: rowNumber + 1, Offset: rowNumber}
+				if r.rejections != nil {
+					origin.Raw = rawRow(row)
+				}
+
+				point, reason, detail := parseRow(row, index, log)
+				if point == nil {
+					if r.rejections != nil {
+						r.rejections.Reject(input.Rejection{Source: r.FilePath, Line: origin.Line, Row: origin.Raw, Reason: reason, Detail: detail})
+					}
+					continue
+				}
+				point.Origin = origin
+				publisherChan <- point
+			}
+			readRows += int64(n)
+
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				rows.Close()
+				log.Error("Failed to read rows", zap.Int("row_group", i), zap.Error(err))
+				return err
+			}
+		}
+		rows.Close()
+
+		log.Info("Reading input",
+			zap.String("file", r.FilePath),
+			zap.Int("row_group", i),
+			zap.Int64("rows", readRows),
+			zap.Int64("total_rows", parquetFile.NumRows()),
+			zap.String("Duration", fmt.Sprintf("%s", time.Now().Sub(startTime))))
+	}
+
+	log.Info("Parquet streaming and publishing completed successfully", zap.String("file", r.FilePath))
+	return nil
+}
+
+// resolveColumns finds the configured columns in the file schema, the optional columns may be missing
+func (r *DeliveryReader) resolveColumns(schema *parquet.Schema) (columnIndex, error) {
+	var missing []string
+	find := func(name string) int {
+		leaf, ok := schema.Lookup(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return leaf.ColumnIndex
+	}
+	optional := func(name string) int {
+		if leaf, ok := schema.Lookup(name); ok {
+			return leaf.ColumnIndex
+		}
+		return -1
+	}
+
+	index := columnIndex{
+		deliveryID: find(r.Columns.DeliveryID),
+		latitude:   find(r.Columns.Latitude),
+		longitude:  find(r.Columns.Longitude),
+		timestamp:  find(r.Columns.Timestamp),
+		accuracy:   optional(r.Columns.Accuracy),
+		speed:      optional(r.Columns.Speed),
+		bearing:    optional(r.Columns.Bearing),
+		provider:   optional(r.Columns.Provider),
+	}
+	if len(missing) > 0 {
+		return index, fmt.Errorf("missing required columns %v in schema %s", missing, schema)
+	}
+	return index, nil
+}
+
+// parseRow builds a DeliveryPoint from a row, invalid rows are logged and skipped with the reason of rejecting them
+func parseRow(row parquet.Row, index columnIndex, log *zap.Logger) (*models.DeliveryPoint, string, string) {
+	id, err := intValue(columnValue(row, index.deliveryID))
+	if err != nil {
+		log.Warn("Invalid delivery ID", zap.Error(err))
+		return nil, input.ReasonInvalidDeliveryID, err.Error()
+	}
+	lat, err := floatValue(columnValue(row, index.latitude))
+	if err != nil {
+		log.Warn("Invalid latitude", zap.Error(err), zap.Int64("delivery_id", id))
+		return nil, input.ReasonInvalidLatitude, err.Error()
+	}
+	lng, err := floatValue(columnValue(row, index.longitude))
+	if err != nil {
+		log.Warn("Invalid longitude", zap.Error(err), zap.Int64("delivery_id", id))
+		return nil, input.ReasonInvalidLongitude, err.Error()
+	}
+	timestamp, err := intValue(columnValue(row, index.timestamp))
+	if err != nil {
+		log.Warn("Invalid timestamp", zap.Error(err), zap.Int64("delivery_id", id))
+		return nil, input.ReasonInvalidTimestamp, err.Error()
+	}
+
+	point := &models.DeliveryPoint{
+		DeliveryID: int(id),
+		Latitude:   lat,
+		Longitude:  lng,
+		Timestamp:  timestamp,
+		Accuracy:   qualityValue(row, index.accuracy),
+		Speed:      qualityValue(row, index.speed),
+		Bearing:    qualityValue(row, index.bearing),
+	}
+	if index.provider >= 0 {
+		if value := columnValue(row, index.provider); !value.IsNull() && value.Kind() == parquet.ByteArray {
+			point.Provider = strings.TrimSpace(string(value.ByteArray()))
+		}
+	}
+	return point, "", ""
+}
+
+// qualityValue returns the value of an optional quality column, nil when the column is absent, or its value is
+// null, invalid or negative
+func qualityValue(row parquet.Row, column int) *float64 {
+	if column < 0 {
+		return nil
+	}
+	number, err := floatValue(columnValue(row, column))
+	if err != nil || number < 0 {
+		return nil
+	}
+	return &number
+}
+
+// rawRow formats the values of a row, separated by commas
+func rawRow(row parquet.Row) string {
+	values := make([]string, len(row))
+	for i, value := range row {
+		values[i] = value.String()
+	}
+	return strings.Join(values, ",")
+}
+
+// columnValue returns the value of a column in a row, rows of flat schemas hold one value per column in order
+func columnValue(row parquet.Row, column int) parquet.Value {
+	if column < len(row) && row[column].Column() == column {
+		return row[column]
+	}
+	for _, value := range row {
+		if value.Column() == column {
+			return value
+		}
+	}
+	return parquet.Value{}
+}
+
+// intValue converts an integer, or a numeric string, parquet value to int64
+func intValue(value parquet.Value) (int64, error) {
+	if value.IsNull() {
+		return 0, errors.New("null value")
+	}
+	switch value.Kind() {
+	case parquet.Int32:
+		return int64(value.Int32()), nil
+	case parquet.Int64:
+		return value.Int64(), nil
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		return strconv.ParseInt(string(value.ByteArray()), 10, 64)
+	}
+	return 0, fmt.Errorf("unsupported value %v", value)
+}
+
+// floatValue converts a floating point, integer or numeric string parquet value to float64
+func floatValue(value parquet.Value) (float64, error) {
+	if value.IsNull() {
+		return 0, errors.New("null value")
+	}
+	switch value.Kind() {
+	case parquet.Float:
+		return float64(value.Float()), nil
+	case parquet.Double:
+		return value.Double(), nil
+	case parquet.Int32:
+		return float64(value.Int32()), nil
+	case parquet.Int64:
+		return float64(value.Int64()), nil
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		return strconv.ParseFloat(string(value.ByteArray()), 64)
+	}
+	return 0, fmt.Errorf("unsupported value %v", value)
+}
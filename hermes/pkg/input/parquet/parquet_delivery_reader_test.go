@@ -0,0 +1,95 @@
+package parquet
+
+import (
+	"github.com/aref81/snappbox_fare_estimator/hermes/pkg/input"
+	"github.com/aref81/snappbox_fare_estimator/shared/models"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// lakeRow mimics a data lake export, with different column names, types and an extra column
+type lakeRow struct {
+	Courier   string  `parquet:"courier"`
+	Order     int32   `parquet:"order_id"`
+	Latitude  float64 `parquet:"latitude"`
+	Longitude float32 `parquet:"longitude"`
+	Timestamp int64   `parquet:"ts"`
+}
+
+func TestStreamDeliveryPoints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "points.parquet")
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+
+	// small row groups, so the file is read in several groups and batches
+	writer := parquet.NewGenericWriter[lakeRow](file, parquet.MaxRowsPerRowGroup(2))
+	_, err = writer.Write([]lakeRow{
+		{Courier: "c1", Order: 1, Latitude: 35.7, Longitude: 51.5, Timestamp: 1723697700},
+		{Courier: "c1", Order: 1, Latitude: 35.8, Longitude: 51.25, Timestamp: 1723697730},
+		{Courier: "c2", Order: 2, Latitude: 35.9, Longitude: 51.75, Timestamp: 1723697760},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	assert.NoError(t, file.Close())
+
+	columns := input.Columns{DeliveryID: "order_id", Latitude: "latitude", Longitude: "longitude", Timestamp: "ts"}
+	pointChan := make(chan *models.DeliveryPoint, 10)
+	err = NewDeliveryReader(path, columns, 1).StreamDeliveryPoints(pointChan, zap.NewNop())
+	assert.NoError(t, err)
+
+	var points []models.DeliveryPoint
+	for point := range pointChan {
+		// origins are checked by the resume tests
+		point.Origin = nil
+		points = append(points, *point)
+	}
+	assert.Equal(t, []models.DeliveryPoint{
+		{DeliveryID: 1, Latitude: 35.7, Longitude: 51.5, Timestamp: 1723697700},
+		{DeliveryID: 1, Latitude: 35.8, Longitude: 51.25, Timestamp: 1723697730},
+		{DeliveryID: 2, Latitude: 35.9, Longitude: 51.75, Timestamp: 1723697760},
+	}, points)
+
+	// the default column names do not exist in this file
+	pointChan = make(chan *models.DeliveryPoint, 10)
+	err = NewDeliveryReader(path, input.Columns{}, 0).StreamDeliveryPoints(pointChan, zap.NewNop())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "missing required columns")
+}
+
+// qualityRow is an export with the optional quality columns, unknown values are null
+type qualityRow struct {
+	DeliveryID int64    `parquet:"id_delivery"`
+	Latitude   float64  `parquet:"lat"`
+	Longitude  float64  `parquet:"lng"`
+	Timestamp  int64    `parquet:"timestamp"`
+	Accuracy   *float32 `parquet:"accuracy,optional"`
+	Speed      *float64 `parquet:"speed,optional"`
+	Provider   *string  `parquet:"provider,optional"`
+}
+
+func TestStreamDeliveryPoints_Quality(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "points.parquet")
+	accuracy, speed, provider := float32(12.5), 0.0, "network"
+	assert.NoError(t, parquet.WriteFile(path, []qualityRow{
+		{DeliveryID: 1, Latitude: 35.7, Longitude: 51.4, Timestamp: 1723697700, Accuracy: &accuracy, Speed: &speed, Provider: &provider},
+		{DeliveryID: 1, Latitude: 35.8, Longitude: 51.5, Timestamp: 1723697730},
+	}))
+
+	pointChan := make(chan *models.DeliveryPoint, 10)
+	assert.NoError(t, NewDeliveryReader(path, input.Columns{}, 0).StreamDeliveryPoints(pointChan, zap.NewNop()))
+
+	var points []models.DeliveryPoint
+	for point := range pointChan {
+		point.Origin = nil
+		points = append(points, *point)
+	}
+	expectedAccuracy := 12.5
+	assert.Equal(t, []models.DeliveryPoint{
+		{DeliveryID: 1, Latitude: 35.7, Longitude: 51.4, Timestamp: 1723697700, Accuracy: &expectedAccuracy, Speed: &speed, Provider: "network"},
+		{DeliveryID: 1, Latitude: 35.8, Longitude: 51.5, Timestamp: 1723697730},
+	}, points, "the bearing column is missing, and null values are unknown")
+}
@@ -0,0 +1,82 @@
+package input
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ResolvePaths expands the configured input path into the list of files to read
+// the path may be a single file, a directory (all of its files are read) or a glob pattern.
+// files are returned in natural order, so chunk_2 is read before chunk_10
+func ResolvePaths(path string) ([]string, error) {
+	var paths []string
+
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.IsDir():
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory: %v", err)
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
+				paths = append(paths, filepath.Join(path, entry.Name()))
+			}
+		}
+	case err == nil:
+		paths = []string{path}
+	default:
+		paths, err = filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q: %v", path, err)
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no input files found for %q", path)
+	}
+
+	sort.Slice(paths, func(i, j int) bool {
+		return naturalLess(paths[i], paths[j])
+	})
+	return paths, nil
+}
+
+// naturalLess compares two strings treating the digit sequences in them as numbers
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			numA, restA := splitNumber(a)
+			numB, restB := splitNumber(b)
+			if len(numA) != len(numB) {
+				return len(numA) < len(numB)
+			}
+			if numA != numB {
+				return numA < numB
+			}
+			a, b = restA, restB
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// splitNumber splits the leading digits of s (without leading zeros) from the rest of it
+func splitNumber(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return strings.TrimLeft(s[:i], "0"), s[i:]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
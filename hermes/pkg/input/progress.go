@@ -0,0 +1,66 @@
+package input
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"time"
+)
+
+// DefaultProgressInterval is the number of rows between two progress logs, when no interval is configured
+const DefaultProgressInterval = 100000
+
+// Progress periodically logs the number of rows and bytes read from a Source
+type Progress struct {
+	source    *Source
+	interval  int64
+	rows      int64
+	startTime time.Time
+	log       *zap.Logger
+}
+
+// NewProgress creates a new Progress for the source, logging once every interval rows
+func NewProgress(source *Source, interval int, log *zap.Logger) *Progress {
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	return &Progress{
+		source:    source,
+		interval:  int64(interval),
+		startTime: time.Now(),
+		log:       log,
+	}
+}
+
+// Row records a single row read from the source
+func (p *Progress) Row() {
+	p.rows++
+	if p.rows%p.interval == 0 {
+		p.log.Info("Reading input", p.fields()...)
+	}
+}
+
+// Done logs the final progress of the source
+func (p *Progress) Done() {
+	p.log.Info("Finished reading input", p.fields()...)
+}
+
+// Rows returns the number of rows recorded so far
+func (p *Progress) Rows() int64 {
+	return p.rows
+}
+
+func (p *Progress) fields() []zap.Field {
+	bytesRead := p.source.BytesRead()
+	fields := []zap.Field{
+		zap.String("file", p.source.Path),
+		zap.String("compression", string(p.source.Compression)),
+		zap.Int64("rows", p.rows),
+		zap.Int64("bytes_read", bytesRead),
+		zap.Int64("total_bytes", p.source.Size),
+		zap.String("Duration", fmt.Sprintf("%s", time.Now().Sub(p.startTime))),
+	}
+	if p.source.Size > 0 {
+		fields = append(fields, zap.String("percent", fmt.Sprintf("%.1f%%", float64(bytesRead)*100/float64(p.source.Size))))
+	}
+	return fields
+}
@@ -0,0 +1,166 @@
+package input
+
+import (
+	"encoding/csv"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// reasons of rejecting a row
+const (
+	ReasonMissingColumns      = "missing_columns"
+	ReasonParseError          = "parse_error"
+	ReasonInvalidDeliveryID   = "invalid_delivery_id"
+	ReasonInvalidLatitude     = "invalid_latitude"
+	ReasonInvalidLongitude    = "invalid_longitude"
+	ReasonInvalidTimestamp    = "invalid_timestamp"
+	ReasonZeroTimeDifference  = "zero_time_difference"
+	ReasonSpeedLimitExceeded  = "speed_limit_exceeded"
+	ReasonTimeGapExceeded     = "time_gap_exceeded"
+	ReasonHopDistanceExceeded = "hop_distance_exceeded"
+	ReasonOutsideServiceArea  = "outside_service_area"
+	ReasonAccuracyExceeded    = "accuracy_exceeded"
+	ReasonInvalidSegment      = "invalid_segment"
+)
+
+// Rejection is an input row which was rejected by a reader or by the processor
+// Detail is the error of rejecting it, when there is more to it than the reason
+type Rejection struct {
+	Source string
+	Line   int64
+	Row    string
+	Reason string
+	Detail string
+}
+
+// RejectionSink receives the rows rejected while reading an input
+type RejectionSink interface {
+	Reject(rejection Rejection)
+}
+
+// Quarantinable is a DeliveryReader which can report the rows it rejects to a RejectionSink.
+// SetRejectionSink must be called before streaming
+type Quarantinable interface {
+	DeliveryReader
+	SetRejectionSink(sink RejectionSink)
+}
+
+// Quarantine is a RejectionSink which writes the rejected rows to a CSV file, and counts them by reason
+type Quarantine struct {
+	FilePath string
+	mutex    sync.Mutex
+	file     *os.File
+	writer   *csv.Writer
+	counts   map[string]int64
+}
+
+// quarantineHeader is the header of the quarantine file
+var quarantineHeader = []string{"source", "line", "reason", "detail", "row"}
+
+// NewQuarantine creates a new Quarantine writing to the file, if the file path is empty the rejections are only counted.
+// the file is overwritten, unless appendRows is set (e.g. when a run is resumed)
+func NewQuarantine(filePath string, appendRows bool) (*Quarantine, error) {
+	q := &Quarantine{
+		FilePath: filePath,
+		counts:   make(map[string]int64),
+	}
+	if filePath == "" {
+		return q, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create quarantine directory: %v", err)
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendRows {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(filePath, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create quarantine file: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat quarantine file: %v", err)
+	}
+
+	q.file = file
+	q.writer = csv.NewWriter(file)
+	if info.Size() == 0 {
+		if err := q.writer.Write(quarantineHeader); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write quarantine file: %v", err)
+		}
+	}
+	return q, nil
+}
+
+// Reject counts the rejection and writes it to the quarantine file
+func (q *Quarantine) Reject(rejection Rejection) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.counts[rejection.Reason]++
+	if q.writer != nil {
+		// write errors are reported by Close
+		q.writer.Write([]string{
+			rejection.Source,
+			strconv.FormatInt(rejection.Line, 10),
+			rejection.Reason,
+			rejection.Detail,
+			rejection.Row,
+		})
+	}
+}
+
+// Counts returns the number of rejections of each reason
+func (q *Quarantine) Counts() map[string]int64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	counts := make(map[string]int64, len(q.counts))
+	for reason, count := range q.counts {
+		counts[reason] = count
+	}
+	return counts
+}
+
+// Close flushes the quarantine file and logs the summary of the rejections by reason
+func (q *Quarantine) Close(log *zap.Logger) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	reasons := make([]string, 0, len(q.counts))
+	var total int64
+	for reason, count := range q.counts {
+		reasons = append(reasons, reason)
+		total += count
+	}
+	sort.Strings(reasons)
+
+	fields := []zap.Field{zap.Int64("total", total), zap.String("quarantine_file", q.FilePath)}
+	for _, reason := range reasons {
+		fields = append(fields, zap.Int64(reason, q.counts[reason]))
+	}
+	log.Info("Rejected rows by reason", fields...)
+
+	if q.writer == nil {
+		return nil
+	}
+	q.writer.Flush()
+	err := q.writer.Error()
+	if closeErr := q.file.Close(); err == nil {
+		err = closeErr
+	}
+	q.writer = nil
+	if err != nil {
+		return fmt.Errorf("failed to write quarantine file: %v", err)
+	}
+	return nil
+}
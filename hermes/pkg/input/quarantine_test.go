@@ -0,0 +1,48 @@
+package input
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuarantine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quarantine", "rejected.csv")
+	quarantine, err := NewQuarantine(path, false)
+	assert.NoError(t, err)
+
+	quarantine.Reject(Rejection{Source: "a.csv", Line: 3, Row: "bad,35.7,51.4,1000", Reason: ReasonInvalidDeliveryID})
+	quarantine.Reject(Rejection{Source: "a.csv", Line: 7, Row: "1,36.7,52.4,1200", Reason: ReasonSpeedLimitExceeded, Detail: "speed = 412.5"})
+	quarantine.Reject(Rejection{Source: "b.csv", Line: 2, Row: "2,35.7", Reason: ReasonMissingColumns})
+	quarantine.Reject(Rejection{Source: "b.csv", Line: 9, Row: "3,35.7,51.4,x", Reason: ReasonInvalidTimestamp})
+	quarantine.Reject(Rejection{Source: "b.csv", Line: 12, Row: "4,35.7,51.4,y", Reason: ReasonInvalidTimestamp})
+
+	assert.Equal(t, map[string]int64{
+		ReasonInvalidDeliveryID:  1,
+		ReasonSpeedLimitExceeded: 1,
+		ReasonMissingColumns:     1,
+		ReasonInvalidTimestamp:   2,
+	}, quarantine.Counts())
+	assert.NoError(t, quarantine.Close(zap.NewNop()))
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "source,line,reason,detail,row\n"+
+		"a.csv,3,invalid_delivery_id,,\"bad,35.7,51.4,1000\"\n"+
+		"a.csv,7,speed_limit_exceeded,speed = 412.5,\"1,36.7,52.4,1200\"\n"+
+		"b.csv,2,missing_columns,,\"2,35.7\"\n"+
+		"b.csv,9,invalid_timestamp,,\"3,35.7,51.4,x\"\n"+
+		"b.csv,12,invalid_timestamp,,\"4,35.7,51.4,y\"\n", string(content))
+
+	// a resumed run appends to the file, without a second header
+	quarantine, err = NewQuarantine(path, true)
+	assert.NoError(t, err)
+	quarantine.Reject(Rejection{Source: "b.csv", Line: 20, Row: "5", Reason: ReasonMissingColumns})
+	assert.NoError(t, quarantine.Close(zap.NewNop()))
+
+	content, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "b.csv,12,invalid_timestamp,,\"4,35.7,51.4,y\"\nb.csv,20,missing_columns,,5\n")
+}
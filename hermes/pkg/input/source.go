@@ -0,0 +1,175 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Compression is the compression format of an input file
+type Compression string
+
+const (
+	CompressionNone  Compression = "none"
+	CompressionGzip  Compression = "gzip"
+	CompressionBzip2 Compression = "bzip2"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+)
+
+// Source is an input file (or stream) which is transparently decompressed while being read
+type Source struct {
+	Path        string
+	Compression Compression
+	// Size is the size of the file on disk, it is zero for streams
+	Size     int64
+	file     *os.File
+	counter  *countingReader
+	buffered *bufio.Reader
+	reader   io.Reader
+	closers  []io.Closer
+}
+
+// OpenSource opens the file and detects its compression by extension or magic bytes
+func OpenSource(path string) (*Source, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %v", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat file: %v", err)
+	}
+
+	source, err := newSource(path, file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	source.file = file
+	source.closers = append(source.closers, file)
+	return source, nil
+}
+
+// NewStreamSource wraps a stream (e.g. a request body) in a Source, its compression is detected by magic bytes.
+// closing the Source does not close the stream
+func NewStreamSource(name string, stream io.Reader) (*Source, error) {
+	return newSource(name, stream, 0)
+}
+
+// newSource detects the compression of the reader and wraps it in the matching decompressor
+func newSource(path string, reader io.Reader, size int64) (*Source, error) {
+	counter := &countingReader{reader: reader}
+	buffered := bufio.NewReaderSize(counter, 64*1024)
+
+	header, err := buffered.Peek(len(bzip2Magic))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read header of %s: %v", path, err)
+	}
+
+	source := &Source{
+		Path:        path,
+		Compression: DetectCompression(path, header),
+		Size:        size,
+		counter:     counter,
+		buffered:    buffered,
+	}
+
+	switch source.Compression {
+	case CompressionGzip:
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip stream: %v", err)
+		}
+		source.reader = gzipReader
+		source.closers = append(source.closers, gzipReader)
+	case CompressionBzip2:
+		source.reader = bzip2.NewReader(buffered)
+	default:
+		source.reader = buffered
+	}
+
+	return source, nil
+}
+
+// DetectCompression decides the compression of a file, the extension is checked first and magic bytes are used as fallback
+func DetectCompression(path string, header []byte) Compression {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz", ".gzip":
+		return CompressionGzip
+	case ".bz2", ".bzip2":
+		return CompressionBzip2
+	}
+
+	if bytes.HasPrefix(header, gzipMagic) {
+		return CompressionGzip
+	}
+	if bytes.HasPrefix(header, bzip2Magic) {
+		return CompressionBzip2
+	}
+	return CompressionNone
+}
+
+// Read reads the decompressed content of the file
+func (s *Source) Read(p []byte) (int, error) {
+	return s.reader.Read(p)
+}
+
+// SkipTo moves to the offset of the decompressed content, it must be called before anything is read from the Source.
+// plain files are seeked, while compressed files and streams are read and discarded up to the offset
+func (s *Source) SkipTo(offset int64) error {
+	if offset <= 0 {
+		return nil
+	}
+	if s.file != nil && s.Compression == CompressionNone {
+		if _, err := s.file.Seek(offset, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek %s to offset %d: %v", s.Path, offset, err)
+		}
+		s.counter.count = offset
+		s.buffered.Reset(s.counter)
+		return nil
+	}
+	if _, err := io.CopyN(io.Discard, s.reader, offset); err != nil {
+		return fmt.Errorf("failed to skip %s to offset %d: %v", s.Path, offset, err)
+	}
+	return nil
+}
+
+// BytesRead returns the number of (compressed) bytes consumed from the file on disk or the stream
+func (s *Source) BytesRead() int64 {
+	return s.counter.count
+}
+
+// Close closes the decompressor and the underlying file
+func (s *Source) Close() error {
+	var firstErr error
+	for _, closer := range s.closers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
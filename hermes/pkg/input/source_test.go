@@ -0,0 +1,104 @@
+package input
+
+import (
+	"compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const sampleCSV = "id_delivery,lat,lng,timestamp\n1,35.706552,51.412262,1723697700\n1,35.702591,51.412704,1723697730\n"
+
+// writeGzip writes the content to a gzip compressed file in a temp directory
+func writeGzip(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	writer := gzip.NewWriter(file)
+	_, err = writer.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	assert.NoError(t, file.Close())
+	return path
+}
+
+func TestDetectCompression(t *testing.T) {
+	assert.Equal(t, CompressionGzip, DetectCompression("data.csv.gz", nil))
+	assert.Equal(t, CompressionBzip2, DetectCompression("data.csv.BZ2", nil))
+	assert.Equal(t, CompressionNone, DetectCompression("data.csv", []byte("id_")))
+
+	// extension is unknown, magic bytes decide
+	assert.Equal(t, CompressionGzip, DetectCompression("data.bin", []byte{0x1f, 0x8b, 0x08}))
+	assert.Equal(t, CompressionBzip2, DetectCompression("data", []byte("BZh")))
+}
+
+func TestOpenSource_Gzip(t *testing.T) {
+	path := writeGzip(t, "points.csv.gz", sampleCSV)
+
+	source, err := OpenSource(path)
+	assert.NoError(t, err)
+	defer source.Close()
+
+	content, err := io.ReadAll(source)
+	assert.NoError(t, err)
+	assert.Equal(t, CompressionGzip, source.Compression)
+	assert.Equal(t, sampleCSV, string(content))
+	assert.Equal(t, source.Size, source.BytesRead(), "the whole file should be consumed")
+}
+
+func TestOpenSource_GzipWithoutExtension(t *testing.T) {
+	path := writeGzip(t, "points.csv", sampleCSV)
+
+	source, err := OpenSource(path)
+	assert.NoError(t, err)
+	defer source.Close()
+
+	content, err := io.ReadAll(source)
+	assert.NoError(t, err)
+	assert.Equal(t, CompressionGzip, source.Compression, "gzip should be detected by magic bytes")
+	assert.Equal(t, sampleCSV, string(content))
+}
+
+func TestOpenSource_Bzip2(t *testing.T) {
+	source, err := OpenSource(filepath.Join("testdata", "points.csv.bz2"))
+	assert.NoError(t, err)
+	defer source.Close()
+
+	content, err := io.ReadAll(source)
+	assert.NoError(t, err)
+	assert.Equal(t, CompressionBzip2, source.Compression)
+	assert.Equal(t, sampleCSV, string(content))
+}
+
+func TestOpenSource_Plain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "points.csv")
+	assert.NoError(t, os.WriteFile(path, []byte(sampleCSV), 0644))
+
+	source, err := OpenSource(path)
+	assert.NoError(t, err)
+	defer source.Close()
+
+	content, err := io.ReadAll(source)
+	assert.NoError(t, err)
+	assert.Equal(t, CompressionNone, source.Compression)
+	assert.Equal(t, sampleCSV, string(content))
+}
+
+func TestSource_SkipTo(t *testing.T) {
+	offset := int64(len("id_delivery,lat,lng,timestamp\n"))
+	plainPath := filepath.Join(t.TempDir(), "points.csv")
+	assert.NoError(t, os.WriteFile(plainPath, []byte(sampleCSV), 0644))
+
+	for _, path := range []string{plainPath, writeGzip(t, "points.csv.gz", sampleCSV)} {
+		source, err := OpenSource(path)
+		assert.NoError(t, err)
+		assert.NoError(t, source.SkipTo(offset))
+
+		content, err := io.ReadAll(source)
+		assert.NoError(t, err)
+		assert.Equal(t, sampleCSV[offset:], string(content), "%s should be read from the offset", source.Compression)
+		assert.NoError(t, source.Close())
+	}
+}
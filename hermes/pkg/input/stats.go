@@ -0,0 +1,12 @@
+package input
+
+// Stats holds the number of rows read from an input, and how many of them were rejected
+type Stats struct {
+	Rows     int64
+	Rejected int64
+}
+
+// Accepted returns the number of rows which were turned into delivery points
+func (s Stats) Accepted() int64 {
+	return s.Rows - s.Rejected
+}
@@ -0,0 +1,287 @@
+package mapmatch
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/shared/distance"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+	"github.com/paulmach/osm/osmxml"
+	"math"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Highways are the values of the highway tag of the OSM ways the deliveries are driven on
+var Highways = map[string]bool{
+	"motorway":       true,
+	"motorway_link":  true,
+	"trunk":          true,
+	"trunk_link":     true,
+	"primary":        true,
+	"primary_link":   true,
+	"secondary":      true,
+	"secondary_link": true,
+	"tertiary":       true,
+	"tertiary_link":  true,
+	"unclassified":   true,
+	"residential":    true,
+	"living_street":  true,
+	"service":        true,
+	"road":           true,
+}
+
+const (
+	// cellSize is the size (in degrees, about 220 m of latitude) of the cells of the grid indexing the edges
+	cellSize = 0.002
+	// kmPerDegree is the length of a degree of latitude on the sphere of the haversine model
+	kmPerDegree = distance.EarthRadius * math.Pi / 180
+)
+
+// edge is a piece of road between two consecutive nodes of a way
+type edge struct {
+	from, to int32
+	length   float64
+}
+
+// arc is an edge leaving a node
+type arc struct {
+	to     int32
+	length float64
+}
+
+// cell is the key of a cell of the grid
+type cell struct {
+	lat, lon int32
+}
+
+// Graph is the road network of an OSM extract. roads are walked both ways, as couriers on motorbikes
+// do not always respect one-way streets, and lengths are in km
+type Graph struct {
+	lats, lons []float64
+	edges      []edge
+	arcs       [][]arc
+	cells      map[cell][]int32
+}
+
+// LoadGraph builds the graph of the highways of an OSM extract, either a PBF file (.pbf) or an OSM XML file
+func LoadGraph(filePath string) (*Graph, error) {
+	// the ways come after the nodes in an extract, so the ways are read first to keep only the nodes of the roads
+	index := make(map[osm.NodeID]int32)
+	var ways [][]osm.NodeID
+	err := scanFile(filePath, false, func(object osm.Object) {
+		way, ok := object.(*osm.Way)
+		if !ok || !Highways[way.Tags.Find("highway")] || len(way.Nodes) < 2 {
+			return
+		}
+		nodes := way.Nodes.NodeIDs()
+		for _, id := range nodes {
+			if _, ok := index[id]; !ok {
+				index[id] = int32(len(index))
+			}
+		}
+		ways = append(ways, nodes)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Graph{
+		lats:  make([]float64, len(index)),
+		lons:  make([]float64, len(index)),
+		arcs:  make([][]arc, len(index)),
+		cells: make(map[cell][]int32),
+	}
+	located := make([]bool, len(index))
+	err = scanFile(filePath, true, func(object osm.Object) {
+		node, ok := object.(*osm.Node)
+		if !ok {
+			return
+		}
+		if i, ok := index[node.ID]; ok {
+			g.lats[i], g.lons[i] = node.Lat, node.Lon
+			located[i] = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, nodes := range ways {
+		for i := 1; i < len(nodes); i++ {
+			from, to := index[nodes[i-1]], index[nodes[i]]
+			// the nodes outside of a clipped extract are missing
+			if from == to || !located[from] || !located[to] {
+				continue
+			}
+			g.addEdge(from, to)
+		}
+	}
+	return g, nil
+}
+
+// scanFile calls handle with each node, or each way, of the file
+func scanFile(filePath string, nodes bool, handle func(osm.Object)) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open road network %s: %v", filePath, err)
+	}
+	defer file.Close()
+
+	var scanner osm.Scanner
+	if strings.HasSuffix(filePath, ".pbf") {
+		pbfScanner := osmpbf.New(context.Background(), file, runtime.GOMAXPROCS(0))
+		pbfScanner.SkipNodes = !nodes
+		pbfScanner.SkipWays = nodes
+		pbfScanner.SkipRelations = true
+		scanner = pbfScanner
+	} else {
+		scanner = osmxml.New(context.Background(), file)
+	}
+	defer scanner.Close()
+
+	for scanner.Scan() {
+		handle(scanner.Object())
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read road network %s: %v", filePath, err)
+	}
+	return nil
+}
+
+// addEdge adds the road between two nodes, and indexes it in every cell of its bounding box
+func (g *Graph) addEdge(from, to int32) {
+	length := distance.Haversine{}.Distance(g.lats[from], g.lons[from], g.lats[to], g.lons[to])
+	id := int32(len(g.edges))
+	g.edges = append(g.edges, edge{from: from, to: to, length: length})
+	g.arcs[from] = append(g.arcs[from], arc{to: to, length: length})
+	g.arcs[to] = append(g.arcs[to], arc{to: from, length: length})
+
+	minCell := cellOf(min(g.lats[from], g.lats[to]), min(g.lons[from], g.lons[to]))
+	maxCell := cellOf(max(g.lats[from], g.lats[to]), max(g.lons[from], g.lons[to]))
+	for lat := minCell.lat; lat <= maxCell.lat; lat++ {
+		for lon := minCell.lon; lon <= maxCell.lon; lon++ {
+			key := cell{lat: lat, lon: lon}
+			g.cells[key] = append(g.cells[key], id)
+		}
+	}
+}
+
+// cellOf returns the cell of a point
+func cellOf(lat, lon float64) cell {
+	return cell{lat: int32(math.Floor(lat / cellSize)), lon: int32(math.Floor(lon / cellSize))}
+}
+
+// Nodes returns the number of nodes of the graph
+func (g *Graph) Nodes() int {
+	return len(g.lats)
+}
+
+// Edges returns the number of edges of the graph
+func (g *Graph) Edges() int {
+	return len(g.edges)
+}
+
+// position is a point snapped to an edge, at the fraction t of its length from its first node
+type position struct {
+	edge   int32
+	t      float64
+	offset float64
+}
+
+// snap returns the position on the nearest edge within radius (in km) of the point
+func (g *Graph) snap(lat, lon float64, radius float64) (position, bool) {
+	// the edges are projected on a plane around the point, which is accurate over the radius
+	kmPerLon := kmPerDegree * math.Cos(lat*math.Pi/180)
+	minCell := cellOf(lat-radius/kmPerDegree, lon-radius/kmPerLon)
+	maxCell := cellOf(lat+radius/kmPerDegree, lon+radius/kmPerLon)
+
+	best := position{edge: -1, offset: math.Inf(1)}
+	for cellLat := minCell.lat; cellLat <= maxCell.lat; cellLat++ {
+		for cellLon := minCell.lon; cellLon <= maxCell.lon; cellLon++ {
+			for _, id := range g.cells[cell{lat: cellLat, lon: cellLon}] {
+				e := g.edges[id]
+				ax, ay := (g.lons[e.from]-lon)*kmPerLon, (g.lats[e.from]-lat)*kmPerDegree
+				bx, by := (g.lons[e.to]-lon)*kmPerLon, (g.lats[e.to]-lat)*kmPerDegree
+				dx, dy := bx-ax, by-ay
+
+				t := 0.0
+				if squared := dx*dx + dy*dy; squared > 0 {
+					t = min(1, max(0, -(ax*dx+ay*dy)/squared))
+				}
+				if offset := math.Hypot(ax+t*dx, ay+t*dy); offset < best.offset {
+					best = position{edge: id, t: t, offset: offset}
+				}
+			}
+		}
+	}
+	return best, best.edge >= 0 && best.offset <= radius
+}
+
+// roadDistance returns the length of the shortest road between two positions, if it is not longer than limit (in km)
+func (g *Graph) roadDistance(a, b position, limit float64) (float64, bool) {
+	edgeA, edgeB := g.edges[a.edge], g.edges[b.edge]
+	if a.edge == b.edge {
+		return math.Abs(a.t-b.t) * edgeA.length, true
+	}
+
+	// the road leaves the edge of a through one of its nodes, and enters the edge of b through one of its nodes,
+	// the nodes of an edge are never the same
+	targets := map[int32]float64{
+		edgeB.from: b.t * edgeB.length,
+		edgeB.to:   (1 - b.t) * edgeB.length,
+	}
+	distances := map[int32]float64{
+		edgeA.from: a.t * edgeA.length,
+		edgeA.to:   (1 - a.t) * edgeA.length,
+	}
+	queue := &nodeQueue{}
+	for node, d := range distances {
+		heap.Push(queue, queuedNode{node: node, distance: d})
+	}
+
+	best := math.Inf(1)
+	for queue.Len() > 0 {
+		current := heap.Pop(queue).(queuedNode)
+		if current.distance >= best || current.distance > limit {
+			break
+		}
+		if current.distance > distances[current.node] {
+			continue
+		}
+		if rest, ok := targets[current.node]; ok {
+			best = min(best, current.distance+rest)
+		}
+		for _, next := range g.arcs[current.node] {
+			d := current.distance + next.length
+			if known, ok := distances[next.to]; ok && known <= d {
+				continue
+			}
+			distances[next.to] = d
+			heap.Push(queue, queuedNode{node: next.to, distance: d})
+		}
+	}
+	return best, best <= limit
+}
+
+// queuedNode is a node reached at distance by the shortest road search
+type queuedNode struct {
+	node     int32
+	distance float64
+}
+
+// nodeQueue is the priority queue of the shortest road search, nearest node first
+type nodeQueue []queuedNode
+
+func (q nodeQueue) Len() int            { return len(q) }
+func (q nodeQueue) Less(i, j int) bool  { return q[i].distance < q[j].distance }
+func (q nodeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *nodeQueue) Push(x interface{}) { *q = append(*q, x.(queuedNode)) }
+func (q *nodeQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,88 @@
+package mapmatch
+
+import (
+	"github.com/aref81/snappbox_fare_estimator/shared/distance"
+	"sync/atomic"
+)
+
+const (
+	// DefaultSnapRadius is the distance (in m) from a road within which a point is snapped to it, when no radius is configured
+	DefaultSnapRadius = 30.0
+	// DefaultMaxDetour is how many times longer than the straight line a road may be, when no detour is configured
+	DefaultMaxDetour = 3.0
+)
+
+// Options holds the parameters of a Matcher, zero values fall back to the defaults
+type Options struct {
+	// SnapRadius is in m
+	SnapRadius float64
+	MaxDetour  float64
+	// Fallback measures the segments which could not be matched, haversine if nil
+	Fallback distance.Model
+}
+
+// Matcher is a distance.Model measuring the road distance between two points: each point is snapped to the
+// nearest road, and the distance is the length of the shortest road between them. the straight-line distance
+// of the fallback model is used if a point is farther than SnapRadius from any road, or if the shortest road
+// is more than MaxDetour times longer than the straight line (plus the snapping), which is rather a wrong snap
+type Matcher struct {
+	graph      *Graph
+	snapRadius float64
+	maxDetour  float64
+	fallback   distance.Model
+	matched    atomic.Int64
+	fallbacks  atomic.Int64
+}
+
+// NewMatcher creates a Matcher on the road network
+func NewMatcher(graph *Graph, options Options) *Matcher {
+	matcher := &Matcher{
+		graph:      graph,
+		snapRadius: options.SnapRadius / 1000,
+		maxDetour:  options.MaxDetour,
+		fallback:   options.Fallback,
+	}
+	if options.SnapRadius <= 0 {
+		matcher.snapRadius = DefaultSnapRadius / 1000
+	}
+	if matcher.maxDetour <= 0 {
+		matcher.maxDetour = DefaultMaxDetour
+	}
+	if matcher.fallback == nil {
+		matcher.fallback = distance.Haversine{}
+	}
+	return matcher
+}
+
+// Name returns the name of the model
+func (m *Matcher) Name() string {
+	return "map_matching (fallback " + m.fallback.Name() + ")"
+}
+
+// Distance returns the road distance (in km) between two points given in degrees
+func (m *Matcher) Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	straight := m.fallback.Distance(lat1, lon1, lat2, lon2)
+	a, ok := m.graph.snap(lat1, lon1, m.snapRadius)
+	if !ok {
+		m.fallbacks.Add(1)
+		return straight
+	}
+	b, ok := m.graph.snap(lat2, lon2, m.snapRadius)
+	if !ok {
+		m.fallbacks.Add(1)
+		return straight
+	}
+
+	road, ok := m.graph.roadDistance(a, b, m.maxDetour*straight+2*m.snapRadius)
+	if !ok {
+		m.fallbacks.Add(1)
+		return straight
+	}
+	m.matched.Add(1)
+	return road
+}
+
+// Stats returns the number of distances measured on the roads, and of those which fell back to the straight line
+func (m *Matcher) Stats() (matched int64, fallbacks int64) {
+	return m.matched.Load(), m.fallbacks.Load()
+}
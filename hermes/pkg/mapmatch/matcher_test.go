@@ -0,0 +1,84 @@
+package mapmatch
+
+import (
+	"github.com/aref81/snappbox_fare_estimator/shared/distance"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// testdata/roads.osm has an L-shaped residential road from node 1 east to node 2 then north to node 3,
+// a footway cutting the corner from node 1 to node 3, a secondary road of its own further north,
+// and a primary road leaving the extract
+func loadTestGraph(t *testing.T) *Graph {
+	graph, err := LoadGraph("testdata/roads.osm")
+	assert.NoError(t, err)
+	return graph
+}
+
+func TestLoadGraph(t *testing.T) {
+	graph := loadTestGraph(t)
+
+	// the footway is not a road, and the primary road has no edge as its last node is outside of the extract
+	assert.Equal(t, 7, graph.Nodes())
+	assert.Equal(t, 3, graph.Edges())
+
+	_, err := LoadGraph("testdata/missing.osm.pbf")
+	assert.Error(t, err)
+}
+
+func TestLoadGraph_PBF(t *testing.T) {
+	// testdata/roads.osm.pbf is testdata/roads.osm encoded as a PBF file, with dense nodes
+	graph, err := LoadGraph("testdata/roads.osm.pbf")
+	assert.NoError(t, err)
+	assert.Equal(t, 7, graph.Nodes())
+	assert.Equal(t, 3, graph.Edges())
+
+	expected := NewMatcher(loadTestGraph(t), Options{}).Distance(35.70009, 51.4010, 35.7050, 51.41011)
+	assert.InDelta(t, expected, NewMatcher(graph, Options{}).Distance(35.70009, 51.4010, 35.7050, 51.41011), 0.000001)
+}
+
+func TestMatcher_RoadDistance(t *testing.T) {
+	matcher := NewMatcher(loadTestGraph(t), Options{})
+	haversine := distance.Haversine{}
+
+	// from 10 m north of the east leg to 10 m east of the north leg, around the corner of the L
+	road := matcher.Distance(35.70009, 51.4010, 35.7050, 51.41011)
+	expected := haversine.Distance(35.7, 51.401, 35.7, 51.41) + haversine.Distance(35.7, 51.41, 35.705, 51.41)
+	assert.InDelta(t, expected, road, 0.001)
+	assert.Greater(t, road, haversine.Distance(35.70009, 51.4010, 35.7050, 51.41011))
+
+	matched, fallbacks := matcher.Stats()
+	assert.Equal(t, int64(1), matched)
+	assert.Equal(t, int64(0), fallbacks)
+}
+
+func TestMatcher_Drift(t *testing.T) {
+	matcher := NewMatcher(loadTestGraph(t), Options{})
+
+	// a parked courier drifting across the road does not move along it
+	assert.InDelta(t, 0, matcher.Distance(35.70015, 51.4050, 35.69985, 51.4050), 0.0001)
+	assert.Greater(t, distance.Haversine{}.Distance(35.70015, 51.4050, 35.69985, 51.4050), 0.03)
+}
+
+func TestMatcher_Fallback(t *testing.T) {
+	vincenty := distance.Vincenty{}
+	matcher := NewMatcher(loadTestGraph(t), Options{Fallback: vincenty})
+
+	// the middle of the footway is away from any road
+	assert.Equal(t, vincenty.Distance(35.705, 51.405, 35.7, 51.401), matcher.Distance(35.705, 51.405, 35.7, 51.401))
+	// there is no road between the L and the secondary road
+	assert.Equal(t, vincenty.Distance(35.7, 51.401, 35.72, 51.401), matcher.Distance(35.7, 51.401, 35.72, 51.401))
+
+	matched, fallbacks := matcher.Stats()
+	assert.Equal(t, int64(0), matched)
+	assert.Equal(t, int64(2), fallbacks)
+	assert.Equal(t, "map_matching (fallback vincenty)", matcher.Name())
+}
+
+func TestMatcher_MaxDetour(t *testing.T) {
+	// between the ends of the L, the road is about 1.4 times longer than the straight line
+	assert.Greater(t, NewMatcher(loadTestGraph(t), Options{}).Distance(35.7, 51.4, 35.71, 51.41), 2.0)
+
+	matcher := NewMatcher(loadTestGraph(t), Options{MaxDetour: 1.2})
+	assert.Equal(t, distance.Haversine{}.Distance(35.7, 51.4, 35.71, 51.41), matcher.Distance(35.7, 51.4, 35.71, 51.41))
+}
@@ -2,15 +2,24 @@ package rabbitMQ
 
 import (
 	"context"
+	"errors"
 	"github.com/streadway/amqp"
 	"go.uber.org/zap"
 )
 
+// ErrNotConfirmed is returned when RabbitMQ does not confirm a message published over a channel in confirm mode
+var ErrNotConfirmed = errors.New("message not confirmed by RabbitMQ")
+
+// RabbitMQPublisher publishes to a queue over its own channel, a channel must not be used by several goroutines at once
 type RabbitMQPublisher struct {
 	conn    *amqp.Connection
 	channel *amqp.Channel
 	queue   amqp.Queue
 	logger  *zap.Logger
+	// ownsConn is false for the publishers sharing the connection of another publisher
+	ownsConn bool
+	// confirms receives the confirmations of the messages published, when the channel is in confirm mode
+	confirms chan amqp.Confirmation
 }
 
 // NewRabbitMQPublisher initializes a new RabbitMQ connection and starts a queue
@@ -41,10 +50,36 @@ func NewRabbitMQPublisher(brokerURL, queueName string, log *zap.Logger) (*Rabbit
 	}
 
 	return &RabbitMQPublisher{
-		conn:    conn,
-		channel: channel,
-		queue:   queue,
-		logger:  log,
+		conn:     conn,
+		channel:  channel,
+		queue:    queue,
+		logger:   log,
+		ownsConn: true,
+	}, nil
+}
+
+// NewChannelPublisher creates a new publisher to the same queue over the same connection, with a channel of its own,
+// so publishing from several goroutines does not share a channel. closing it only closes its channel.
+// RabbitMQ only orders the messages of a channel, so the channel is in confirm mode and PublishMessage returns once
+// the message is confirmed: a message published on another channel afterwards is queued after it
+func (p *RabbitMQPublisher) NewChannelPublisher() (*RabbitMQPublisher, error) {
+	channel, err := p.conn.Channel()
+	if err != nil {
+		p.logger.Error("Failed to create channel", zap.Error(err))
+		return nil, err
+	}
+	if err := channel.Confirm(false); err != nil {
+		p.logger.Error("Failed to put channel in confirm mode", zap.Error(err))
+		channel.Close()
+		return nil, err
+	}
+
+	return &RabbitMQPublisher{
+		conn:     p.conn,
+		channel:  channel,
+		queue:    p.queue,
+		logger:   p.logger,
+		confirms: channel.NotifyPublish(make(chan amqp.Confirmation, 1)),
 	}, nil
 }
 
@@ -64,16 +99,27 @@ func (p *RabbitMQPublisher) PublishMessage(ctx context.Context, body []byte) err
 		p.logger.Error("Failed to publish message to RabbitMQ", zap.Error(err))
 		return err
 	}
+	if p.confirms != nil {
+		// the confirmations come in the order of the messages, and stop when the channel is closed
+		confirmation, ok := <-p.confirms
+		if !ok || !confirmation.Ack {
+			p.logger.Error("Failed to publish message to RabbitMQ", zap.Error(ErrNotConfirmed))
+			return ErrNotConfirmed
+		}
+	}
 
 	//p.logger.Info("Message published to RabbitMQ", zap.ByteString("message", body)) // Debug only
 	return nil
 }
 
-// Close closes the RabbitMQ connection.
+// Close closes the RabbitMQ channel, and the connection if the publisher opened it.
 func (p *RabbitMQPublisher) Close() {
 	if err := p.channel.Close(); err != nil {
 		p.logger.Error("Failed to close RabbitMQ channel", zap.Error(err))
 	}
+	if !p.ownsConn {
+		return
+	}
 	if err := p.conn.Close(); err != nil {
 		p.logger.Error("Failed to close RabbitMQ connection", zap.Error(err))
 	}
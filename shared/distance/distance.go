@@ -0,0 +1,158 @@
+package distance
+
+import (
+	"fmt"
+	"math"
+)
+
+// names of the distance models
+const (
+	ModelHaversine       = "haversine"
+	ModelVincenty        = "vincenty"
+	ModelEquirectangular = "equirectangular"
+)
+
+const (
+	// EarthRadius is the mean radius of the Earth (in km) used by the spherical models
+	EarthRadius = 6371.0
+	// wgs84A and wgs84F are the semi-major axis (in km) and the flattening of the WGS84 ellipsoid
+	wgs84A = 6378.137
+	wgs84F = 1 / 298.257223563
+	wgs84B = wgs84A * (1 - wgs84F)
+
+	// vincentyTolerance is the change of lambda (in radians, about 0.06 mm) below which Vincenty's iteration stops
+	vincentyTolerance     = 1e-12
+	vincentyMaxIterations = 200
+)
+
+// Model calculates the distance between two points
+type Model interface {
+	// Name returns the name of the model
+	Name() string
+	// Distance returns the distance (in km) between two points given in degrees
+	Distance(lat1, lon1, lat2, lon2 float64) float64
+}
+
+// NewModel returns the model of the name, an empty name is haversine
+func NewModel(name string) (Model, error) {
+	switch name {
+	case "", ModelHaversine:
+		return Haversine{}, nil
+	case ModelVincenty:
+		return Vincenty{}, nil
+	case ModelEquirectangular:
+		return Equirectangular{}, nil
+	default:
+		return nil, fmt.Errorf("unknown distance model %q", name)
+	}
+}
+
+// radians converts degrees to radians
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180.0
+}
+
+// Haversine is the great-circle distance on a sphere of EarthRadius. its error against the WGS84 ellipsoid
+// is up to about 0.5%, depending on the latitude and the direction
+type Haversine struct{}
+
+// Name returns the name of the model
+func (Haversine) Name() string {
+	return ModelHaversine
+}
+
+// Distance returns the great-circle distance between the points
+func (Haversine) Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := radians(lat2 - lat1)
+	dLon := radians(lon2 - lon1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Sin(dLon/2)*math.Sin(dLon/2)*math.Cos(radians(lat1))*math.Cos(radians(lat2))
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	return EarthRadius * c
+}
+
+// Equirectangular projects the points on a plane around their mean latitude, which is the fastest model
+// and as accurate as Haversine for the few hundred metres between two GPS points, but not for long distances
+type Equirectangular struct{}
+
+// Name returns the name of the model
+func (Equirectangular) Name() string {
+	return ModelEquirectangular
+}
+
+// Distance returns the distance between the points on the projection
+func (Equirectangular) Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	dLon := lon2 - lon1
+	// take the short way across the antimeridian
+	if dLon > 180 {
+		dLon -= 360
+	} else if dLon < -180 {
+		dLon += 360
+	}
+	x := radians(dLon) * math.Cos(radians(lat1+lat2)/2)
+	y := radians(lat2 - lat1)
+	return EarthRadius * math.Sqrt(x*x+y*y)
+}
+
+// Vincenty is the geodesic distance on the WGS84 ellipsoid, with Vincenty's inverse formula (accurate to below a millimetre).
+// for nearly antipodal points, where the formula does not converge, it falls back to Haversine
+type Vincenty struct{}
+
+// Name returns the name of the model
+func (Vincenty) Name() string {
+	return ModelVincenty
+}
+
+// Distance returns the geodesic distance between the points
+func (Vincenty) Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	if lat1 == lat2 && lon1 == lon2 {
+		return 0
+	}
+
+	L := radians(lon2 - lon1)
+	// reduced latitudes
+	U1 := math.Atan((1 - wgs84F) * math.Tan(radians(lat1)))
+	U2 := math.Atan((1 - wgs84F) * math.Tan(radians(lat2)))
+	sinU1, cosU1 := math.Sincos(U1)
+	sinU2, cosU2 := math.Sincos(U2)
+
+	lambda := L
+	var sinSigma, cosSigma, sigma, cosSqAlpha, cos2SigmaM float64
+	converged := false
+	for i := 0; i < vincentyMaxIterations; i++ {
+		sinLambda, cosLambda := math.Sincos(lambda)
+		sinSigma = math.Sqrt((cosU2*sinLambda)*(cosU2*sinLambda) +
+			(cosU1*sinU2-sinU1*cosU2*cosLambda)*(cosU1*sinU2-sinU1*cosU2*cosLambda))
+		if sinSigma == 0 {
+			// coincident points
+			return 0
+		}
+		cosSigma = sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma = math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cosSqAlpha = 1 - sinAlpha*sinAlpha
+		if cosSqAlpha != 0 {
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cosSqAlpha
+		} else {
+			// both points on the equator
+			cos2SigmaM = 0
+		}
+		C := wgs84F / 16 * cosSqAlpha * (4 + wgs84F*(4-3*cosSqAlpha))
+		previous := lambda
+		lambda = L + (1-C)*wgs84F*sinAlpha*(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-previous) < vincentyTolerance {
+			converged = true
+			break
+		}
+	}
+	if !converged {
+		return Haversine{}.Distance(lat1, lon1, lat2, lon2)
+	}
+
+	uSq := cosSqAlpha * (wgs84A*wgs84A - wgs84B*wgs84B) / (wgs84B * wgs84B)
+	A := 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+	B := uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+	deltaSigma := B * sinSigma * (cos2SigmaM + B/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+		B/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+	return wgs84B * A * (sigma - deltaSigma)
+}
@@ -0,0 +1,82 @@
+package distance
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// dms converts degrees, minutes and seconds to degrees
+func dms(degrees, minutes, seconds float64) float64 {
+	if degrees < 0 {
+		return degrees - minutes/60 - seconds/3600
+	}
+	return degrees + minutes/60 + seconds/3600
+}
+
+func TestNewModel(t *testing.T) {
+	for _, name := range []string{ModelHaversine, ModelVincenty, ModelEquirectangular} {
+		model, err := NewModel(name)
+		assert.NoError(t, err)
+		assert.Equal(t, name, model.Name())
+	}
+
+	model, err := NewModel("")
+	assert.NoError(t, err)
+	assert.Equal(t, ModelHaversine, model.Name(), "haversine should be the default model")
+
+	_, err = NewModel("flat")
+	assert.Error(t, err)
+}
+
+// TestVincenty tests the geodesic distances against published reference values on WGS84
+func TestVincenty(t *testing.T) {
+	// Flinders Peak to Buninyong, the example of Vincenty (1975): 54972.271 m
+	distance := Vincenty{}.Distance(dms(-37, 57, 3.72030), dms(144, 25, 29.52440), dms(-37, 39, 10.15610), dms(143, 55, 35.38390))
+	assert.InDelta(t, 54.972271, distance, 0.000001)
+
+	// the quarter meridian of WGS84: 10001965.729 m
+	assert.InDelta(t, 10001.965729, Vincenty{}.Distance(0, 0, 90, 0), 0.000001)
+
+	// a degree of longitude on the equator is a*pi/180: 111319.491 m
+	assert.InDelta(t, 111.319491, Vincenty{}.Distance(0, 0, 0, 1), 0.000001)
+
+	assert.Zero(t, Vincenty{}.Distance(35.7025, 51.4097, 35.7025, 51.4097))
+
+	// nearly antipodal points do not converge, and fall back to haversine
+	assert.InDelta(t, Haversine{}.Distance(0, 0, 0.5, 179.7), Vincenty{}.Distance(0, 0, 0.5, 179.7), 0.000001)
+}
+
+func TestHaversine(t *testing.T) {
+	// New York to London, and Paris to Berlin
+	assert.InDelta(t, 5570.0, Haversine{}.Distance(40.7128, -74.0060, 51.5074, -0.1278), 0.5)
+	assert.InDelta(t, 878.0, Haversine{}.Distance(48.8566, 2.3522, 52.5200, 13.4050), 1.0)
+	// a degree of a great circle is R*pi/180
+	assert.InDelta(t, 111.194927, Haversine{}.Distance(0, 0, 0, 1), 0.000001)
+	assert.Zero(t, Haversine{}.Distance(35.7025, 51.4097, 35.7025, 51.4097))
+
+	// the spherical error against the ellipsoid stays within 0.5%
+	for _, points := range [][4]float64{
+		{35.7000, 51.4000, 35.7090, 51.4000}, // 1 km north in Tehran
+		{35.7000, 51.4000, 35.7000, 51.4110}, // 1 km east in Tehran
+		{dms(-37, 57, 3.72030), dms(144, 25, 29.52440), dms(-37, 39, 10.15610), dms(143, 55, 35.38390)},
+		{0, 0, 90, 0},
+	} {
+		reference := Vincenty{}.Distance(points[0], points[1], points[2], points[3])
+		assert.InEpsilon(t, reference, Haversine{}.Distance(points[0], points[1], points[2], points[3]), 0.005)
+	}
+}
+
+func TestEquirectangular(t *testing.T) {
+	// on the short hops between GPS points it matches haversine
+	for _, points := range [][4]float64{
+		{35.7000, 51.4000, 35.7090, 51.4000},
+		{35.7000, 51.4000, 35.7000, 51.4110},
+		{35.7000, 51.4000, 35.7500, 51.4600},
+	} {
+		haversine := Haversine{}.Distance(points[0], points[1], points[2], points[3])
+		assert.InEpsilon(t, haversine, Equirectangular{}.Distance(points[0], points[1], points[2], points[3]), 0.0001)
+	}
+
+	// the short way across the antimeridian
+	assert.InDelta(t, Haversine{}.Distance(0, 179.9, 0, -179.9), Equirectangular{}.Distance(0, 179.9, 0, -179.9), 0.000001)
+}
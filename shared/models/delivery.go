@@ -1,39 +1,99 @@
 package models
 
 import (
+	"errors"
 	"fmt"
-	"github.com/aref81/snappbox_fare_estimator/shared/haversine"
+	"github.com/aref81/snappbox_fare_estimator/shared/distance"
 )
 
-// DeliveryPoint represents a single GPS coordination for a Delivery
+var (
+	// ErrSpeedLimitExceeded is returned for segments faster than the speed limit, usually caused by GPS spikes
+	ErrSpeedLimitExceeded = errors.New("invalid processor point")
+	// ErrZeroTimeDifference is returned for segments whose points have the same timestamp
+	ErrZeroTimeDifference = errors.New("failed to calculate the speed")
+)
+
+// DeliveryPoint represents a single GPS coordination for a Delivery, along with the quality of the fix when the
+// device reports it. the quality fields are optional, nil (or empty) when unknown
 type DeliveryPoint struct {
 	DeliveryID int
 	Latitude   float64
 	Longitude  float64
 	Timestamp  int64
+	// Accuracy is the horizontal accuracy of the fix, in m
+	Accuracy *float64 `json:",omitempty"`
+	// Speed is the speed reported by the device, in m/s
+	Speed *float64 `json:",omitempty"`
+	// Bearing is the direction of the device, in degrees clockwise from north
+	Bearing *float64 `json:",omitempty"`
+	// Provider is the source of the fix, e.g. gps, network or fused
+	Provider string `json:",omitempty"`
+	// Origin is where the point was read from, it is only known to the service reading the input and is not serialized
+	Origin *PointOrigin `json:"-"`
+}
+
+// PointOrigin is the position of a DeliveryPoint in its input file
+type PointOrigin struct {
+	Source string
+	// Line is the line number of the point in the file, starting from 1
+	Line int64
+	// Offset is the byte offset of the start of the point in the (decompressed) file, or its row number for columnar files
+	Offset int64
+	// Raw is the original row of the point, it is only kept when rejected rows are quarantined
+	Raw string
 }
 
 // DeliverySegment represents a segment of the road traveled, including two DeliveryPoints and Speed calculated for it.
+// Status (moving or idle) is set by the stop detection of Hermes, or by the speeds reported by the devices when
+// they are preferred, and is omitted otherwise
 type DeliverySegment struct {
 	StartTime   int64
 	ElapsedTime float64
 	Speed       float64
 	Distance    float64
+	Status      string `json:",omitempty"`
+}
+
+// IsIdle tells whether the segment is billed by its time: by its status when it has one, or when it is not faster than IdleSpeed
+func (s DeliverySegment) IsIdle() bool {
+	if s.Status != "" {
+		return s.Status == StatusIdle
+	}
+	return s.Speed <= IdleSpeed
 }
 
 // Delivery represents an individual Delivery Data, which includes and ID and multiple DeliverySegments
+// a long delivery may be sent in several parts, then Part is the index of the part (from 0) and Parts their number
 type Delivery struct {
 	ID       int
 	Segments []DeliverySegment
+	Part     int `json:",omitempty"`
+	Parts    int `json:",omitempty"`
 }
 
 // AddSegment adds a new DeliverySegment to the Delivery after validation
 func (d *Delivery) AddSegment(startPoint DeliveryPoint, endPoint DeliveryPoint) error {
-	segmentSpeed, segmentDistance, err := calculateSpeedAndDistance(startPoint, endPoint)
+	return d.addSegment(startPoint, endPoint, defaultValidationPolicy)
+}
+
+// addSegment adds a new DeliverySegment to the Delivery after validation by the policy
+func (d *Delivery) addSegment(startPoint DeliveryPoint, endPoint DeliveryPoint, policy *ValidationPolicy) error {
+	segment, err := newSegment(startPoint, endPoint, policy)
 	if err != nil {
 		return err
 	}
 
+	d.Segments = append(d.Segments, segment)
+	return nil
+}
+
+// newSegment creates the segment between two points and validates it
+func newSegment(startPoint DeliveryPoint, endPoint DeliveryPoint, policy *ValidationPolicy) (DeliverySegment, error) {
+	segmentSpeed, segmentDistance, err := calculateSpeedAndDistance(startPoint, endPoint, policy.Rules.DistanceModel)
+	if err != nil {
+		return DeliverySegment{}, err
+	}
+
 	segment := DeliverySegment{
 		StartTime:   startPoint.Timestamp,
 		ElapsedTime: float64(endPoint.Timestamp-startPoint.Timestamp) / 3600.0,
@@ -41,13 +101,19 @@ func (d *Delivery) AddSegment(startPoint DeliveryPoint, endPoint DeliveryPoint)
 		Distance:    segmentDistance,
 	}
 
-	err = validateSegment(segment)
+	err = policy.ValidateSegment(segment)
 	if err != nil {
-		return err
+		return DeliverySegment{}, err
 	}
-
-	d.Segments = append(d.Segments, segment)
-	return nil
+	if policy.Rules.PreferDeviceSpeed && startPoint.Speed != nil && endPoint.Speed != nil {
+		// the mean of the speeds reported at both ends (from m/s to km/h) only tells whether the segment is idle,
+		// the segment is still checked at its distance over its time so GPS spikes are not let through
+		segment.Status = StatusMoving
+		if (*startPoint.Speed+*endPoint.Speed)/2*3.6 <= IdleSpeed {
+			segment.Status = StatusIdle
+		}
+	}
+	return segment, nil
 }
 
 // NewDelivery initializes a new Delivery
@@ -58,24 +124,47 @@ func NewDelivery(id int) *Delivery {
 	}
 }
 
-// ValidateDeliverySegment checks the validity of a segment by calculating the speed of it
+// ValidateDeliverySegment checks the validity of a segment with the default rules
 func validateSegment(segment DeliverySegment) error {
-	if segment.Speed <= 100.0 {
-		return nil
-	} else {
-		return fmt.Errorf("invalid processor point, speed = %f", segment.Speed)
-	}
+	return defaultValidationPolicy.ValidateSegment(segment)
 }
 
-// calculateSpeed calculates the speed for a segment using haversine distance
-func calculateSpeedAndDistance(p1 DeliveryPoint, p2 DeliveryPoint) (float64, float64, error) {
+// calculateSpeed calculates the speed for a segment using the distance of the model
+func calculateSpeedAndDistance(p1 DeliveryPoint, p2 DeliveryPoint, model distance.Model) (float64, float64, error) {
 	timeDiff := float64(p2.Timestamp-p1.Timestamp) / 3600.0
 	if timeDiff == 0 {
 		// skipping zero time differences
-		return 0, 0, fmt.Errorf("failed to calculate the speed, timeDiff = %f", timeDiff)
+		return 0, 0, fmt.Errorf("%w, timeDiff = %f", ErrZeroTimeDifference, timeDiff)
 	}
 
-	distance := haversine.Haversine(p1.Latitude, p1.Longitude, p2.Latitude, p2.Longitude)
-	speed := distance / timeDiff
-	return speed, distance, nil
+	segmentDistance := model.Distance(p1.Latitude, p1.Longitude, p2.Latitude, p2.Longitude)
+	speed := segmentDistance / timeDiff
+	return speed, segmentDistance, nil
+}
+
+// pointPair is the key of the distance between two points
+type pointPair struct {
+	lat1, lon1, lat2, lon2 float64
+}
+
+// measuredModel is a distance.Model keeping the distances measured by its model, it is not safe for concurrent use
+type measuredModel struct {
+	distance.Model
+	distances map[pointPair]float64
+}
+
+// newMeasuredModel creates a measuredModel on the model
+func newMeasuredModel(model distance.Model) measuredModel {
+	return measuredModel{Model: model, distances: make(map[pointPair]float64)}
+}
+
+// Distance returns the distance (in km) between two points, measured by the model the first time only
+func (m measuredModel) Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	key := pointPair{lat1: lat1, lon1: lon1, lat2: lat2, lon2: lon2}
+	if d, ok := m.distances[key]; ok {
+		return d
+	}
+	d := m.Model.Distance(lat1, lon1, lat2, lon2)
+	m.distances[key] = d
+	return d
 }
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidPart is returned for parts whose index or number of parts is out of range, or differs from the other parts
+	ErrInvalidPart = errors.New("invalid delivery part")
+	// ErrDuplicatePart is returned for parts received twice
+	ErrDuplicatePart = errors.New("duplicate delivery part")
+)
+
+// IsPart tells whether the delivery is a part of a longer delivery
+func (d *Delivery) IsPart() bool {
+	return d.Parts > 1
+}
+
+// Split splits the delivery into parts of at most maxSegments segments, in order.
+// a delivery which fits in one part, or a maxSegments of 0, returns the delivery itself
+func (d *Delivery) Split(maxSegments int) []*Delivery {
+	if maxSegments <= 0 || len(d.Segments) <= maxSegments {
+		return []*Delivery{d}
+	}
+
+	count := (len(d.Segments) + maxSegments - 1) / maxSegments
+	parts := make([]*Delivery, 0, count)
+	for i := 0; i < count; i++ {
+		end := min(len(d.Segments), (i+1)*maxSegments)
+		parts = append(parts, &Delivery{
+			ID:       d.ID,
+			Segments: d.Segments[i*maxSegments : end],
+			Part:     i,
+			Parts:    count,
+		})
+	}
+	return parts
+}
+
+// PartialDelivery collects the parts of a delivery until all of them are received
+type PartialDelivery struct {
+	ID       int
+	parts    []*Delivery
+	received int
+}
+
+// NewPartialDelivery creates a PartialDelivery from its first received part
+func NewPartialDelivery(part *Delivery) (*PartialDelivery, error) {
+	if part.Parts <= 1 || part.Part < 0 || part.Part >= part.Parts {
+		return nil, fmt.Errorf("%w, delivery %d part %d of %d", ErrInvalidPart, part.ID, part.Part, part.Parts)
+	}
+	partial := &PartialDelivery{
+		ID:    part.ID,
+		parts: make([]*Delivery, part.Parts),
+	}
+	return partial, partial.Add(part)
+}
+
+// Add adds a part of the delivery
+func (p *PartialDelivery) Add(part *Delivery) error {
+	if part.ID != p.ID || part.Parts != len(p.parts) || part.Part < 0 || part.Part >= len(p.parts) {
+		return fmt.Errorf("%w, delivery %d part %d of %d, expected delivery %d with %d parts",
+			ErrInvalidPart, part.ID, part.Part, part.Parts, p.ID, len(p.parts))
+	}
+	if p.parts[part.Part] != nil {
+		return fmt.Errorf("%w, delivery %d part %d", ErrDuplicatePart, part.ID, part.Part)
+	}
+	p.parts[part.Part] = part
+	p.received++
+	return nil
+}
+
+// Complete tells whether all the parts are received
+func (p *PartialDelivery) Complete() bool {
+	return p.received == len(p.parts)
+}
+
+// Missing returns the indexes of the parts not received yet
+func (p *PartialDelivery) Missing() []int {
+	var missing []int
+	for i, part := range p.parts {
+		if part == nil {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// Delivery joins the segments of the parts in order, it should only be called once the delivery is complete
+func (p *PartialDelivery) Delivery() *Delivery {
+	delivery := NewDelivery(p.ID)
+	for _, part := range p.parts {
+		if part != nil {
+			delivery.Segments = append(delivery.Segments, part.Segments...)
+		}
+	}
+	return delivery
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func longDelivery(segments int) *Delivery {
+	delivery := NewDelivery(7)
+	for i := 0; i < segments; i++ {
+		delivery.Segments = append(delivery.Segments, DeliverySegment{StartTime: int64(1000 + i*10), ElapsedTime: 10.0 / 3600, Speed: 20, Distance: 0.05})
+	}
+	return delivery
+}
+
+func TestDelivery_Split(t *testing.T) {
+	delivery := longDelivery(10)
+
+	assert.Equal(t, []*Delivery{delivery}, delivery.Split(0), "a zero max should not split")
+	assert.Equal(t, []*Delivery{delivery}, delivery.Split(10), "a delivery which fits should not be split")
+
+	parts := delivery.Split(4)
+	assert.Len(t, parts, 3)
+	for i, part := range parts {
+		assert.True(t, part.IsPart())
+		assert.Equal(t, i, part.Part)
+		assert.Equal(t, 3, part.Parts)
+		assert.Equal(t, 7, part.ID)
+	}
+	assert.Len(t, parts[2].Segments, 2)
+}
+
+func TestPartialDelivery(t *testing.T) {
+	delivery := longDelivery(10)
+	parts := delivery.Split(4)
+
+	// the parts may arrive in any order
+	partial, err := NewPartialDelivery(parts[2])
+	assert.NoError(t, err)
+	assert.NoError(t, partial.Add(parts[0]))
+	assert.False(t, partial.Complete())
+	assert.Equal(t, []int{1}, partial.Missing())
+
+	assert.ErrorIs(t, partial.Add(parts[0]), ErrDuplicatePart)
+	assert.ErrorIs(t, partial.Add(&Delivery{ID: 7, Part: 1, Parts: 4}), ErrInvalidPart)
+
+	assert.NoError(t, partial.Add(parts[1]))
+	assert.True(t, partial.Complete())
+	assert.Equal(t, delivery, partial.Delivery(), "the parts should be joined in order")
+
+	_, err = NewPartialDelivery(delivery)
+	assert.ErrorIs(t, err, ErrInvalidPart, "a delivery which is not split is not a part")
+}
@@ -115,7 +115,7 @@ func TestCalculateSpeedAndDistance(t *testing.T) {
 		Timestamp:  1100,
 	}
 
-	speed, distance, err := calculateSpeedAndDistance(startPoint, endPoint)
+	speed, distance, err := calculateSpeedAndDistance(startPoint, endPoint, defaultValidationPolicy.Rules.DistanceModel)
 	expectedSpeed, expectedDistance := 5.15, 0.14
 	assert.NoError(t, err, "Calculating speed and distance should not produce an error")
 	assert.Greater(t, distance, 0.0, "Distance should be greater than 0")
@@ -127,7 +127,7 @@ func TestCalculateSpeedAndDistance(t *testing.T) {
 	startPoint.Timestamp = 1000
 	endPoint.Timestamp = 1000 // Same timestamp
 
-	speed, distance, err = calculateSpeedAndDistance(startPoint, endPoint)
+	speed, distance, err = calculateSpeedAndDistance(startPoint, endPoint, defaultValidationPolicy.Rules.DistanceModel)
 	assert.Error(t, err, "Should return an error for zero time difference")
 	assert.EqualError(t, err, "failed to calculate the speed, timeDiff = 0.000000", "Should return a time difference error")
 }
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// IdleSpeed is the speed (in km/h) up to which a segment without a status is billed by its time instead of its distance
+const IdleSpeed = 10.0
+
+// FareRules holds the rates a delivery is billed at: moving segments per km, at the day or the night rate
+// of the hour they start at, and idle segments (see DeliverySegment.IsIdle) per hour, on top of the flag amount
+type FareRules struct {
+	FlagAmount           float64
+	MinFare              float64
+	IdleFarePerHour      float64
+	MovingDayFarePerKm   float64
+	MovingNightFarePerKm float64
+	// DayStartHour and DayEndHour bound the hours (UTC) billed at the day rate, DayEndHour excluded
+	DayStartHour int
+	DayEndHour   int
+}
+
+// CalculateFare calculates the fare of the delivery, which is at least MinFare
+func (r FareRules) CalculateFare(delivery *Delivery) float64 {
+	totalFare := r.FlagAmount
+
+	for _, segment := range delivery.Segments {
+		// Decide if the status is moving or idle
+		if segment.IsIdle() {
+			totalFare += r.IdleFarePerHour * segment.ElapsedTime
+			continue
+		}
+		// Determine if it's day or night fare
+		if r.IsDayTime(segment.StartTime) {
+			totalFare += segment.Distance * r.MovingDayFarePerKm
+		} else {
+			totalFare += segment.Distance * r.MovingNightFarePerKm
+		}
+	}
+
+	// Check for minimum fare
+	if totalFare < r.MinFare {
+		totalFare = r.MinFare
+	}
+
+	return totalFare
+}
+
+// IsDayTime tells whether the timestamp is billed at the day rate
+func (r FareRules) IsDayTime(timestamp int64) bool {
+	hour := time.Unix(timestamp, 0).UTC().Hour()
+	return hour >= r.DayStartHour && hour < r.DayEndHour
+}
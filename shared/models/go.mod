@@ -3,7 +3,7 @@ module github.com/aref81/snappbox_fare_estimator/shared/models
 go 1.22.5
 
 require (
-	github.com/aref81/snappbox_fare_estimator v0.0.0-20240926212217-4931ec870fc2
+	github.com/aref81/snappbox_fare_estimator/shared/distance v0.0.0
 	github.com/stretchr/testify v1.9.0
 )
 
@@ -12,3 +12,5 @@ require (
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace github.com/aref81/snappbox_fare_estimator/shared/distance => ../distance
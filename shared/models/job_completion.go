@@ -0,0 +1,47 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// JobCompletionType is the Type of a JobCompletion message
+const JobCompletionType = "job_completion"
+
+// JobCompletion is the control message published once all the deliveries of a job are sent.
+// it goes through the same queues as the deliveries and fares, after all of them, and is told apart by its Type
+type JobCompletion struct {
+	Type  string
+	JobID string
+	// Deliveries is the number of deliveries Hermes sent for the job
+	Deliveries int64
+	// Fares is the number of fares Atalanta sent for the job, it is set when Atalanta forwards the message
+	Fares       int64
+	CompletedAt int64
+}
+
+// NewJobCompletion initializes a new JobCompletion
+func NewJobCompletion(jobID string, deliveries int64, completedAt int64) *JobCompletion {
+	return &JobCompletion{
+		Type:        JobCompletionType,
+		JobID:       jobID,
+		Deliveries:  deliveries,
+		CompletedAt: completedAt,
+	}
+}
+
+// jobCompletionMarker is looked for before decoding a message, so deliveries and fares are only decoded once
+var jobCompletionMarker = []byte(`"` + JobCompletionType + `"`)
+
+// ParseJobCompletion returns the JobCompletion of the message body, or false if it is not a JobCompletion
+func ParseJobCompletion(body []byte) (*JobCompletion, bool) {
+	if !bytes.Contains(body, jobCompletionMarker) {
+		return nil, false
+	}
+
+	var completion JobCompletion
+	if err := json.Unmarshal(body, &completion); err != nil || completion.Type != JobCompletionType {
+		return nil, false
+	}
+	return &completion, true
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// TestParseJobCompletion tests telling the completion message apart from deliveries and fares
+func TestParseJobCompletion(t *testing.T) {
+	body, err := json.Marshal(NewJobCompletion("job-1", 42, 1723697700))
+	assert.NoError(t, err)
+
+	completion, ok := ParseJobCompletion(body)
+	assert.True(t, ok)
+	assert.Equal(t, &JobCompletion{Type: JobCompletionType, JobID: "job-1", Deliveries: 42, CompletedAt: 1723697700}, completion)
+
+	delivery, err := json.Marshal(NewDelivery(1))
+	assert.NoError(t, err)
+	_, ok = ParseJobCompletion(delivery)
+	assert.False(t, ok, "a delivery should not be parsed as a completion")
+
+	fare, err := json.Marshal(NewDeliveryFare(1, 3.47))
+	assert.NoError(t, err)
+	_, ok = ParseJobCompletion(fare)
+	assert.False(t, ok, "a fare should not be parsed as a completion")
+}
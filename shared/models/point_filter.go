@@ -0,0 +1,271 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// names of the PointFilter strategies
+const (
+	FilterDropCurrent         = "drop_current"
+	FilterDropPreviousOnSpike = "drop_previous_on_spike"
+	FilterRollingMedian       = "rolling_median"
+	FilterKalman              = "kalman"
+)
+
+const (
+	// DefaultMedianWindow is the number of points the rolling median is taken over, when no window is configured
+	DefaultMedianWindow = 5
+	// DefaultProcessNoise is how fast (in m/s) the position is expected to drift from the Kalman estimate, when no value is configured
+	DefaultProcessNoise = 3.0
+	// DefaultMeasurementNoise is the expected error (in metres) of a GPS point, when no value is configured
+	DefaultMeasurementNoise = 15.0
+)
+
+// DroppedPoint is a point removed by a PointFilter, along with the error of the segment it would have made
+type DroppedPoint struct {
+	Point DeliveryPoint
+	Err   error
+}
+
+// PointFilter cleans the GPS noise of the points of a delivery, before the segments are built from them
+type PointFilter interface {
+	// Name returns the name of the strategy
+	Name() string
+	// Filter returns the points to build the segments from, in order, and the points it dropped.
+	// segments are checked against the policy
+	Filter(points []DeliveryPoint, policy *ValidationPolicy) ([]DeliveryPoint, []DroppedPoint)
+}
+
+// FilterOptions holds the parameters of the strategies, zero values are replaced by their defaults
+type FilterOptions struct {
+	// Window is the number of points of the rolling median
+	Window int
+	// ProcessNoise and MeasurementNoise tune the Kalman smoother, in m/s and metres
+	ProcessNoise     float64
+	MeasurementNoise float64
+}
+
+// NewPointFilter creates the filter of the strategy, an empty strategy is drop_current
+func NewPointFilter(strategy string, options FilterOptions) (PointFilter, error) {
+	switch strategy {
+	case "", FilterDropCurrent:
+		return DropCurrentFilter{}, nil
+	case FilterDropPreviousOnSpike:
+		return DropPreviousOnSpikeFilter{}, nil
+	case FilterRollingMedian:
+		if options.Window <= 0 {
+			options.Window = DefaultMedianWindow
+		}
+		return RollingMedianFilter{Window: options.Window}, nil
+	case FilterKalman:
+		if options.ProcessNoise <= 0 {
+			options.ProcessNoise = DefaultProcessNoise
+		}
+		if options.MeasurementNoise <= 0 {
+			options.MeasurementNoise = DefaultMeasurementNoise
+		}
+		return KalmanFilter{ProcessNoise: options.ProcessNoise, MeasurementNoise: options.MeasurementNoise}, nil
+	default:
+		return nil, fmt.Errorf("unknown point filter %q", strategy)
+	}
+}
+
+// BuildDelivery filters the points of a delivery and builds its segments from the points kept.
+// points outside the service area are dropped first, and a segment which is still invalid after filtering
+// drops its end point, like DropCurrentFilter. the violations of all the dropped points are recorded by the policy
+func BuildDelivery(id int, points []DeliveryPoint, filter PointFilter, policy *ValidationPolicy) (*Delivery, []DroppedPoint) {
+	delivery := NewDelivery(id)
+
+	// the filter probes the segments before they are built, so each distance is only measured once per delivery,
+	// which matters when it is measured on the roads. the violations are still recorded by the policy
+	measured := *policy
+	measured.Rules.DistanceModel = newMeasuredModel(policy.Rules.DistanceModel)
+	policy = &measured
+
+	var dropped []DroppedPoint
+	inside := make([]DeliveryPoint, 0, len(points))
+	for _, point := range points {
+		if err := policy.ValidatePoint(point); err != nil {
+			dropped = append(dropped, DroppedPoint{Point: point, Err: err})
+			continue
+		}
+		inside = append(inside, point)
+	}
+
+	kept, filtered := filter.Filter(inside, policy)
+	dropped = append(dropped, filtered...)
+
+	var previousPoint *DeliveryPoint
+	for i := range kept {
+		if previousPoint != nil {
+			if err := delivery.addSegment(*previousPoint, kept[i], policy); err != nil {
+				dropped = append(dropped, DroppedPoint{Point: kept[i], Err: err})
+				continue
+			}
+		}
+		previousPoint = &kept[i]
+	}
+
+	for _, point := range dropped {
+		policy.Record(point.Err)
+	}
+	return delivery, dropped
+}
+
+// DropCurrentFilter drops a point when the segment from the last kept point to it is invalid,
+// so a spike is dropped but a bad first point drops the points after it
+type DropCurrentFilter struct{}
+
+// Name returns the name of the strategy
+func (DropCurrentFilter) Name() string {
+	return FilterDropCurrent
+}
+
+// Filter returns the points which make valid segments with the last kept point
+func (DropCurrentFilter) Filter(points []DeliveryPoint, policy *ValidationPolicy) ([]DeliveryPoint, []DroppedPoint) {
+	kept := make([]DeliveryPoint, 0, len(points))
+	var dropped []DroppedPoint
+	for _, point := range points {
+		if len(kept) > 0 {
+			if _, err := newSegment(kept[len(kept)-1], point, policy); err != nil {
+				dropped = append(dropped, DroppedPoint{Point: point, Err: err})
+				continue
+			}
+		}
+		kept = append(kept, point)
+	}
+	return kept, dropped
+}
+
+// DropPreviousOnSpikeFilter works like DropCurrentFilter, but when a speed spike is caused by the last kept point
+// being off the trace, that point is dropped instead of the current one
+type DropPreviousOnSpikeFilter struct{}
+
+// Name returns the name of the strategy
+func (DropPreviousOnSpikeFilter) Name() string {
+	return FilterDropPreviousOnSpike
+}
+
+// Filter returns the points left once the spikes are dropped
+func (f DropPreviousOnSpikeFilter) Filter(points []DeliveryPoint, policy *ValidationPolicy) ([]DeliveryPoint, []DroppedPoint) {
+	kept := make([]DeliveryPoint, 0, len(points))
+	var dropped []DroppedPoint
+	for i, point := range points {
+		if len(kept) == 0 {
+			kept = append(kept, point)
+			continue
+		}
+
+		last := kept[len(kept)-1]
+		_, err := newSegment(last, point, policy)
+		if err == nil {
+			kept = append(kept, point)
+			continue
+		}
+		if (errors.Is(err, ErrSpeedLimitExceeded) || errors.Is(err, ErrHopDistanceExceeded)) && f.previousIsSpike(kept, point, points[i+1:], policy) {
+			dropped = append(dropped, DroppedPoint{Point: last, Err: err})
+			kept[len(kept)-1] = point
+			continue
+		}
+		dropped = append(dropped, DroppedPoint{Point: point, Err: err})
+	}
+	return kept, dropped
+}
+
+// previousIsSpike tells whether the last kept point, rather than the current one, is off the trace
+func (DropPreviousOnSpikeFilter) previousIsSpike(kept []DeliveryPoint, point DeliveryPoint, rest []DeliveryPoint, policy *ValidationPolicy) bool {
+	if len(kept) >= 2 {
+		_, err := newSegment(kept[len(kept)-2], point, policy)
+		return err == nil
+	}
+	// the last kept point is the first one, so the point after the current one tells which of them is off the trace
+	if len(rest) == 0 {
+		return false
+	}
+	_, currentErr := newSegment(point, rest[0], policy)
+	_, previousErr := newSegment(kept[0], rest[0], policy)
+	return currentErr == nil && previousErr != nil
+}
+
+// RollingMedianFilter replaces the position of each point by the median of the positions of the Window points around it,
+// which removes isolated spikes without dropping their timestamps
+type RollingMedianFilter struct {
+	Window int
+}
+
+// Name returns the name of the strategy
+func (RollingMedianFilter) Name() string {
+	return FilterRollingMedian
+}
+
+// Filter returns the smoothed points, none of them is dropped
+func (f RollingMedianFilter) Filter(points []DeliveryPoint, policy *ValidationPolicy) ([]DeliveryPoint, []DroppedPoint) {
+	half := f.Window / 2
+	smoothed := make([]DeliveryPoint, len(points))
+	latitudes := make([]float64, 0, f.Window)
+	longitudes := make([]float64, 0, f.Window)
+	for i := range points {
+		latitudes, longitudes = latitudes[:0], longitudes[:0]
+		for j := max(0, i-half); j <= min(len(points)-1, i+half); j++ {
+			latitudes = append(latitudes, points[j].Latitude)
+			longitudes = append(longitudes, points[j].Longitude)
+		}
+
+		smoothed[i] = points[i]
+		smoothed[i].Latitude = median(latitudes)
+		smoothed[i].Longitude = median(longitudes)
+	}
+	return smoothed, nil
+}
+
+// median returns the median of the values, the values are sorted in place
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	middle := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[middle-1] + values[middle]) / 2
+	}
+	return values[middle]
+}
+
+// KalmanFilter drops the spikes like DropCurrentFilter, then smooths the positions of the points left with a Kalman filter,
+// where the position drifts by ProcessNoise m/s and each point is measured with an error of MeasurementNoise metres
+type KalmanFilter struct {
+	ProcessNoise     float64
+	MeasurementNoise float64
+}
+
+// Name returns the name of the strategy
+func (KalmanFilter) Name() string {
+	return FilterKalman
+}
+
+// Filter returns the smoothed points and the spikes dropped
+func (f KalmanFilter) Filter(points []DeliveryPoint, policy *ValidationPolicy) ([]DeliveryPoint, []DroppedPoint) {
+	kept, dropped := DropCurrentFilter{}.Filter(points, policy)
+
+	measurementVariance := f.MeasurementNoise * f.MeasurementNoise
+	var latitude, longitude, variance float64
+	for i := range kept {
+		if i == 0 {
+			latitude, longitude, variance = kept[i].Latitude, kept[i].Longitude, measurementVariance
+			continue
+		}
+
+		// the position may have drifted by ProcessNoise m/s since the last point, so the variance of the estimate
+		// grows by the square of the drift (in m²), whatever the sampling rate
+		if elapsed := kept[i].Timestamp - kept[i-1].Timestamp; elapsed > 0 {
+			drift := float64(elapsed) * f.ProcessNoise
+			variance += drift * drift
+		}
+		gain := variance / (variance + measurementVariance)
+		latitude += gain * (kept[i].Latitude - latitude)
+		longitude += gain * (kept[i].Longitude - longitude)
+		variance = (1 - gain) * variance
+
+		kept[i].Latitude, kept[i].Longitude = latitude, longitude
+	}
+	return kept, dropped
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"github.com/aref81/snappbox_fare_estimator/shared/distance"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// countingModel is a haversine model counting the distances measured
+type countingModel struct {
+	distance.Haversine
+	measured *int
+}
+
+func (m countingModel) Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	*m.measured++
+	return m.Haversine.Distance(lat1, lon1, lat2, lon2)
+}
+
+// spikyTrace is a straight trace with a GPS spike at its third point
+func spikyTrace() []DeliveryPoint {
+	return []DeliveryPoint{
+		{DeliveryID: 1, Latitude: 35.7000, Longitude: 51.4000, Timestamp: 1000},
+		{DeliveryID: 1, Latitude: 35.7010, Longitude: 51.4000, Timestamp: 1060},
+		{DeliveryID: 1, Latitude: 36.7000, Longitude: 52.4000, Timestamp: 1120},
+		{DeliveryID: 1, Latitude: 35.7030, Longitude: 51.4000, Timestamp: 1180},
+		{DeliveryID: 1, Latitude: 35.7040, Longitude: 51.4000, Timestamp: 1240},
+	}
+}
+
+// TestNewPointFilter tests selecting the strategies by name
+func TestNewPointFilter(t *testing.T) {
+	for _, strategy := range []string{FilterDropCurrent, FilterDropPreviousOnSpike, FilterRollingMedian, FilterKalman} {
+		filter, err := NewPointFilter(strategy, FilterOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, strategy, filter.Name())
+	}
+
+	filter, err := NewPointFilter("", FilterOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, FilterDropCurrent, filter.Name(), "drop_current should be the default strategy")
+
+	_, err = NewPointFilter("unknown", FilterOptions{})
+	assert.Error(t, err)
+}
+
+// TestDropCurrentFilter tests that the spike is dropped and the rest of the trace is kept
+func TestDropCurrentFilter(t *testing.T) {
+	points := spikyTrace()
+	delivery, dropped := BuildDelivery(1, points, DropCurrentFilter{}, NewValidationPolicy(ValidationRules{}))
+
+	assert.Len(t, delivery.Segments, 3)
+	assert.Len(t, dropped, 1)
+	assert.Equal(t, points[2], dropped[0].Point)
+	assert.ErrorIs(t, dropped[0].Err, ErrSpeedLimitExceeded)
+}
+
+// TestDropPreviousOnSpikeFilter tests that a spike at the first point drops it, instead of the rest of the trace
+func TestDropPreviousOnSpikeFilter(t *testing.T) {
+	points := spikyTrace()[2:]
+
+	_, dropped := BuildDelivery(1, points, DropCurrentFilter{}, NewValidationPolicy(ValidationRules{}))
+	assert.Len(t, dropped, 2, "drop_current keeps the spike and drops the points after it")
+
+	delivery, dropped := BuildDelivery(1, points, DropPreviousOnSpikeFilter{}, NewValidationPolicy(ValidationRules{}))
+	assert.Len(t, delivery.Segments, 1)
+	assert.Len(t, dropped, 1)
+	assert.Equal(t, points[0], dropped[0].Point)
+
+	// a spike in the middle of the trace is dropped like drop_current does
+	delivery, dropped = BuildDelivery(1, spikyTrace(), DropPreviousOnSpikeFilter{}, NewValidationPolicy(ValidationRules{}))
+	assert.Len(t, delivery.Segments, 3)
+	assert.Equal(t, spikyTrace()[2], dropped[0].Point)
+}
+
+// TestRollingMedianFilter tests that the spike is moved back on the trace instead of being dropped
+func TestRollingMedianFilter(t *testing.T) {
+	delivery, dropped := BuildDelivery(1, spikyTrace(), RollingMedianFilter{Window: 3}, NewValidationPolicy(ValidationRules{}))
+
+	assert.Empty(t, dropped)
+	assert.Len(t, delivery.Segments, 4, "all the timestamps should be kept")
+	for _, segment := range delivery.Segments {
+		assert.Less(t, segment.Speed, 20.0, "the spike should be replaced by a position on the trace")
+	}
+}
+
+// TestKalmanFilter tests that the spike is dropped and the jitter of the trace is smoothed
+func TestKalmanFilter(t *testing.T) {
+	points := []DeliveryPoint{
+		{DeliveryID: 1, Latitude: 35.7000, Longitude: 51.4000, Timestamp: 1000},
+		{DeliveryID: 1, Latitude: 35.7004, Longitude: 51.4000, Timestamp: 1060},
+		{DeliveryID: 1, Latitude: 35.7000, Longitude: 51.4000, Timestamp: 1120},
+		{DeliveryID: 1, Latitude: 36.7000, Longitude: 52.4000, Timestamp: 1180},
+		{DeliveryID: 1, Latitude: 35.7004, Longitude: 51.4000, Timestamp: 1240},
+	}
+	raw, _ := BuildDelivery(1, points, DropCurrentFilter{}, NewValidationPolicy(ValidationRules{}))
+	smoothed, dropped := BuildDelivery(1, points, KalmanFilter{ProcessNoise: DefaultProcessNoise, MeasurementNoise: DefaultMeasurementNoise}, NewValidationPolicy(ValidationRules{}))
+
+	assert.Len(t, dropped, 1)
+	assert.Equal(t, points[3], dropped[0].Point)
+	assert.Len(t, smoothed.Segments, len(raw.Segments))
+	assert.Less(t, totalDistance(smoothed), totalDistance(raw), "smoothing should shorten a jittery trace")
+}
+
+// TestKalmanFilter_IrregularTimestamps tests that a point after a long gap is trusted, as the courier may have moved
+// ProcessNoise m/s since the last point, while a point right after the last one is smoothed
+func TestKalmanFilter_IrregularTimestamps(t *testing.T) {
+	filter := KalmanFilter{ProcessNoise: DefaultProcessNoise, MeasurementNoise: DefaultMeasurementNoise}
+	// the point after the gap is 0.0002° (about 22 m) north of where the courier waited
+	gain := func(gap int64) float64 {
+		var points []DeliveryPoint
+		for i := int64(0); i < 10; i++ {
+			points = append(points, DeliveryPoint{DeliveryID: 1, Latitude: 35.7, Longitude: 51.4, Timestamp: 1000 + i})
+		}
+		points = append(points, DeliveryPoint{DeliveryID: 1, Latitude: 35.7002, Longitude: 51.4, Timestamp: 1009 + gap})
+		kept, dropped := filter.Filter(points, NewValidationPolicy(ValidationRules{}))
+		assert.Empty(t, dropped)
+		return (kept[len(kept)-1].Latitude - 35.7) / 0.0002
+	}
+
+	// 1 s drifts by 3 m, within the 15 m error of a point, and 60 s by 180 m
+	assert.Less(t, gain(1), 0.3)
+	assert.Greater(t, gain(60), 0.95)
+}
+
+func totalDistance(delivery *Delivery) float64 {
+	distance := 0.0
+	for _, segment := range delivery.Segments {
+		distance += segment.Distance
+	}
+	return distance
+}
+
+// TestBuildDelivery_MeasuredOnce tests that the segments probed by the filter are not measured again when built
+func TestBuildDelivery_MeasuredOnce(t *testing.T) {
+	measured := 0
+	policy := NewValidationPolicy(ValidationRules{DistanceModel: countingModel{measured: &measured}})
+	delivery, dropped := BuildDelivery(1, spikyTrace(), DropCurrentFilter{}, policy)
+
+	assert.Len(t, delivery.Segments, 3)
+	assert.Len(t, dropped, 1)
+	// the 3 segments kept and the one to the spike
+	assert.Equal(t, 4, measured)
+	assert.Equal(t, countingModel{measured: &measured}, policy.Rules.DistanceModel, "the model of the policy should not be replaced")
+}
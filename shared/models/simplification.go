@@ -0,0 +1,249 @@
+package models
+
+import (
+	"container/heap"
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/shared/distance"
+	"math"
+)
+
+// names of the Simplifier algorithms
+const (
+	SimplifyDouglasPeucker = "douglas_peucker"
+	SimplifyVisvalingam    = "visvalingam"
+)
+
+// Simplifier removes the points of a trace which add little to its shape, e.g. the points along a straight road
+type Simplifier interface {
+	// Name returns the name of the algorithm
+	Name() string
+	// Simplify returns the points kept, in order. the first and the last points are always kept, and the points
+	// are not removed if the segment replacing them would break the max time gap or the max hop distance of the policy
+	Simplify(points []DeliveryPoint, policy *ValidationPolicy) []DeliveryPoint
+}
+
+// NewSimplifier creates the simplifier of the algorithm with a tolerance in metres, an empty algorithm is douglas_peucker
+func NewSimplifier(algorithm string, tolerance float64) (Simplifier, error) {
+	if tolerance <= 0 {
+		return nil, fmt.Errorf("invalid simplification tolerance %g, it should be positive", tolerance)
+	}
+	switch algorithm {
+	case "", SimplifyDouglasPeucker:
+		return DouglasPeuckerSimplifier{Tolerance: tolerance}, nil
+	case SimplifyVisvalingam:
+		return VisvalingamSimplifier{Tolerance: tolerance}, nil
+	default:
+		return nil, fmt.Errorf("unknown simplification algorithm %q", algorithm)
+	}
+}
+
+// SimplifiedFilter is a PointFilter simplifying the points kept by its filter,
+// the points removed by the simplification are not dropped as invalid
+type SimplifiedFilter struct {
+	PointFilter
+	Simplifier Simplifier
+}
+
+// Name returns the names of the strategy and of the simplification
+func (f SimplifiedFilter) Name() string {
+	return f.PointFilter.Name() + "+" + f.Simplifier.Name()
+}
+
+// Filter filters the points, then simplifies the points kept
+func (f SimplifiedFilter) Filter(points []DeliveryPoint, policy *ValidationPolicy) ([]DeliveryPoint, []DroppedPoint) {
+	kept, dropped := f.PointFilter.Filter(points, policy)
+	return f.Simplifier.Simplify(kept, policy), dropped
+}
+
+// DouglasPeuckerSimplifier keeps the point farthest from the segment between the first and the last points,
+// if it is farther than Tolerance (in m), and simplifies both halves in turn. the distance is taken to where
+// the courier would have been at the time of the point at a constant speed along the segment, so a stop
+// on a straight road is kept, and with it the idle time of the delivery
+type DouglasPeuckerSimplifier struct {
+	Tolerance float64
+}
+
+// Name returns the name of the algorithm
+func (DouglasPeuckerSimplifier) Name() string {
+	return SimplifyDouglasPeucker
+}
+
+// Simplify returns the points kept
+func (s DouglasPeuckerSimplifier) Simplify(points []DeliveryPoint, policy *ValidationPolicy) []DeliveryPoint {
+	if len(points) < 3 {
+		return points
+	}
+	plane := project(points)
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+
+	// the ranges left to simplify, first and last point included
+	ranges := [][2]int{{0, len(points) - 1}}
+	for len(ranges) > 0 {
+		first, last := ranges[len(ranges)-1][0], ranges[len(ranges)-1][1]
+		ranges = ranges[:len(ranges)-1]
+		if last-first < 2 {
+			continue
+		}
+
+		farthest, maxDistance := first+1, -1.0
+		for i := first + 1; i < last; i++ {
+			if d := synchronizedDistance(plane, points, first, i, last); d > maxDistance {
+				farthest, maxDistance = i, d
+			}
+		}
+		if maxDistance <= s.Tolerance && policy.allowsSegment(points[first], points[last]) {
+			continue
+		}
+		keep[farthest] = true
+		ranges = append(ranges, [2]int{first, farthest}, [2]int{farthest, last})
+	}
+
+	kept := make([]DeliveryPoint, 0, len(points))
+	for i := range points {
+		if keep[i] {
+			kept = append(kept, points[i])
+		}
+	}
+	return kept
+}
+
+// VisvalingamSimplifier removes the point making the smallest triangle with its neighbours, as long as its area
+// is below Tolerance² (in m²), e.g. a point 10 m off a 20 m long line with a tolerance of 10 m.
+// unlike DouglasPeuckerSimplifier it only looks at the shape of the trace, so the points of a stop are removed
+type VisvalingamSimplifier struct {
+	Tolerance float64
+}
+
+// Name returns the name of the algorithm
+func (VisvalingamSimplifier) Name() string {
+	return SimplifyVisvalingam
+}
+
+// Simplify returns the points kept
+func (s VisvalingamSimplifier) Simplify(points []DeliveryPoint, policy *ValidationPolicy) []DeliveryPoint {
+	if len(points) < 3 {
+		return points
+	}
+	plane := project(points)
+	maxArea := s.Tolerance * s.Tolerance
+
+	// the points left form a linked list, the removable ones are queued by the area of their triangle
+	previous := make([]int, len(points))
+	next := make([]int, len(points))
+	queue := &triangleQueue{index: make([]int, len(points))}
+	for i := range points {
+		previous[i], next[i] = i-1, i+1
+		queue.index[i] = -1
+	}
+	area := func(i int) float64 {
+		if !policy.allowsSegment(points[previous[i]], points[next[i]]) {
+			return math.Inf(1)
+		}
+		return triangleArea(plane[previous[i]], plane[i], plane[next[i]])
+	}
+	for i := 1; i < len(points)-1; i++ {
+		heap.Push(queue, triangle{point: i, area: area(i)})
+	}
+
+	removed := make([]bool, len(points))
+	for queue.Len() > 0 && queue.triangles[0].area < maxArea {
+		i := heap.Pop(queue).(triangle).point
+		removed[i] = true
+		next[previous[i]], previous[next[i]] = next[i], previous[i]
+		for _, neighbour := range []int{previous[i], next[i]} {
+			if j := queue.index[neighbour]; j >= 0 {
+				queue.triangles[j].area = area(neighbour)
+				heap.Fix(queue, j)
+			}
+		}
+	}
+
+	kept := make([]DeliveryPoint, 0, len(points))
+	for i := range points {
+		if !removed[i] {
+			kept = append(kept, points[i])
+		}
+	}
+	return kept
+}
+
+// planePoint is a position on a plane, in metres
+type planePoint struct {
+	x, y float64
+}
+
+// project projects the points on a plane tangent at the first point, which is accurate over the size of a city
+func project(points []DeliveryPoint) []planePoint {
+	metresPerDegree := distance.EarthRadius * 1000 * math.Pi / 180
+	metresPerLongitude := metresPerDegree * math.Cos(points[0].Latitude*math.Pi/180)
+	plane := make([]planePoint, len(points))
+	for i, p := range points {
+		plane[i] = planePoint{
+			x: (p.Longitude - points[0].Longitude) * metresPerLongitude,
+			y: (p.Latitude - points[0].Latitude) * metresPerDegree,
+		}
+	}
+	return plane
+}
+
+// synchronizedDistance returns the distance (in m) of the point i to the position on the segment from first to last
+// at the time of the point, at a constant speed
+func synchronizedDistance(plane []planePoint, points []DeliveryPoint, first, i, last int) float64 {
+	ratio := 0.0
+	if duration := points[last].Timestamp - points[first].Timestamp; duration > 0 {
+		ratio = float64(points[i].Timestamp-points[first].Timestamp) / float64(duration)
+	}
+	x := plane[first].x + ratio*(plane[last].x-plane[first].x)
+	y := plane[first].y + ratio*(plane[last].y-plane[first].y)
+	return math.Hypot(plane[i].x-x, plane[i].y-y)
+}
+
+// triangleArea returns the area (in m²) of the triangle of three points
+func triangleArea(a, b, c planePoint) float64 {
+	return math.Abs((b.x-a.x)*(c.y-a.y)-(c.x-a.x)*(b.y-a.y)) / 2
+}
+
+// allowsSegment tells whether a segment between the points keeps to the max time gap and the max hop distance
+func (p *ValidationPolicy) allowsSegment(start DeliveryPoint, end DeliveryPoint) bool {
+	if p.Rules.MaxTimeGap > 0 && float64(end.Timestamp-start.Timestamp) > p.Rules.MaxTimeGap.Seconds() {
+		return false
+	}
+	if p.Rules.MaxHopDistance > 0 &&
+		p.Rules.DistanceModel.Distance(start.Latitude, start.Longitude, end.Latitude, end.Longitude) > p.Rules.MaxHopDistance {
+		return false
+	}
+	return true
+}
+
+// triangle is a point queued for removal by the area of the triangle with its neighbours
+type triangle struct {
+	point int
+	area  float64
+}
+
+// triangleQueue is the priority queue of the points, smallest triangle first. index holds the position
+// of each point in the queue, -1 once removed
+type triangleQueue struct {
+	triangles []triangle
+	index     []int
+}
+
+func (q *triangleQueue) Len() int           { return len(q.triangles) }
+func (q *triangleQueue) Less(i, j int) bool { return q.triangles[i].area < q.triangles[j].area }
+func (q *triangleQueue) Swap(i, j int) {
+	q.triangles[i], q.triangles[j] = q.triangles[j], q.triangles[i]
+	q.index[q.triangles[i].point] = i
+	q.index[q.triangles[j].point] = j
+}
+func (q *triangleQueue) Push(x interface{}) {
+	t := x.(triangle)
+	q.index[t.point] = len(q.triangles)
+	q.triangles = append(q.triangles, t)
+}
+func (q *triangleQueue) Pop() interface{} {
+	t := q.triangles[len(q.triangles)-1]
+	q.triangles = q.triangles[:len(q.triangles)-1]
+	q.index[t.point] = -1
+	return t
+}
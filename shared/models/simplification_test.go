@@ -0,0 +1,114 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+// longitudePerMetre is the longitude (in degrees) of a metre east at the latitude of the traces
+var longitudePerMetre = 1 / (6371000 * math.Pi / 180 * math.Cos(35.7*math.Pi/180))
+
+// eastTrace is a 1-second trace going east at 10 m/s, zigzagging by jitter metres, the courier stops
+// for the seconds of stop (if any) after 30 seconds
+func eastTrace(jitter float64, stop int) []DeliveryPoint {
+	var points []DeliveryPoint
+	east := 0.0
+	for second := 0; second <= 60+stop; second++ {
+		if second <= 30 || second > 30+stop {
+			east += 10
+		}
+		north := jitter
+		if second%2 == 0 {
+			north = -jitter
+		}
+		points = append(points, DeliveryPoint{
+			DeliveryID: 1,
+			Latitude:   35.7 + north/111195,
+			Longitude:  51.4 + east*longitudePerMetre,
+			Timestamp:  int64(1000 + second),
+		})
+	}
+	return points
+}
+
+// TestNewSimplifier tests selecting the algorithms by name
+func TestNewSimplifier(t *testing.T) {
+	for _, algorithm := range []string{SimplifyDouglasPeucker, SimplifyVisvalingam} {
+		simplifier, err := NewSimplifier(algorithm, 5)
+		assert.NoError(t, err)
+		assert.Equal(t, algorithm, simplifier.Name())
+	}
+
+	simplifier, err := NewSimplifier("", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, SimplifyDouglasPeucker, simplifier.Name(), "douglas_peucker should be the default algorithm")
+
+	_, err = NewSimplifier("unknown", 5)
+	assert.Error(t, err)
+	_, err = NewSimplifier(SimplifyDouglasPeucker, 0)
+	assert.Error(t, err)
+}
+
+// TestSimplify_StraightRoad tests that the points along a straight road are simplified away, but not a zigzag
+// wider than the tolerance
+func TestSimplify_StraightRoad(t *testing.T) {
+	policy := NewValidationPolicy(ValidationRules{})
+
+	// Douglas-Peucker removes the jitter within the tolerance
+	points := eastTrace(2, 0)
+	assert.Equal(t, []DeliveryPoint{points[0], points[len(points)-1]}, DouglasPeuckerSimplifier{Tolerance: 5}.Simplify(points, policy))
+	assert.Len(t, DouglasPeuckerSimplifier{Tolerance: 1}.Simplify(points, policy), len(points))
+
+	// the triangles of Visvalingam grow with the points removed, so the jitter is only smoothed
+	assert.Len(t, VisvalingamSimplifier{Tolerance: 5}.Simplify(points, policy), len(points))
+	assert.Less(t, len(VisvalingamSimplifier{Tolerance: 10}.Simplify(points, policy)), len(points)/2)
+	points = eastTrace(0, 0)
+	assert.Equal(t, []DeliveryPoint{points[0], points[len(points)-1]}, VisvalingamSimplifier{Tolerance: 5}.Simplify(points, policy))
+}
+
+// TestSimplify_Stop tests that Douglas-Peucker keeps a stop on a straight road, and its idle time, but not Visvalingam
+func TestSimplify_Stop(t *testing.T) {
+	policy := NewValidationPolicy(ValidationRules{})
+	points := eastTrace(0, 120)
+	original, _ := BuildDelivery(1, points, DropCurrentFilter{}, policy)
+
+	kept := DouglasPeuckerSimplifier{Tolerance: 5}.Simplify(points, policy)
+	assert.Less(t, len(kept), 10)
+	simplified, _ := BuildDelivery(1, kept, DropCurrentFilter{}, policy)
+	fareRules := FareRules{FlagAmount: 1.30, IdleFarePerHour: 11.90, MovingDayFarePerKm: 0.74, MovingNightFarePerKm: 1.30, DayStartHour: 5, DayEndHour: 24}
+	assert.InDelta(t, fareRules.CalculateFare(original), fareRules.CalculateFare(simplified), 0.01)
+	assert.InDelta(t, totalDistance(original), totalDistance(simplified), 0.001)
+
+	kept = VisvalingamSimplifier{Tolerance: 5}.Simplify(points, policy)
+	assert.Len(t, kept, 2)
+}
+
+// TestSimplify_Policy tests that points are kept rather than making a segment breaking the max time gap or hop distance
+func TestSimplify_Policy(t *testing.T) {
+	points := eastTrace(0, 0)
+	for _, rules := range []ValidationRules{{MaxTimeGap: 20 * time.Second}, {MaxHopDistance: 0.2}} {
+		policy := NewValidationPolicy(rules)
+		for _, simplifier := range []Simplifier{DouglasPeuckerSimplifier{Tolerance: 5}, VisvalingamSimplifier{Tolerance: 5}} {
+			kept := simplifier.Simplify(points, policy)
+			assert.Greater(t, len(kept), 2, simplifier.Name())
+
+			delivery, dropped := BuildDelivery(1, kept, DropCurrentFilter{}, policy)
+			assert.Empty(t, dropped, simplifier.Name())
+			assert.InDelta(t, 0.6, totalDistance(delivery), 0.001, simplifier.Name())
+		}
+	}
+}
+
+// TestSimplifiedFilter tests that the points removed by the simplification are not dropped
+func TestSimplifiedFilter(t *testing.T) {
+	filter := SimplifiedFilter{PointFilter: DropCurrentFilter{}, Simplifier: DouglasPeuckerSimplifier{Tolerance: 5}}
+	assert.Equal(t, "drop_current+douglas_peucker", filter.Name())
+
+	points := append(eastTrace(0, 0), spikyTrace()[2])
+	points[len(points)-1].Timestamp = 1061
+	delivery, dropped := BuildDelivery(1, points, filter, NewValidationPolicy(ValidationRules{}))
+	assert.Len(t, delivery.Segments, 1)
+	assert.Len(t, dropped, 1, "only the spike should be dropped")
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"github.com/aref81/snappbox_fare_estimator/shared/distance"
+	"math"
+	"time"
+)
+
+// statuses of a DeliverySegment classified by a StopDetector
+const (
+	StatusMoving = "moving"
+	StatusIdle   = "idle"
+)
+
+const (
+	// DefaultDwellRadius is the distance (in m) a courier stays within during a stop, when no radius is configured
+	DefaultDwellRadius = 30.0
+	// DefaultMinDwell is the shortest stop, when no duration is configured
+	DefaultMinDwell = time.Minute
+)
+
+// Dwell is a period a courier stayed at the same place, between two timestamps
+type Dwell struct {
+	Start int64
+	End   int64
+}
+
+// StopDetector finds the stops of a courier: the runs of consecutive points staying within Radius (in m) of their
+// first point for at least MinDwell. the segments within a stop are idle, so GPS jitter at a stop is not billed as
+// movement, and the others are moving, even when slow
+type StopDetector struct {
+	Radius   float64
+	MinDwell time.Duration
+	// DistanceModel measures the distances to the first point of a stop, it should be the model the segments are
+	// measured with so the stops agree with the distances billed
+	DistanceModel distance.Model
+}
+
+// NewStopDetector creates a StopDetector, zero values fall back to the defaults and a nil model to haversine
+func NewStopDetector(radius float64, minDwell time.Duration, model distance.Model) StopDetector {
+	if radius <= 0 {
+		radius = DefaultDwellRadius
+	}
+	if minDwell <= 0 {
+		minDwell = DefaultMinDwell
+	}
+	if model == nil {
+		model = distance.Haversine{}
+	}
+	return StopDetector{Radius: radius, MinDwell: minDwell, DistanceModel: model}
+}
+
+// Detect returns the dwell periods of the points of a delivery, in order
+func (d StopDetector) Detect(points []DeliveryPoint) []Dwell {
+	var dwells []Dwell
+	for first := 0; first < len(points); {
+		last := first
+		for last+1 < len(points) && d.within(points[first], points[last+1]) {
+			last++
+		}
+		if time.Duration(points[last].Timestamp-points[first].Timestamp)*time.Second < d.MinDwell {
+			first++
+			continue
+		}
+		dwells = append(dwells, Dwell{Start: points[first].Timestamp, End: points[last].Timestamp})
+		first = last + 1
+	}
+	return dwells
+}
+
+// within tells whether the point is within the radius of the first point of a stop
+func (d StopDetector) within(first DeliveryPoint, point DeliveryPoint) bool {
+	return d.DistanceModel.Distance(first.Latitude, first.Longitude, point.Latitude, point.Longitude)*1000 <= d.Radius
+}
+
+// Classify sets the status of each segment of the delivery: idle if it is within a dwell period of the points
+// of the delivery, moving otherwise
+func (d StopDetector) Classify(delivery *Delivery, points []DeliveryPoint) {
+	dwells := d.Detect(points)
+	for i := range delivery.Segments {
+		segment := &delivery.Segments[i]
+		end := segment.StartTime + int64(math.Round(segment.ElapsedTime*3600))
+		segment.Status = StatusMoving
+		for _, dwell := range dwells {
+			if segment.StartTime >= dwell.Start && end <= dwell.End {
+				segment.Status = StatusIdle
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"github.com/aref81/snappbox_fare_estimator/shared/distance"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// TestNewStopDetector tests the defaults of the stop detection
+func TestNewStopDetector(t *testing.T) {
+	assert.Equal(t, StopDetector{Radius: DefaultDwellRadius, MinDwell: DefaultMinDwell, DistanceModel: distance.Haversine{}}, NewStopDetector(0, 0, nil))
+	assert.Equal(t, StopDetector{Radius: 50, MinDwell: 2 * time.Minute, DistanceModel: distance.Vincenty{}}, NewStopDetector(50, 2*time.Minute, distance.Vincenty{}))
+}
+
+// TestStopDetector_Detect tests that a stop with GPS jitter is found, and not the points of a moving courier
+func TestStopDetector_Detect(t *testing.T) {
+	detector := NewStopDetector(0, 0, nil)
+
+	dwells := detector.Detect(eastTrace(3, 120))
+	assert.Len(t, dwells, 1)
+	// the stop starts and ends within the radius of where the courier stopped, at 10 m/s
+	assert.InDelta(t, 1030, dwells[0].Start, 3)
+	assert.InDelta(t, 1150, dwells[0].End, 3)
+
+	assert.Empty(t, detector.Detect(eastTrace(3, 0)))
+	assert.Empty(t, NewStopDetector(0, 5*time.Minute, nil).Detect(eastTrace(3, 120)), "the stop should be shorter than the min dwell")
+}
+
+// stillModel is a distance model for which the points never move, like the road distance of a courier drifting across the road
+type stillModel struct{}
+
+func (stillModel) Name() string { return "still" }
+
+func (stillModel) Distance(lat1, lon1, lat2, lon2 float64) float64 { return 0 }
+
+// TestStopDetector_DistanceModel tests that the stops are found with the distances of the model
+func TestStopDetector_DistanceModel(t *testing.T) {
+	points := eastTrace(3, 0)
+	dwells := NewStopDetector(0, 0, stillModel{}).Detect(points)
+	assert.Equal(t, []Dwell{{Start: points[0].Timestamp, End: points[len(points)-1].Timestamp}}, dwells)
+}
+
+// TestStopDetector_Classify tests that the jitter of a stop is billed as idle time instead of movement
+func TestStopDetector_Classify(t *testing.T) {
+	points := eastTrace(3, 120)
+	delivery, dropped := BuildDelivery(1, points, DropCurrentFilter{}, NewValidationPolicy(ValidationRules{}))
+	assert.Empty(t, dropped)
+
+	// the jitter of 6 m per second is faster than the idle speed
+	fareRules := FareRules{IdleFarePerHour: 3600, MovingDayFarePerKm: 1000, DayEndHour: 24}
+	withSpeed := fareRules.CalculateFare(delivery)
+
+	NewStopDetector(0, 0, nil).Classify(delivery, points)
+	var idle float64
+	for _, segment := range delivery.Segments {
+		assert.NotEmpty(t, segment.Status)
+		if segment.IsIdle() {
+			idle += segment.ElapsedTime * 3600
+		}
+	}
+	assert.InDelta(t, 120, idle, 3)
+
+	withStops := fareRules.CalculateFare(delivery)
+	assert.Less(t, withStops, withSpeed)
+	// the 60 seconds driven are billed by distance (about 700 m with the zigzag of the jitter), and the stop by its time
+	assert.InDelta(t, 700+120, withStops, 30)
+}
+
+// TestDeliverySegment_IsIdle tests that the status of a segment takes precedence over its speed
+func TestDeliverySegment_IsIdle(t *testing.T) {
+	assert.True(t, DeliverySegment{Speed: 5}.IsIdle())
+	assert.False(t, DeliverySegment{Speed: 20}.IsIdle())
+	assert.True(t, DeliverySegment{Speed: 20, Status: StatusIdle}.IsIdle())
+	assert.False(t, DeliverySegment{Speed: 5, Status: StatusMoving}.IsIdle())
+}
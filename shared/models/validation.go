@@ -0,0 +1,178 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aref81/snappbox_fare_estimator/shared/distance"
+	"sync/atomic"
+	"time"
+)
+
+// names of the rules of a ValidationPolicy
+const (
+	RuleMaxSpeed       = "max_speed"
+	RuleMaxTimeGap     = "max_time_gap"
+	RuleMaxHopDistance = "max_hop_distance"
+	RuleServiceArea    = "service_area"
+	RuleMaxAccuracy    = "max_accuracy"
+)
+
+// DefaultMaxSpeed is the speed limit (in km/h) of a segment, when no limit is configured
+const DefaultMaxSpeed = 100.0
+
+var (
+	// ErrTimeGapExceeded is returned for segments whose points are further apart in time than the max time gap
+	ErrTimeGapExceeded = errors.New("time gap between points exceeded")
+	// ErrHopDistanceExceeded is returned for segments longer than the max hop distance
+	ErrHopDistanceExceeded = errors.New("distance between points exceeded")
+	// ErrOutsideServiceArea is returned for points outside the service area
+	ErrOutsideServiceArea = errors.New("point outside the service area")
+	// ErrAccuracyExceeded is returned for points whose accuracy is worse than the max accuracy
+	ErrAccuracyExceeded = errors.New("point accuracy exceeded")
+)
+
+// defaultValidationPolicy validates the segments added by AddSegment, with the default speed limit only
+var defaultValidationPolicy = NewValidationPolicy(ValidationRules{})
+
+// BoundingBox is a rectangular area, in degrees
+type BoundingBox struct {
+	MinLatitude  float64
+	MaxLatitude  float64
+	MinLongitude float64
+	MaxLongitude float64
+}
+
+// IsZero tells whether the box is unset
+func (b BoundingBox) IsZero() bool {
+	return b == BoundingBox{}
+}
+
+// Contains tells whether the position is inside the box, borders included
+func (b BoundingBox) Contains(latitude float64, longitude float64) bool {
+	return latitude >= b.MinLatitude && latitude <= b.MaxLatitude &&
+		longitude >= b.MinLongitude && longitude <= b.MaxLongitude
+}
+
+// ValidationRules holds the thresholds of a ValidationPolicy, a zero threshold disables its rule,
+// except MaxSpeed which falls back to DefaultMaxSpeed
+type ValidationRules struct {
+	// DistanceModel calculates the distances (and so the speeds) of the segments checked, haversine when nil
+	DistanceModel distance.Model
+	// MaxSpeed is the speed limit of a segment, in km/h
+	MaxSpeed float64
+	// MaxTimeGap is the longest time allowed between the two points of a segment
+	MaxTimeGap time.Duration
+	// MaxHopDistance is the longest distance allowed between the two points of a segment, in km
+	MaxHopDistance float64
+	// ServiceArea is the area all the points should be in
+	ServiceArea BoundingBox
+	// MaxAccuracy is the worst horizontal accuracy of a point, in m. points without an accuracy are kept
+	MaxAccuracy float64
+	// PreferDeviceSpeed classifies a segment as idle or moving by the mean of the speeds reported by the device at
+	// its points, when both are reported, instead of its distance over its time. the rules still check the latter
+	PreferDeviceSpeed bool
+}
+
+// Violation is the error of a segment or point breaking a rule, it wraps the error of its rule
+type Violation struct {
+	Rule   string
+	Detail string
+	err    error
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("%v, %s", v.err, v.Detail)
+}
+
+func (v *Violation) Unwrap() error {
+	return v.err
+}
+
+// ValidationPolicy checks the segments of deliveries against configurable rules, and counts the violations of each rule.
+// violations are only counted once recorded, so segments which are only probed (e.g. by a PointFilter) are not counted
+type ValidationPolicy struct {
+	Rules      ValidationRules
+	violations map[string]*atomic.Int64
+}
+
+// NewValidationPolicy creates a new ValidationPolicy with the rules
+func NewValidationPolicy(rules ValidationRules) *ValidationPolicy {
+	if rules.MaxSpeed <= 0 {
+		rules.MaxSpeed = DefaultMaxSpeed
+	}
+	if rules.DistanceModel == nil {
+		rules.DistanceModel = distance.Haversine{}
+	}
+	policy := &ValidationPolicy{
+		Rules:      rules,
+		violations: make(map[string]*atomic.Int64),
+	}
+	for _, rule := range []string{RuleMaxSpeed, RuleMaxTimeGap, RuleMaxHopDistance, RuleServiceArea, RuleMaxAccuracy} {
+		policy.violations[rule] = &atomic.Int64{}
+	}
+	return policy
+}
+
+// ValidatePoint checks the point is inside the service area, and its accuracy
+func (p *ValidationPolicy) ValidatePoint(point DeliveryPoint) error {
+	if !p.Rules.ServiceArea.IsZero() && !p.Rules.ServiceArea.Contains(point.Latitude, point.Longitude) {
+		return &Violation{
+			Rule:   RuleServiceArea,
+			Detail: fmt.Sprintf("latitude = %f, longitude = %f", point.Latitude, point.Longitude),
+			err:    ErrOutsideServiceArea,
+		}
+	}
+	if p.Rules.MaxAccuracy > 0 && point.Accuracy != nil && *point.Accuracy > p.Rules.MaxAccuracy {
+		return &Violation{
+			Rule:   RuleMaxAccuracy,
+			Detail: fmt.Sprintf("accuracy = %f", *point.Accuracy),
+			err:    ErrAccuracyExceeded,
+		}
+	}
+	return nil
+}
+
+// ValidateSegment checks the time gap, distance and speed of the segment, in that order
+func (p *ValidationPolicy) ValidateSegment(segment DeliverySegment) error {
+	if p.Rules.MaxTimeGap > 0 && segment.ElapsedTime > p.Rules.MaxTimeGap.Hours() {
+		return &Violation{
+			Rule:   RuleMaxTimeGap,
+			Detail: fmt.Sprintf("timeDiff = %f", segment.ElapsedTime),
+			err:    ErrTimeGapExceeded,
+		}
+	}
+	if p.Rules.MaxHopDistance > 0 && segment.Distance > p.Rules.MaxHopDistance {
+		return &Violation{
+			Rule:   RuleMaxHopDistance,
+			Detail: fmt.Sprintf("distance = %f", segment.Distance),
+			err:    ErrHopDistanceExceeded,
+		}
+	}
+	if segment.Speed > p.Rules.MaxSpeed {
+		return &Violation{
+			Rule:   RuleMaxSpeed,
+			Detail: fmt.Sprintf("speed = %f", segment.Speed),
+			err:    ErrSpeedLimitExceeded,
+		}
+	}
+	return nil
+}
+
+// Record counts the error against its rule, if it is a Violation
+func (p *ValidationPolicy) Record(err error) {
+	var violation *Violation
+	if errors.As(err, &violation) {
+		if counter, ok := p.violations[violation.Rule]; ok {
+			counter.Add(1)
+		}
+	}
+}
+
+// Violations returns the number of violations recorded for each rule
+func (p *ValidationPolicy) Violations() map[string]int64 {
+	counts := make(map[string]int64, len(p.violations))
+	for rule, counter := range p.violations {
+		counts[rule] = counter.Load()
+	}
+	return counts
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"github.com/aref81/snappbox_fare_estimator/shared/distance"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// TestValidationPolicy_Rules tests that each rule reports its own violation
+func TestValidationPolicy_Rules(t *testing.T) {
+	policy := NewValidationPolicy(ValidationRules{
+		MaxSpeed:       80,
+		MaxTimeGap:     10 * time.Minute,
+		MaxHopDistance: 2,
+	})
+
+	assert.NoError(t, policy.ValidateSegment(DeliverySegment{ElapsedTime: 0.1, Distance: 1, Speed: 10}))
+
+	cases := []struct {
+		segment DeliverySegment
+		rule    string
+		err     error
+	}{
+		{DeliverySegment{ElapsedTime: 0.5, Distance: 1, Speed: 2}, RuleMaxTimeGap, ErrTimeGapExceeded},
+		{DeliverySegment{ElapsedTime: 0.1, Distance: 3, Speed: 30}, RuleMaxHopDistance, ErrHopDistanceExceeded},
+		{DeliverySegment{ElapsedTime: 0.01, Distance: 1, Speed: 100}, RuleMaxSpeed, ErrSpeedLimitExceeded},
+	}
+	for _, c := range cases {
+		err := policy.ValidateSegment(c.segment)
+		var violation *Violation
+		assert.ErrorAs(t, err, &violation)
+		assert.Equal(t, c.rule, violation.Rule)
+		assert.ErrorIs(t, err, c.err)
+	}
+}
+
+// TestValidationPolicy_DefaultSpeed tests that the speed limit defaults to 100 km/h and the other rules are disabled
+func TestValidationPolicy_DefaultSpeed(t *testing.T) {
+	policy := NewValidationPolicy(ValidationRules{})
+
+	assert.NoError(t, policy.ValidateSegment(DeliverySegment{ElapsedTime: 10, Distance: 500, Speed: 50}))
+	err := policy.ValidateSegment(DeliverySegment{ElapsedTime: 0.1, Distance: 11, Speed: 110})
+	assert.EqualError(t, err, "invalid processor point, speed = 110.000000")
+	assert.NoError(t, policy.ValidatePoint(DeliveryPoint{Latitude: -80, Longitude: 170}))
+}
+
+// TestBuildDelivery_Violations tests that the violations of the dropped points are counted per rule
+func TestBuildDelivery_Violations(t *testing.T) {
+	policy := NewValidationPolicy(ValidationRules{
+		ServiceArea: BoundingBox{MinLatitude: 35.5, MaxLatitude: 36, MinLongitude: 51, MaxLongitude: 51.7},
+	})
+
+	delivery, dropped := BuildDelivery(1, spikyTrace(), DropCurrentFilter{}, policy)
+	assert.Len(t, delivery.Segments, 3)
+	assert.Len(t, dropped, 1)
+	assert.ErrorIs(t, dropped[0].Err, ErrOutsideServiceArea, "the spike is outside the service area")
+
+	_, dropped = BuildDelivery(2, []DeliveryPoint{
+		{DeliveryID: 2, Latitude: 35.7000, Longitude: 51.4000, Timestamp: 1000},
+		{DeliveryID: 2, Latitude: 35.9000, Longitude: 51.6000, Timestamp: 1060},
+	}, DropCurrentFilter{}, policy)
+	assert.Len(t, dropped, 1)
+
+	assert.Equal(t, map[string]int64{
+		RuleMaxSpeed:       1,
+		RuleMaxTimeGap:     0,
+		RuleMaxHopDistance: 0,
+		RuleServiceArea:    1,
+		RuleMaxAccuracy:    0,
+	}, policy.Violations())
+}
+
+// TestValidationPolicy_MaxAccuracy tests that the fixes less accurate than the max accuracy are dropped,
+// and the points without an accuracy kept
+func TestValidationPolicy_MaxAccuracy(t *testing.T) {
+	precise, coarse := 8.0, 150.0
+	points := spikyTrace()
+	points[1].Accuracy = &precise
+	points[2].Accuracy = &coarse
+	policy := NewValidationPolicy(ValidationRules{MaxAccuracy: 50})
+
+	delivery, dropped := BuildDelivery(1, points, DropCurrentFilter{}, policy)
+	assert.Len(t, delivery.Segments, 3)
+	assert.Len(t, dropped, 1)
+	assert.Equal(t, points[2], dropped[0].Point)
+	assert.ErrorIs(t, dropped[0].Err, ErrAccuracyExceeded)
+	assert.Equal(t, int64(1), policy.Violations()[RuleMaxAccuracy])
+
+	assert.NoError(t, NewValidationPolicy(ValidationRules{}).ValidatePoint(points[2]), "the rule should be disabled by default")
+}
+
+// TestValidationPolicy_PreferDeviceSpeed tests that the speed reported by the devices classifies the segments when
+// both points report it, but the segments are still checked at their distance over their time
+func TestValidationPolicy_PreferDeviceSpeed(t *testing.T) {
+	// 1 km in 2 minutes is 30 km/h, while the device reports 1 and 2 m/s
+	slow, walking, driving := 1.0, 2.0, 6.0
+	start := DeliveryPoint{DeliveryID: 1, Latitude: 35.7000, Longitude: 51.4000, Timestamp: 1000, Speed: &slow}
+	end := DeliveryPoint{DeliveryID: 1, Latitude: 35.7090, Longitude: 51.4000, Timestamp: 1120, Speed: &walking}
+	policy := NewValidationPolicy(ValidationRules{PreferDeviceSpeed: true})
+
+	segment, err := newSegment(start, end, policy)
+	assert.NoError(t, err)
+	assert.InDelta(t, 30, segment.Speed, 0.1, "the speed should still be the distance over the time")
+	assert.Equal(t, StatusIdle, segment.Status)
+	assert.True(t, segment.IsIdle())
+
+	start.Speed, end.Speed = &driving, &driving
+	segment, err = newSegment(start, end, policy)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusMoving, segment.Status)
+
+	end.Speed = nil
+	segment, err = newSegment(start, end, policy)
+	assert.NoError(t, err)
+	assert.Empty(t, segment.Status, "the points without a speed should be classified by the distance over the time")
+
+	// a spike of 5 km in a minute is dropped, whatever the device reports
+	spike := DeliveryPoint{DeliveryID: 1, Latitude: 35.7450, Longitude: 51.4000, Timestamp: 1060, Speed: &slow}
+	_, err = newSegment(start, spike, policy)
+	assert.ErrorIs(t, err, ErrSpeedLimitExceeded)
+}
+
+// TestValidationPolicy_DistanceModel tests that the segments are measured with the distance model of the rules
+func TestValidationPolicy_DistanceModel(t *testing.T) {
+	start := DeliveryPoint{DeliveryID: 1, Latitude: 35.7000, Longitude: 51.4000, Timestamp: 1000}
+	end := DeliveryPoint{DeliveryID: 1, Latitude: 35.7090, Longitude: 51.4000, Timestamp: 1120}
+
+	haversine, err := newSegment(start, end, NewValidationPolicy(ValidationRules{}))
+	assert.NoError(t, err)
+	assert.InDelta(t, distance.Haversine{}.Distance(35.7000, 51.4000, 35.7090, 51.4000), haversine.Distance, 1e-12, "haversine should be the default model")
+
+	vincenty, err := newSegment(start, end, NewValidationPolicy(ValidationRules{DistanceModel: distance.Vincenty{}}))
+	assert.NoError(t, err)
+	assert.InDelta(t, distance.Vincenty{}.Distance(35.7000, 51.4000, 35.7090, 51.4000), vincenty.Distance, 1e-12)
+	assert.InDelta(t, vincenty.Distance/haversine.Distance, vincenty.Speed/haversine.Speed, 1e-12, "the speed should follow the distance")
+}